@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,8 +15,12 @@ import (
 	"github.com/go-chi/render"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/robloxxa/DistrictFunding/internal/auth"
 	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/mail"
+	"github.com/robloxxa/DistrictFunding/pkg/migrate"
+	"github.com/robloxxa/DistrictFunding/pkg/oidc"
 )
 
 func main() {
@@ -43,6 +49,25 @@ func main() {
 		return
 	}
 	conn.Release()
+
+	migrations, err := auth.Migrations()
+	if err != nil {
+		log.Fatalln(fmt.Errorf("unable to load migrations: %w", err))
+	}
+	migrator := migrate.New(pool, migrations)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if os.Getenv("DB_AUTO_MIGRATE") != "false" {
+		n, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Fatalln(fmt.Errorf("unable to migrate database: %w", err))
+		}
+		log.Printf("Applied %d migrations\n", n)
+	}
 	// Initialize JWT auth
 
 	log.Println("Connected to Database")
@@ -54,13 +79,95 @@ func main() {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 	r.Use(render.SetContentType(render.ContentTypeJSON))
-	jwt_secret, ok := os.LookupEnv("JWT_SECRET")
+	alg := jwa.EdDSA
+	if v, ok := os.LookupEnv("JWT_ALG"); ok {
+		alg = jwa.SignatureAlgorithm(v)
+	}
+	rotationInterval := 7 * 24 * time.Hour
+	if v, ok := os.LookupEnv("JWT_KEY_ROTATION_INTERVAL"); ok {
+		rotationInterval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalln(fmt.Errorf("invalid JWT_KEY_ROTATION_INTERVAL: %w", err))
+		}
+	}
+	// JWT_KEY_ENCRYPTION_KEY is base64 of 32 bytes, private signing keys are encrypted with it in the database
+	encryptionKey, err := base64.StdEncoding.DecodeString(os.Getenv("JWT_KEY_ENCRYPTION_KEY"))
+	if err != nil {
+		log.Fatalln(fmt.Errorf("invalid JWT_KEY_ENCRYPTION_KEY: %w", err))
+	}
+	rotator, err := auth.NewKeyRotator(context.Background(), pool, alg, rotationInterval, encryptionKey)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("unable to load signing keys: %w", err))
+	}
+	go rotator.Run(context.Background())
+	go auth.NewDeletionJob(pool).Run(context.Background())
+	ja := jwtauth.NewWithKeySource(rotator.KeySet())
+
+	from := os.Getenv("MAIL_FROM")
+	var mailer mail.Mailer
+	switch os.Getenv("MAILER") {
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		log.Printf("Writing emails to %s\n", dir)
+		mailer = mail.NewFile(dir, from)
+	default:
+		smtpAddr, ok := os.LookupEnv("SMTP_ADDR")
+		if !ok {
+			log.Fatalln("No SMTP_ADDR variable")
+		}
+		mailer = mail.NewSMTP(smtpAddr, from).WithAuth(os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	}
+
+	appUrl, ok := os.LookupEnv("APP_URL")
+	if !ok {
+		log.Fatalln("No APP_URL variable")
+	}
+
+	// Personal data exports collect data of campaign and payment services through their internal api
+	campaignUrl, ok := os.LookupEnv("CAMPAIGN_SERVICE_URL")
 	if !ok {
-		log.Fatalln("No jwt secret variable")
+		log.Fatalln("No CAMPAIGN_SERVICE_URL variable")
+	}
+	paymentUrl, ok := os.LookupEnv("PAYMENT_SERVICE_URL")
+	if !ok {
+		log.Fatalln("No PAYMENT_SERVICE_URL variable")
+	}
+	internalToken := os.Getenv("INTERNAL_API_TOKEN")
+	go auth.NewExportJob(pool, mailer, appUrl,
+		auth.NewServiceExportSource("campaigns", campaignUrl, internalToken),
+		auth.NewServiceExportSource("payments", paymentUrl, internalToken),
+	).Run(context.Background())
+
+	// OIDC_PROVIDERS is json array of oidc.Config, redirect url is {APP_URL}/oauth/{name}/callback by default
+	var configs []oidc.Config
+	if v := os.Getenv("OIDC_PROVIDERS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &configs); err != nil {
+			log.Fatalln(fmt.Errorf("invalid OIDC_PROVIDERS: %w", err))
+		}
+	}
+	var providers []*oidc.Provider
+	for _, cfg := range configs {
+		if cfg.RedirectUrl == "" {
+			cfg.RedirectUrl = appUrl + "/oauth/" + cfg.Name + "/callback"
+		}
+		providers = append(providers, oidc.New(cfg))
+	}
+	// Fake provider signs anyone in for local development, OIDC_FAKE_ISSUER is its url reachable from the browser
+	if issuer := os.Getenv("OIDC_FAKE_ISSUER"); issuer != "" {
+		fake, err := oidc.NewFakeProvider(issuer)
+		if err != nil {
+			log.Fatalln(fmt.Errorf("invalid OIDC_FAKE_ISSUER: %w", err))
+		}
+		if fake.Path() == "" {
+			log.Fatalln("OIDC_FAKE_ISSUER has to have a path, e.g. http://localhost:8000/oidc-fake")
+		}
+		log.Printf("Serving fake OIDC provider at %s\n", issuer)
+		r.Mount(fake.Path(), fake)
+		providers = append(providers, oidc.New(fake.Config(appUrl+"/oauth/"+oidc.FakeName+"/callback")).WithHTTPClient(fake.Client()))
 	}
-	ja := jwtauth.New("HS256", []byte(jwt_secret))
 
-	r.Mount("/", auth.NewController(pool, ja))
+	api := auth.NewController(pool, ja, rotator.KeySet(), mailer, appUrl, providers, internalToken)
+	r.Mount("/", api)
 
 	if err := http.ListenAndServe(":8080", r); err != nil {
 		log.Fatal(err)
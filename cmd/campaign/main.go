@@ -10,6 +10,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/robloxxa/DistrictFunding/internal/campaign"
 	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/migrate"
 	"log"
 	"net/http"
 	"os"
@@ -44,6 +45,25 @@ func main() {
 	}
 	conn.Release()
 
+	migrations, err := campaign.Migrations()
+	if err != nil {
+		log.Fatalln(fmt.Errorf("unable to load migrations: %w", err))
+	}
+	migrator := migrate.New(pool, migrations)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if os.Getenv("DB_AUTO_MIGRATE") != "false" {
+		n, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Fatalln(fmt.Errorf("unable to migrate database: %w", err))
+		}
+		log.Printf("Applied %d migrations\n", n)
+	}
+
 	// Initialize JWT auth
 
 	log.Println("Connected to Database")
@@ -56,9 +76,31 @@ func main() {
 	r.Use(middleware.Timeout(60 * time.Second))
 	r.Use(render.SetContentType(render.ContentTypeJSON))
 
-	ja := jwtauth.New("HS256", []byte(os.Getenv("JWT_SECRET")))
+	jwksUrl, ok := os.LookupEnv("JWKS_URL")
+	if !ok {
+		log.Fatalln("No JWKS_URL variable")
+	}
+	keys, err := jwtauth.NewRemoteKeySet(context.Background(), jwksUrl, 5*time.Minute)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("unable to fetch jwks: %w", err))
+	}
+	ja := jwtauth.NewWithKeySource(keys)
+	// INTERNAL_API_TOKEN is shared by every service, it protects routes called by other services
+	internalToken := os.Getenv("INTERNAL_API_TOKEN")
+	if revocationUrl, ok := os.LookupEnv("AUTH_REVOCATION_URL"); ok {
+		ja.WithRevocationList(jwtauth.NewHTTPRevocationList(revocationUrl, internalToken, 30*time.Second))
+	}
+
+	paymentUrl, ok := os.LookupEnv("PAYMENT_SERVICE_URL")
+	if !ok {
+		log.Fatalln("No PAYMENT_SERVICE_URL variable")
+	}
+
+	go campaign.NewOutboxRelay(pool, campaign.NewPaymentService(paymentUrl, internalToken), 5*time.Second).Run(context.Background())
+	go campaign.NewDeadlineScheduler(pool, time.Minute).Run(context.Background())
 
-	r.Mount(`/`, campaign.NewController(pool, ja))
+	api := campaign.NewController(pool, ja, internalToken)
+	r.Mount(`/`, api)
 
 	if err := http.ListenAndServe(":8181", r); err != nil {
 		log.Fatal(err)
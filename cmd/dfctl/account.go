@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// accountView is account without password hash
+type accountView struct {
+	Id          string       `json:"id"`
+	Username    string       `json:"username"`
+	Email       string       `json:"email"`
+	FirstName   string       `json:"first_name"`
+	LastName    string       `json:"last_name"`
+	Role        jwtauth.Role `json:"role"`
+	SuspendedAt *time.Time   `json:"suspended_at"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// accountCreate signs up through auth api, so the account is validated and stored the same way as by users
+func accountCreate(ctx context.Context, a *app, args []string) error {
+	var req client.SignUpRequest
+
+	fs := flag.NewFlagSet("account create", flag.ContinueOnError)
+	fs.StringVar(&req.Email, "email", "", "")
+	fs.StringVar(&req.Username, "username", "", "")
+	fs.StringVar(&req.FirstName, "first-name", "", "")
+	fs.StringVar(&req.LastName, "last-name", "", "")
+	fs.StringVar(&req.Password, "password", "", "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if _, err := a.client().SignUp(ctx, &req); err != nil {
+		return err
+	}
+
+	pool, err := a.db(ctx, "auth")
+	if err != nil {
+		return err
+	}
+	account, err := auth.NewAccountModel(pool).GetByUsername(ctx, req.Username)
+	if err != nil {
+		return err
+	}
+	return printAccount(a, account)
+}
+
+func accountGet(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	pool, err := a.db(ctx, "auth")
+	if err != nil {
+		return err
+	}
+
+	account, err := findAccount(ctx, auth.NewAccountModel(pool), args[0])
+	if err != nil {
+		return err
+	}
+	return printAccount(a, account)
+}
+
+// accountRole changes role of the account, it's the way to make the first admin
+func accountRole(ctx context.Context, a *app, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	role := jwtauth.Role(args[1])
+	if !role.Valid() {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+
+	pool, err := a.db(ctx, "auth")
+	if err != nil {
+		return err
+	}
+	accounts := auth.NewAccountModel(pool)
+
+	account, err := findAccount(ctx, accounts, args[0])
+	if err != nil {
+		return err
+	}
+
+	entry := audit.Operator(auth.AuditAccountRole, auth.AuditTargetAccount, account.Id)
+	details := struct {
+		From jwtauth.Role `json:"from"`
+		To   jwtauth.Role `json:"to"`
+	}{account.Role, role}
+
+	err = db.WithTx(ctx, pool, func(ctx context.Context) error {
+		if account, err = accounts.SetRole(ctx, account.Id, role); err != nil {
+			return err
+		}
+		return audit.Record(ctx, db.Conn(ctx, pool), entry, &details)
+	})
+	if err != nil {
+		return err
+	}
+	return printAccount(a, account)
+}
+
+// accountDisableTwoFactor lets account that lost both authenticator and recovery codes sign in with password again
+func accountDisableTwoFactor(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	pool, err := a.db(ctx, "auth")
+	if err != nil {
+		return err
+	}
+	totp := auth.NewTotpModel(pool)
+
+	account, err := findAccount(ctx, auth.NewAccountModel(pool), args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := totp.Get(ctx, account.Id); errors.Is(err, pgx.ErrNoRows) {
+		return errors.New("two-factor authentication is not enabled")
+	} else if err != nil {
+		return err
+	}
+
+	err = db.WithTx(ctx, pool, func(ctx context.Context) error {
+		if err := totp.Delete(ctx, account.Id); err != nil {
+			return err
+		}
+		return audit.Record(ctx, db.Conn(ctx, pool), audit.Operator(auth.AuditTwoFactorDisable, auth.AuditTargetAccount, account.Id), nil)
+	})
+	if err != nil {
+		return err
+	}
+	return printAccount(a, account)
+}
+
+// findAccount looks account up by id, username or email
+func findAccount(ctx context.Context, accounts auth.AccountModel, key string) (*auth.Account, error) {
+	var (
+		account *auth.Account
+		err     error
+	)
+	if uuidPattern.MatchString(key) {
+		account, err = accounts.GetByUUID(ctx, key)
+	} else {
+		account, err = accounts.FindByUsernameOrEmail(ctx, key)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("account not found")
+	}
+	return account, err
+}
+
+func printAccount(a *app, account *auth.Account) error {
+	v := accountView{
+		account.Id,
+		account.Username,
+		account.Email,
+		account.FirstName,
+		account.LastName,
+		account.Role,
+		account.SuspendedAt,
+		account.CreatedAt,
+		account.UpdatedAt,
+	}
+
+	return a.out.print(&v,
+		[]string{"ID", "USERNAME", "EMAIL", "NAME", "ROLE", "SUSPENDED AT", "CREATED AT"},
+		[][]string{{v.Id, v.Username, v.Email, v.FirstName + " " + v.LastName, string(v.Role), formatTime(v.SuspendedAt), formatTime(&v.CreatedAt)}},
+	)
+}
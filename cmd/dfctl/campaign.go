@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+)
+
+func campaignList(ctx context.Context, a *app, args []string) error {
+	var (
+		filter   campaign.CampaignFilter
+		status   string
+		creator  string
+		archived string
+		limit    int
+	)
+
+	fs := flag.NewFlagSet("campaign list", flag.ContinueOnError)
+	fs.StringVar(&status, "status", "", "campaign status, any besides draft if empty")
+	fs.StringVar(&creator, "creator", "", "creator account id")
+	fs.StringVar(&archived, "archived", "", "true or false")
+	fs.IntVar(&limit, "limit", 50, "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if status != "" {
+		s, err := campaign.ParseCampaignStatus(status)
+		if err != nil {
+			return err
+		}
+		filter.Status = &s
+	}
+	if creator != "" {
+		filter.CreatorId = &creator
+	}
+	if archived != "" {
+		b, err := strconv.ParseBool(archived)
+		if err != nil {
+			return err
+		}
+		filter.Archived = &b
+	}
+
+	db, err := a.db(ctx, "campaign")
+	if err != nil {
+		return err
+	}
+	campaigns, err := campaign.NewCampaignModel(db).List(ctx, &filter, campaign.SortNewest, nil, limit)
+	if err != nil {
+		return err
+	}
+
+	res := make([]campaign.GetCampaignResponse, 0, len(campaigns))
+	rows := make([][]string, 0, len(campaigns))
+	for _, c := range campaigns {
+		res = append(res, campaignResponse(&c))
+		rows = append(rows, campaignRow(&c))
+	}
+	return a.out.print(res, campaignHeader, rows)
+}
+
+func campaignGet(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	db, err := a.db(ctx, "campaign")
+	if err != nil {
+		return err
+	}
+	c, err := campaign.NewCampaignModel(db).GetById(ctx, args[0])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.New("campaign not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	res := campaignResponse(c)
+	return a.out.print(&res, campaignHeader, [][]string{campaignRow(c)})
+}
+
+// campaignArchive closes and archives campaign, payment service then refunds its donations
+func campaignArchive(ctx context.Context, a *app, args []string) error {
+	var actor string
+
+	fs := flag.NewFlagSet("campaign archive", flag.ContinueOnError)
+	fs.StringVar(&actor, "actor", "", "account id recorded as the actor, campaign creator if empty")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	pool, err := a.db(ctx, "campaign")
+	if err != nil {
+		return err
+	}
+	campaigns := campaign.NewCampaignModel(pool)
+
+	c, err := campaigns.GetById(ctx, args[0])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.New("campaign not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Campaign is archived only when it's closed by someone, so the creator is the actor by default
+	if actor == "" {
+		actor = c.CreatorId
+	}
+	entry := audit.Operator(campaign.AuditCampaignArchive, campaign.AuditTargetCampaign, strconv.Itoa(c.Id))
+	details := struct {
+		CreatorId string                  `json:"creator_id"`
+		From      campaign.CampaignStatus `json:"from"`
+	}{c.CreatorId, c.Status}
+
+	err = db.WithTx(ctx, pool, func(ctx context.Context) error {
+		if c, err = campaigns.Transition(ctx, c.Id, campaign.StatusClosed, &actor, campaign.TransitionReasonArchived); err != nil {
+			return err
+		}
+		return audit.Record(ctx, db.Conn(ctx, pool), entry, &details)
+	})
+	if err != nil {
+		return err
+	}
+
+	res := campaignResponse(c)
+	return a.out.print(&res, campaignHeader, [][]string{campaignRow(c)})
+}
+
+var campaignHeader = []string{"ID", "NAME", "CREATOR", "STATUS", "ARCHIVED", "GOAL", "CURRENT", "DEADLINE"}
+
+func campaignRow(c *campaign.Campaign) []string {
+	return []string{
+		strconv.Itoa(c.Id),
+		c.Name,
+		c.CreatorId,
+		string(c.Status),
+		strconv.FormatBool(c.Archived),
+		c.Goal.String(),
+		c.CurrentAmount.String(),
+		formatTime(&c.Deadline),
+	}
+}
+
+func campaignResponse(c *campaign.Campaign) campaign.GetCampaignResponse {
+	return campaign.GetCampaignResponse{
+		Id:            c.Id,
+		CreatorId:     c.CreatorId,
+		Name:          c.Name,
+		Description:   c.Description,
+		Goal:          c.Goal,
+		CurrentAmount: c.CurrentAmount,
+		Deadline:      c.Deadline,
+		AllOrNothing:  c.AllOrNothing,
+		Status:        c.Status,
+		Outcome:       c.Outcome,
+		Archived:      c.Archived,
+		CreatedAt:     c.CreatedAt,
+		UpdatedAt:     c.UpdatedAt,
+	}
+}
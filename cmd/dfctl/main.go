@@ -0,0 +1,160 @@
+// dfctl is operator tool working with the services through their apis and databases
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+)
+
+const usage = `usage: dfctl [-config file] [-profile name] [-o table|json] <command> [args]
+
+commands:
+  account create -email <email> -username <name> -first-name <name> [-last-name <name>] -password <password>
+  account get <id | username | email>
+  account role <id | username | email> <user | moderator | admin>
+  account disable-2fa <id | username | email>
+  campaign list [-status <status>] [-creator <account id>] [-archived true|false] [-limit n]
+  campaign get <id>
+  campaign archive [-actor <account id>] <id>
+  payment stuck [-older-than 1h] [-limit n]
+  payment replay <payment id>...
+  refund status <campaign id>
+  refund trigger [-reason archived|goal_not_reached] <campaign id>
+  migrate <auth | campaign | payment> up | down | status | to <version>
+`
+
+var errUsage = errors.New(strings.TrimSpace(usage))
+
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"account create":      accountCreate,
+	"account get":         accountGet,
+	"account role":        accountRole,
+	"account disable-2fa": accountDisableTwoFactor,
+	"campaign list":       campaignList,
+	"campaign get":        campaignGet,
+	"campaign archive":    campaignArchive,
+	"payment stuck":       paymentStuck,
+	"payment replay":      paymentReplay,
+	"refund status":       refundStatus,
+	"refund trigger":      refundTrigger,
+	"migrate":             migrateCommand,
+}
+
+type app struct {
+	profile *Profile
+	out     *printer
+	pools   map[string]*pgxpool.Pool
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dfctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	configPath := fs.String("config", defaultConfigPath(), "profile file")
+	profileName := fs.String("profile", os.Getenv("DFCTL_PROFILE"), "profile name, default profile of the file if empty")
+	format := fs.String("o", outputTable, "output format, table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != outputTable && *format != outputJson {
+		return fmt.Errorf("unknown output format: %s", *format)
+	}
+
+	cmd, args := findCommand(fs.Args())
+	if cmd == nil {
+		return errUsage
+	}
+
+	profile, err := loadProfile(*configPath, *profileName)
+	if err != nil {
+		return err
+	}
+
+	a := &app{profile, &printer{os.Stdout, *format}, map[string]*pgxpool.Pool{}}
+	defer a.close()
+
+	return cmd(ctx, a, args)
+}
+
+// findCommand matches the longest command name, e.g. "account get" before "account"
+func findCommand(args []string) (command, []string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+
+	for _, name := range names {
+		words := strings.Fields(name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == name {
+			return commands[name], args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+// db returns pool of the service database, pools are opened on first use
+func (a *app) db(ctx context.Context, service string) (*pgxpool.Pool, error) {
+	if pool, ok := a.pools[service]; ok {
+		return pool, nil
+	}
+
+	dsn := map[string]string{
+		"auth":     a.profile.AuthDb,
+		"campaign": a.profile.CampaignDb,
+		"payment":  a.profile.PaymentDb,
+	}[service]
+	if dsn == "" {
+		return nil, fmt.Errorf("profile has no %s database", service)
+	}
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s database: %w", service, err)
+	}
+	a.pools[service] = pool
+	return pool, nil
+}
+
+func (a *app) client() *client.Client {
+	return client.New(a.profile.AuthUrl, a.profile.CampaignUrl, a.profile.PaymentUrl)
+}
+
+func (a *app) close() {
+	for _, pool := range a.pools {
+		pool.Close()
+	}
+}
+
+// parseFlags parses flags of a command, flags may follow positional arguments
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
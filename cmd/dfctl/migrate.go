@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/internal/payment"
+	"github.com/robloxxa/DistrictFunding/pkg/migrate"
+)
+
+var migrations = map[string]func() ([]migrate.Migration, error){
+	"auth":     auth.Migrations,
+	"campaign": campaign.Migrations,
+	"payment":  payment.Migrations,
+}
+
+// migrateCommand runs the same migrate subcommand as service binaries against the service database
+func migrateCommand(ctx context.Context, a *app, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+
+	load, ok := migrations[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown service: %s", args[0])
+	}
+	ms, err := load()
+	if err != nil {
+		return err
+	}
+
+	db, err := a.db(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return migrate.Command(ctx, migrate.New(db, ms), args[1:], os.Stdout)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// print writes v as indented json, or rows under header as a table
+func (p *printer) print(v any, header []string, rows [][]string) error {
+	if p.format == outputJson {
+		e := json.NewEncoder(p.w)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatString(s *string) string {
+	if s == nil {
+		return "-"
+	}
+	return *s
+}
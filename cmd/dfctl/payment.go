@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robloxxa/DistrictFunding/internal/payment"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+type paymentView struct {
+	PaymentId  string      `json:"payment_id"`
+	UserId     string      `json:"user_id"`
+	CampaignId int         `json:"campaign_id"`
+	Amount     money.Money `json:"amount"`
+	Status     string      `json:"status"`
+	ReturnedAt *time.Time  `json:"returned_at,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// paymentStuck lists payments that are still not final, e.g. because provider notification was lost
+func paymentStuck(ctx context.Context, a *app, args []string) error {
+	var (
+		olderThan time.Duration
+		limit     int
+	)
+
+	fs := flag.NewFlagSet("payment stuck", flag.ContinueOnError)
+	fs.DurationVar(&olderThan, "older-than", time.Hour, "")
+	fs.IntVar(&limit, "limit", 50, "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	db, err := a.db(ctx, "payment")
+	if err != nil {
+		return err
+	}
+	payments, err := payment.NewPaymentModel(db).ListStuck(ctx, time.Now().Add(-olderThan), limit)
+	if err != nil {
+		return err
+	}
+
+	res := make([]paymentView, 0, len(payments))
+	rows := make([][]string, 0, len(payments))
+	for _, p := range payments {
+		res = append(res, paymentView{p.PaymentId, p.UserId, p.CampaignId, p.Amount, p.Status, p.ReturnedAt, p.CreatedAt, p.UpdatedAt})
+		rows = append(rows, []string{p.PaymentId, strconv.Itoa(p.CampaignId), p.UserId, p.Amount.String(), p.Status, formatTime(&p.CreatedAt)})
+	}
+	return a.out.print(res, []string{"PAYMENT ID", "CAMPAIGN", "USER", "AMOUNT", "STATUS", "CREATED AT"}, rows)
+}
+
+// paymentReplay sends notification of the payment to payment service webhook, service then fetches
+// actual payment status from the provider, so replaying a payment is always safe
+func paymentReplay(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	webhookUrl, err := url.JoinPath(a.profile.PaymentUrl, "webhook")
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(args))
+	res := make(map[string]string, len(args))
+	for _, id := range args {
+		result := "replayed"
+		if err := replay(ctx, webhookUrl, id); err != nil {
+			result = err.Error()
+		}
+		res[id] = result
+		rows = append(rows, []string{id, result})
+	}
+	return a.out.print(res, []string{"PAYMENT ID", "RESULT"}, rows)
+}
+
+func replay(ctx context.Context, webhookUrl string, paymentId string) error {
+	b, err := json.Marshal(&payment.Notification{
+		Type:   "notification",
+		Event:  "payment.replay",
+		Object: payment.Payment{ID: paymentId},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookUrl, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment service responded with %s", res.Status)
+	}
+	return nil
+}
+
+type refundView struct {
+	CampaignId    int        `json:"campaign_id"`
+	Reason        string     `json:"reason"`
+	Status        string     `json:"status"`
+	TotalCount    int        `json:"total_payments"`
+	RefundedCount int        `json:"refunded_payments"`
+	FailedCount   int        `json:"failed_payments"`
+	Attempts      int        `json:"attempts"`
+	LastError     *string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+}
+
+func refundStatus(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	campaignId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid campaign id: %s", args[0])
+	}
+
+	db, err := a.db(ctx, "payment")
+	if err != nil {
+		return err
+	}
+	return printRefund(ctx, a, payment.NewRefundJobModel(db), campaignId)
+}
+
+// refundTrigger queues refund of campaign donations, failed or completed refund is run again
+func refundTrigger(ctx context.Context, a *app, args []string) error {
+	var reason string
+
+	fs := flag.NewFlagSet("refund trigger", flag.ContinueOnError)
+	fs.StringVar(&reason, "reason", payment.RefundReasonArchived, "archived or goal_not_reached")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+	if reason != payment.RefundReasonArchived && reason != payment.RefundReasonGoalNotReached {
+		return fmt.Errorf("unknown refund reason: %s", reason)
+	}
+	campaignId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid campaign id: %s", args[0])
+	}
+
+	db, err := a.db(ctx, "payment")
+	if err != nil {
+		return err
+	}
+	jobs := payment.NewRefundJobModel(db)
+
+	job, err := jobs.Create(ctx, campaignId, reason, time.Now())
+	if err != nil {
+		return err
+	}
+	if job.Status != payment.RefundJobPending {
+		if _, err := jobs.Requeue(ctx, campaignId); err != nil {
+			return err
+		}
+	}
+
+	return printRefund(ctx, a, jobs, campaignId)
+}
+
+func printRefund(ctx context.Context, a *app, jobs payment.RefundJobModel, campaignId int) error {
+	p, err := jobs.GetProgress(ctx, campaignId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.New("campaign donations are not being refunded")
+	}
+	if err != nil {
+		return err
+	}
+
+	v := refundView{p.CampaignId, p.Reason, p.Status, p.TotalCount, p.RefundedCount, p.FailedCount, p.Attempts, p.LastError, p.NextAttemptAt, p.CompletedAt}
+	return a.out.print(&v,
+		[]string{"CAMPAIGN", "REASON", "STATUS", "REFUNDED", "FAILED", "ATTEMPTS", "LAST ERROR"},
+		[][]string{{
+			strconv.Itoa(v.CampaignId),
+			v.Reason,
+			v.Status,
+			fmt.Sprintf("%d/%d", v.RefundedCount, v.TotalCount),
+			strconv.Itoa(v.FailedCount),
+			strconv.Itoa(v.Attempts),
+			formatString(v.LastError),
+		}},
+	)
+}
@@ -10,9 +10,11 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/robloxxa/DistrictFunding/internal/payment"
 	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/migrate"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -43,6 +45,25 @@ func main() {
 	}
 	conn.Release()
 
+	migrations, err := payment.Migrations()
+	if err != nil {
+		log.Fatalln(fmt.Errorf("unable to load migrations: %w", err))
+	}
+	migrator := migrate.New(pool, migrations)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if os.Getenv("DB_AUTO_MIGRATE") != "false" {
+		n, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Fatalln(fmt.Errorf("unable to migrate database: %w", err))
+		}
+		log.Printf("Applied %d migrations\n", n)
+	}
+
 	// Initialize JWT auth
 
 	log.Println("Connected to Database")
@@ -55,9 +76,61 @@ func main() {
 	r.Use(middleware.Timeout(60 * time.Second))
 	r.Use(render.SetContentType(render.ContentTypeJSON))
 
-	ja := jwtauth.New("HS256", []byte(os.Getenv("JWT_SECRET")))
+	jwksUrl, ok := os.LookupEnv("JWKS_URL")
+	if !ok {
+		log.Fatalln("No JWKS_URL variable")
+	}
+	keys, err := jwtauth.NewRemoteKeySet(context.Background(), jwksUrl, 5*time.Minute)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("unable to fetch jwks: %w", err))
+	}
+	ja := jwtauth.NewWithKeySource(keys)
+	// INTERNAL_API_TOKEN is shared by every service, it protects routes called by other services
+	internalToken := os.Getenv("INTERNAL_API_TOKEN")
+	if revocationUrl, ok := os.LookupEnv("AUTH_REVOCATION_URL"); ok {
+		ja.WithRevocationList(jwtauth.NewHTTPRevocationList(revocationUrl, internalToken, 30*time.Second))
+	}
+
+	var provider payment.PaymentProvider
+	switch os.Getenv("PAYMENT_PROVIDER") {
+	case "fake":
+		log.Println("Using fake payment provider")
+		provider = payment.NewFakeProvider(os.Getenv("FAKE_PROVIDER_WEBHOOK_URL"))
+	default:
+		shopId, err := strconv.Atoi(os.Getenv("YOOKASSA_SHOP_ID"))
+		if err != nil {
+			log.Fatalln("Invalid YOOKASSA_SHOP_ID variable")
+		}
+		// YOOKASSA_URL is empty in docker compose unless fake yookassa is used
+		yookassaUrl := os.Getenv("YOOKASSA_URL")
+		if yookassaUrl == "" {
+			yookassaUrl = payment.DefaultYookassaUrl
+		}
+		provider = payment.NewYookassa(yookassaUrl, shopId, os.Getenv("YOOKASSA_SECRET_KEY"))
+	}
+
+	campaignUrl, ok := os.LookupEnv("CAMPAIGN_SERVICE_URL")
+	if !ok {
+		log.Fatalln("No CAMPAIGN_SERVICE_URL variable")
+	}
+
+	campaigns := payment.NewCampaignService(campaignUrl, internalToken)
+
+	go payment.NewOutboxRelay(pool, campaigns, 5*time.Second).Run(context.Background())
+	go payment.NewRefunder(pool, provider, 30*time.Second).Run(context.Background())
+	go payment.NewPayoutSyncer(pool, provider, time.Minute).Run(context.Background())
+
+	var payoutFeeBps int64
+	if v, ok := os.LookupEnv("PAYOUT_FEE_BPS"); ok {
+		payoutFeeBps, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || payoutFeeBps < 0 || payoutFeeBps > 10000 {
+			log.Fatalln("Invalid PAYOUT_FEE_BPS variable")
+		}
+	}
+
+	api := payment.NewController(pool, ja, provider, campaigns, internalToken).WithPayoutFee(payoutFeeBps)
+	r.Mount("/", api)
 
-	r.Mount("/", payment.NewController(pool, ja))
 	if err := http.ListenAndServe(":8181", r); err != nil {
 		log.Fatal(err)
 	}
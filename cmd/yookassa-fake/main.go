@@ -0,0 +1,27 @@
+// Command yookassa-fake serves fake yookassa api for running payment service locally without yookassa credentials,
+// payment service is pointed to it with YOOKASSA_URL
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/joho/godotenv"
+	"github.com/robloxxa/DistrictFunding/internal/payment"
+	"github.com/robloxxa/DistrictFunding/internal/payment/yookassatest"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("Error loading .env file")
+	}
+
+	// Every payment and payout succeeds right away, notifications are sent to FAKE_PROVIDER_WEBHOOK_URL
+	fake := payment.NewFakeProvider(os.Getenv("FAKE_PROVIDER_WEBHOOK_URL"))
+
+	if err := http.ListenAndServe(":8080", middleware.Logger(yookassatest.NewHandler(fake))); err != nil {
+		log.Fatal(err)
+	}
+}
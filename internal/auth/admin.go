@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
+)
+
+// Audit log actions of auth admin api
+const (
+	AuditAccountSuspend   = "account.suspend"
+	AuditAccountUnsuspend = "account.unsuspend"
+	AuditAccountRole      = "account.role"
+
+	AuditTargetAccount = "account"
+)
+
+// SuspendAccount suspends the account and revokes its refresh tokens, access tokens issued before
+// stay valid until they expire
+func (a *Controller) SuspendAccount(w http.ResponseWriter, r *http.Request) {
+	a.setSuspended(w, r, true)
+}
+
+func (a *Controller) UnsuspendAccount(w http.ResponseWriter, r *http.Request) {
+	a.setSuspended(w, r, false)
+}
+
+func (a *Controller) setSuspended(w http.ResponseWriter, r *http.Request, suspended bool) {
+	var req SuspendAccountRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	target, err := a.staffTarget(r)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	entry := audit.New(r, AuditAccountUnsuspend, AuditTargetAccount, target.Id)
+	if suspended {
+		entry.Action = AuditAccountSuspend
+	}
+
+	var account *Account
+	err = db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		var err error
+		if account, err = a.account.SetSuspended(ctx, target.Id, suspended); err != nil {
+			return err
+		}
+		if suspended {
+			if err := a.refreshToken.RevokeAllByAccountId(ctx, target.Id); err != nil {
+				return err
+			}
+		}
+		return audit.Record(ctx, db.Conn(ctx, a.db), entry, &req)
+	})
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Json(w, newAccountResponse(account))
+}
+
+// SetAccountRole changes role of the account, new role is put into access tokens on the next refresh
+func (a *Controller) SetAccountRole(w http.ResponseWriter, r *http.Request) {
+	var req SetAccountRoleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	target, err := a.staffTarget(r)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	var account *Account
+	err = db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		var err error
+		if account, err = a.account.SetRole(ctx, target.Id, req.Role); err != nil {
+			return err
+		}
+		details := struct {
+			From jwtauth.Role `json:"from"`
+			To   jwtauth.Role `json:"to"`
+		}{target.Role, req.Role}
+		return audit.Record(ctx, db.Conn(ctx, a.db), audit.New(r, AuditAccountRole, AuditTargetAccount, target.Id), &details)
+	})
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Json(w, newAccountResponse(account))
+}
+
+// staffTarget returns account of accountId path parameter if staff member of the request may act on it.
+// Nobody acts on their own account and only admins act on accounts of other staff
+func (a *Controller) staffTarget(r *http.Request) (*Account, error) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return nil, response.NewProblem(http.StatusUnauthorized, response.CodeUnauthorized, err.Error())
+	}
+
+	id := chi.URLParam(r, "accountId")
+	if err := validate.Var(id, "uuid"); err != nil {
+		return nil, ErrAccountNotFound
+	}
+
+	target, err := a.account.GetByUUID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+
+	if target.Id == token.Subject() {
+		return nil, ErrOwnAccount
+	}
+	if target.Role != jwtauth.RoleUser && jwtauth.RoleFromToken(token) != jwtauth.RoleAdmin {
+		return nil, jwtauth.ErrPermissionDenied.WithDetail("only admins act on staff accounts")
+	}
+	return target, nil
+}
+
+func newAccountResponse(a *Account) *AccountResponse {
+	return &AccountResponse{
+		Id:              a.Id,
+		Email:           a.Email,
+		Username:        a.Username,
+		FirstName:       a.FirstName,
+		LastName:        a.LastName,
+		Role:            a.Role,
+		SuspendedAt:     a.SuspendedAt,
+		EmailVerifiedAt: a.EmailVerifiedAt,
+		CreatedAt:       a.CreatedAt,
+		UpdatedAt:       a.UpdatedAt,
+	}
+}
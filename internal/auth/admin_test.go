@@ -0,0 +1,100 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+)
+
+// staff signs up username with the role, returns client signed in after the role is given and account id
+func (a *authTest) staff(t *testing.T, username string, role jwtauth.Role) (*client.Client, string) {
+	t.Helper()
+
+	ctx := context.Background()
+	c := a.signUp(t, username)
+	me, err := c.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != jwtauth.RoleUser {
+		if _, err := auth.NewAccountModel(a.pool).SetRole(ctx, me.Id, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Role is put into tokens issued after it's given
+	if _, err := c.SignIn(ctx, &client.SignInRequest{UsernameOrEmail: username, Password: password}); err != nil {
+		t.Fatal(err)
+	}
+	return c, me.Id
+}
+
+// admin calls admin api of the account as c, returns response status
+func (a *authTest) admin(t *testing.T, c *client.Client, method, accountId, action string, body any) int {
+	t.Helper()
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(method, a.url+"/admin/accounts/"+accountId+"/"+action, bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Tokens().AccessToken)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func (a *authTest) role(t *testing.T, accountId string) jwtauth.Role {
+	t.Helper()
+
+	account, err := auth.NewAccountModel(a.pool).GetByUUID(context.Background(), accountId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account.Role
+}
+
+func TestModeratorCannotGrantRoles(t *testing.T) {
+	a := newAuthTest(t)
+	moderator, _ := a.staff(t, "moderator", jwtauth.RoleModerator)
+	admin, _ := a.staff(t, "admin", jwtauth.RoleAdmin)
+	_, userId := a.staff(t, "alice", jwtauth.RoleUser)
+	_, otherModeratorId := a.staff(t, "bob", jwtauth.RoleModerator)
+
+	tests := []struct {
+		name   string
+		client *client.Client
+		method string
+		target string
+		action string
+		body   any
+		status int
+	}{
+		{"moderator grants admin", moderator, http.MethodPut, userId, "role", &auth.SetAccountRoleRequest{Role: jwtauth.RoleAdmin}, http.StatusForbidden},
+		{"moderator suspends user", moderator, http.MethodPost, userId, "suspend", &auth.SuspendAccountRequest{}, http.StatusOK},
+		{"moderator suspends moderator", moderator, http.MethodPost, otherModeratorId, "suspend", &auth.SuspendAccountRequest{}, http.StatusForbidden},
+		{"admin grants moderator", admin, http.MethodPut, userId, "role", &auth.SetAccountRoleRequest{Role: jwtauth.RoleModerator}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := a.admin(t, tt.client, tt.method, tt.target, tt.action, tt.body); status != tt.status {
+				t.Fatalf("responded with %d, want %d", status, tt.status)
+			}
+		})
+	}
+
+	if r := a.role(t, userId); r != jwtauth.RoleModerator {
+		t.Fatalf("role is %s, want %s given by admin", r, jwtauth.RoleModerator)
+	}
+}
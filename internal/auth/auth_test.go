@@ -0,0 +1,59 @@
+package auth_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/db/dbtest"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/mail"
+)
+
+const password = "correct horse"
+
+// authTest is auth service keeping sent mail in memory
+type authTest struct {
+	pool *pgxpool.Pool
+	mail *mail.Memory
+	url  string
+}
+
+func newAuthTest(t *testing.T) *authTest {
+	pool := dbtest.New(t, auth.Migrations)
+	m := mail.NewMemory()
+
+	srv := httptest.NewServer(auth.NewController(pool, jwtauth.New(jwa.HS256, []byte("secret")), nil, m, "http://app.test", nil, "token"))
+	t.Cleanup(srv.Close)
+
+	return &authTest{pool, m, srv.URL}
+}
+
+func (a *authTest) client() *client.Client {
+	return client.New(a.url, "", "")
+}
+
+// signUp creates account username with username@example.com email, returns client signed in as it
+func (a *authTest) signUp(t *testing.T, username string) *client.Client {
+	t.Helper()
+
+	c := a.client()
+	_, err := c.SignUp(context.Background(), &client.SignUpRequest{
+		Email:     email(username),
+		Username:  username,
+		FirstName: username,
+		Password:  password,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func email(username string) string {
+	return username + "@example.com"
+}
@@ -1,95 +1,224 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/jackc/pgx/v5"
 	"github.com/lestrrat-go/jwx/v2/jwt"
+	"io"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-playground/validator/v10"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/internalapi"
 	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/mail"
+	"github.com/robloxxa/DistrictFunding/pkg/oidc"
+	"github.com/robloxxa/DistrictFunding/pkg/openapi"
 	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
 type Controller struct {
-	router  *chi.Mux
-	jwt     *jwtauth.JWTAuth
-	account AccountModel
+	router       *chi.Mux
+	db           *pgxpool.Pool
+	jwt          *jwtauth.JWTAuth
+	keys         *jwtauth.KeySet
+	account      AccountModel
+	refreshToken RefreshTokenModel
+	revokedToken RevokedTokenModel
+	accountToken AccountTokenModel
+	totp         TotpModel
+	throttle     LoginThrottleModel
+	identity     IdentityModel
+	oauthState   OAuthStateModel
+	export       DataExportModel
+	mailer       mail.Mailer
+	// appUrl is where links of emails lead, e.g. {appUrl}/verify-email?token=...
+	appUrl string
+	// providers are OIDC providers accounts sign in with, by name
+	providers map[string]*oidc.Provider
 }
 
-func NewController(db *pgxpool.Pool, ja *jwtauth.JWTAuth) *Controller {
+// NewController creates auth api, emails are sent with mailer and their links lead to pages of appUrl.
+// Accounts can sign in with providers besides passwords, internalToken protects routes called by other services
+func NewController(db *pgxpool.Pool, ja *jwtauth.JWTAuth, keys *jwtauth.KeySet, mailer mail.Mailer, appUrl string, providers []*oidc.Provider, internalToken string) *Controller {
 	c := Controller{
-		router:  chi.NewRouter(),
-		account: &accountModel{db},
-		jwt:     ja,
+		router:       chi.NewRouter(),
+		db:           db,
+		keys:         keys,
+		account:      &accountModel{db},
+		refreshToken: &refreshTokenModel{db},
+		revokedToken: &revokedTokenModel{db},
+		accountToken: &accountTokenModel{db},
+		totp:         &totpModel{db},
+		throttle:     &loginThrottleModel{db},
+		identity:     &identityModel{db},
+		oauthState:   &oauthStateModel{db},
+		export:       &dataExportModel{db},
+		mailer:       mailer,
+		appUrl:       strings.TrimSuffix(appUrl, "/"),
+		providers:    make(map[string]*oidc.Provider, len(providers)),
+		jwt:          ja,
+	}
+	for _, p := range providers {
+		c.providers[p.Name()] = p
 	}
 
+	// Auth service checks revoked tokens directly in its database
+	ja.WithRevocationList(c.revokedToken)
+
 	c.router.Use(jwtauth.Verifier(ja))
 
 	c.router.Post("/signin", c.SignIn)
+	c.router.Post("/signin/2fa", c.SignInTwoFactor)
+	c.router.Get("/oauth/providers", c.ListOAuthProviders)
+	c.router.Post("/oauth/{provider}/start", c.StartOAuth)
+	c.router.Post("/oauth/{provider}/callback", c.OAuthCallback)
 	c.router.Post("/signup", c.SignUp)
+	c.router.Post("/refresh", c.Refresh)
+	c.router.Group(func(r chi.Router) {
+		r.Use(internalapi.RequireToken(internalToken))
+		r.Get("/revoked", c.Revoked)
+	})
+	c.router.Get("/.well-known/jwks.json", c.JWKS)
+	c.router.Post("/verify-email", c.VerifyEmail)
+	c.router.Post("/password/forgot", c.ForgotPassword)
+	c.router.Post("/password/reset", c.ResetPassword)
+	c.router.Post("/me/email/confirm", c.ConfirmEmailChange)
+	c.router.Get("/me/export/download", c.DownloadExport)
 	c.router.Group(func(r chi.Router) {
 		r.Use(jwtauth.Authenticator)
 		r.Post("/signout", c.SignOut)
-		r.Get("/me", c.Me)
+		r.Route("/me", func(r chi.Router) {
+			r.Get("/", c.Me)
+			r.Patch("/", c.UpdateMe)
+			r.Delete("/", c.DeleteMe)
+			r.Post("/password", c.ChangePassword)
+			r.Post("/email", c.ChangeEmail)
+			r.Post("/restore", c.RestoreMe)
+			r.Post("/export", c.RequestExport)
+			r.Get("/exports", c.ListExports)
+		})
+		r.Post("/verify-email/resend", c.ResendVerification)
+		r.Route("/2fa", func(r chi.Router) {
+			r.Post("/enroll", c.EnrollTwoFactor)
+			r.Post("/confirm", c.ConfirmTwoFactor)
+			r.Post("/disable", c.DisableTwoFactor)
+			r.Post("/step-up", c.StepUp)
+		})
+		r.Route("/identities", func(r chi.Router) {
+			r.Get("/", c.ListIdentities)
+			r.Post("/{provider}/start", c.StartLinkIdentity)
+			r.Post("/{provider}/callback", c.LinkIdentity)
+			r.Delete("/{provider}", c.UnlinkIdentity)
+		})
+	})
+	c.router.Route("/admin", func(r chi.Router) {
+		r.Use(jwtauth.Authenticator)
+		r.With(jwtauth.RequirePermission(jwtauth.PermissionReadAudit)).Get("/audit", audit.ListHandler(db))
+		r.Route("/lockouts", func(r chi.Router) {
+			r.Use(jwtauth.RequirePermission(jwtauth.PermissionManageLockouts))
+			r.Get("/", c.ListLockouts)
+			r.Delete("/{kind}/{key}", c.ClearLockout)
+		})
+		r.Route("/accounts/{accountId}", func(r chi.Router) {
+			r.With(jwtauth.RequirePermission(jwtauth.PermissionSuspendAccounts)).Post("/suspend", c.SuspendAccount)
+			r.With(jwtauth.RequirePermission(jwtauth.PermissionSuspendAccounts)).Post("/unsuspend", c.UnsuspendAccount)
+			r.With(jwtauth.RequirePermission(jwtauth.PermissionManageRoles)).Put("/role", c.SetAccountRole)
+		})
 	})
+	openapi.Serve(c.router, Spec())
 
 	return &c
 }
 
+// Routes returns routes of the api, openapi_test.go checks them against Spec
+func (a *Controller) Routes() chi.Routes {
+	return a.router
+}
+
 func (a *Controller) SignUp(w http.ResponseWriter, r *http.Request) {
 	var req SignUpRequest
 
 	token, err := jwtauth.FromContext(r.Context())
 	if token != nil {
-		response.Error(w, http.StatusBadRequest, errors.New("already authorized"))
+		response.WriteProblem(w, r, ErrAlreadyAuthorized)
 		return
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.Error(w, http.StatusBadRequest, errors.New("failed to parse json body"))
+		response.WriteProblem(w, r, response.ErrInvalidBody)
 		return
 	}
 
 	// Validate that request is correct
-	val := validator.New(validator.WithRequiredStructEnabled())
-	if err := val.Struct(req); err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if reservedUsername(req.Username) {
+		response.WriteProblem(w, r, ErrUsernameReserved)
 		return
 	}
 
 	// Query database to see if username is already taken
 	// TODO: maybe make a separate route for checking username/email?
-	if err := a.account.HasUsername(req.Username); err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+	if err := a.account.HasUsername(r.Context(), req.Username); err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	// Username is free, hashing password and storing user data in db
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	user := &Account{Username: req.Username, Email: req.Email, FirstName: req.FirstName, LastName: req.LastName, Password: string(hash)}
-	if err := a.account.Create(user); err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+	if err := a.account.Create(r.Context(), user); err != nil {
+		if isUniqueViolation(err) {
+			response.WriteProblem(w, r, ErrAccountExists)
+			return
+		}
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
-	tokenString, err := generateJWTFromUser(a.jwt, user)
+	// Create doesn't fill the id, so we need to fetch the user to issue a token for it
+	user, err = a.account.GetByUsername(r.Context(), user.Username)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
-	w.Header().Set("Authorization", "Bearer "+tokenString)
+	// Account is created anyway, verification email can be requested again
+	if err := a.sendToken(r.Context(), user, PurposeVerifyEmail); err != nil {
+		log.Printf("[%s] unable to send verification email: %v", middleware.GetReqID(r.Context()), err)
+	}
+	tokens, err := a.issueTokens(r.Context(), user, time.Time{})
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
 	w.WriteHeader(http.StatusCreated)
-	response.Message(w, "User is created successfully ")
+	response.Json(w, tokens)
 }
 
 func (a *Controller) SignIn(w http.ResponseWriter, r *http.Request) {
@@ -97,85 +226,336 @@ func (a *Controller) SignIn(w http.ResponseWriter, r *http.Request) {
 	_, err := jwtauth.FromContext(r.Context())
 	// TODO: see what errors could jwtauth throw in this context
 	if err == nil {
-		response.Error(w, http.StatusBadRequest, fmt.Errorf("already signed in"))
+		response.WriteProblem(w, r, ErrAlreadyAuthorized)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	user, err := a.account.FindByUsernameOrEmail(r.Context(), req.UsernameOrEmail)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if err != nil {
+		user = nil
+	}
+
+	// Unknown accounts go through the same lockouts and password check as existing ones,
+	// so responses and their timing don't tell whether account exists
+	login, ip := loginKey(user, req.UsernameOrEmail), throttleKey{ThrottleIP, clientIP(r)}
+	until, err := a.lockedUntil(r.Context(), login, ip)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if until != nil {
+		writeLocked(w, r, *until)
+		return
+	}
+
+	hash := dummyHash()
+	if user != nil {
+		hash = []byte(user.Password)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)); err != nil || user == nil {
+		if err := a.fail(r.Context(), login, ip); err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		response.WriteProblem(w, r, ErrInvalidCredentials)
+		return
+	}
+
+	a.completeSignIn(w, r, user)
+}
+
+// completeSignIn responds with tokens of the account whose password or identity is checked,
+// accounts with two-factor authentication get a challenge redeemed with the code at /signin/2fa.
+// Failed attempts of the account are forgotten only once it is signed in, not when the challenge is issued
+func (a *Controller) completeSignIn(w http.ResponseWriter, r *http.Request, user *Account) {
+	if user.SuspendedAt != nil {
+		response.WriteProblem(w, r, ErrAccountSuspended)
+		return
+	}
+
+	t, err := a.totp.Get(r.Context(), user.Id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if err == nil && t.EnabledAt != nil {
+		challenge, err := a.createChallenge(r.Context(), user)
+		if err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		response.Json(w, &SignInResponse{Challenge: challenge})
+		return
+	}
+
+	if err := a.throttle.Clear(r.Context(), ThrottleAccount, user.Id); err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	tokens, err := a.issueTokens(r.Context(), user, time.Time{})
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
+	w.Header().Add("Authorization", "Bearer "+tokens.AccessToken)
+	w.WriteHeader(http.StatusOK)
+	response.Json(w, &SignInResponse{TokenResponse: tokens})
+}
+
+// Refresh exchanges refresh token for a new pair of tokens. Every refresh token can be used only once,
+// presenting already used token is treated as a leak and revokes every refresh token of the account
+func (a *Controller) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+		response.WriteProblem(w, r, response.ErrInvalidBody)
 		return
 	}
 
-	user, err := a.account.FindByUsernameOrEmail(req.UsernameOrEmail)
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	rt, err := a.refreshToken.GetByHash(r.Context(), hashToken(req.RefreshToken))
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
-			response.Error(w, http.StatusBadRequest, fmt.Errorf("invalid username or password"))
+			response.WriteProblem(w, r, ErrInvalidRefreshToken)
 		default:
-			response.Error(w, http.StatusBadRequest, err)
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	if rt.RevokedAt != nil {
+		if err := a.refreshToken.RevokeAllByAccountId(r.Context(), rt.AccountId); err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
 		}
+		response.WriteProblem(w, r, ErrRefreshTokenUsed)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		response.Error(w, http.StatusBadRequest, errors.New("invalid username or password"))
+	if time.Now().After(rt.ExpiresAt) {
+		response.WriteProblem(w, r, ErrRefreshTokenExpired)
 		return
 	}
 
-	tokenString, err := generateJWTFromUser(a.jwt, user)
+	// Account is fetched on every refresh, so role changes and suspensions reach access tokens
+	user, err := a.account.GetByUUID(r.Context(), rt.AccountId)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrInvalidRefreshToken)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	if user.SuspendedAt != nil {
+		response.WriteProblem(w, r, ErrAccountSuspended)
 		return
 	}
 
-	w.Header().Add("Authorization", "Bearer "+tokenString)
-	w.WriteHeader(http.StatusOK)
+	if err := a.refreshToken.Revoke(r.Context(), rt.Id); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrRefreshTokenUsed)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	tokens, err := a.issueTokens(r.Context(), user, time.Time{})
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	response.Json(w, tokens)
 }
 
+// SignOut revokes current access token and refresh token from the body,
+// or every refresh token of the account if body is empty
 func (a *Controller) SignOut(w http.ResponseWriter, r *http.Request) {
-	// TODO: handle SignOut logic by either making blacklist in database or some other method like additional column for db or something
-	_, err := jwtauth.FromContext(r.Context())
+	var req SignOutRequest
+
+	token, err := jwtauth.FromContext(r.Context())
 	if err != nil {
-		response.Error(w, http.StatusUnauthorized, err)
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		err = a.refreshToken.RevokeAllByAccountId(r.Context(), token.Subject())
+	} else {
+		err = a.revokeRefreshToken(r.Context(), token.Subject(), req.RefreshToken)
+	}
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := a.revokedToken.Create(r.Context(), &RevokedToken{Jti: token.JwtID(), ExpiresAt: token.Expiration()}); err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	w.Header().Del("Authorization")
+	response.Message(w, "Signed out successfully")
 }
 
-func (a *Controller) Me(w http.ResponseWriter, r *http.Request) {
-	token, err := jwtauth.FromContext(r.Context())
+// Revoked lists revoked access tokens that are not expired yet, other services poll it with jwtauth.HTTPRevocationList
+func (a *Controller) Revoked(w http.ResponseWriter, r *http.Request) {
+	tokens, err := a.revokedToken.ListActive(r.Context())
 	if err != nil {
-		response.Error(w, http.StatusUnauthorized, err)
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	user, err := a.account.GetByUUID(token.Subject())
+	res := jwtauth.RevokedTokensResponse{Revoked: make([]jwtauth.RevokedToken, 0, len(tokens))}
+	for _, t := range tokens {
+		res.Revoked = append(res.Revoked, jwtauth.RevokedToken{Jti: t.Jti, ExpiresAt: t.ExpiresAt})
+	}
+
+	response.Json(w, &res)
+}
+
+func (a *Controller) Me(w http.ResponseWriter, r *http.Request) {
+	user, err := a.currentAccount(r)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	a.writeMe(w, r, user)
+}
+
+// writeMe responds with the account as MeRequest
+func (a *Controller) writeMe(w http.ResponseWriter, r *http.Request, user *Account) {
+	t, err := a.totp.Get(r.Context(), user.Id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	meReq := &MeRequest{
-		user.Id,
-		user.Username,
-		user.Email,
-		user.FirstName,
-		user.LastName,
+		Id:        user.Id,
+		Email:     user.Email,
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      user.Role,
+		// Email verification is checked by other services with the access token claim
+		EmailVerified:       user.EmailVerifiedAt != nil,
+		TwoFactorEnabled:    t != nil && t.EnabledAt != nil,
+		PendingEmail:        user.PendingEmail,
+		DeletionScheduledAt: user.DeletionScheduledAt,
 	}
 
 	response.Json(w, meReq)
 }
 
+// JWKS serves public keys that other services use to verify tokens
+func (a *Controller) JWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := a.keys.PublicSet()
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Json(w, set)
+}
+
 func (a *Controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.router.ServeHTTP(w, r)
 }
 
-func generateJWTFromUser(ja *jwtauth.JWTAuth, user *Account) (string, error) {
-	token, err := jwt.NewBuilder().
+// issueTokens generates short-lived access token and stores a new refresh token for the account,
+// mfaAt is time of second factor check put into access token unless it's zero
+func (a *Controller) issueTokens(ctx context.Context, user *Account, mfaAt time.Time) (*TokenResponse, error) {
+	accessToken, err := generateJWTFromUser(a.jwt, user, mfaAt)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	rt := &RefreshToken{
+		AccountId: user.Id,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+	if err := a.refreshToken.Create(ctx, rt); err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (a *Controller) revokeRefreshToken(ctx context.Context, accountId string, refreshToken string) error {
+	rt, err := a.refreshToken.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+
+	if rt.AccountId != accountId {
+		return ErrInvalidRefreshToken.WithDetail("refresh token belongs to other account")
+	}
+
+	if err := a.refreshToken.Revoke(ctx, rt.Id); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+func generateJWTFromUser(ja *jwtauth.JWTAuth, user *Account, mfaAt time.Time) (string, error) {
+	jti, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	b := jwt.NewBuilder()
+	if !mfaAt.IsZero() {
+		b = b.Claim(jwtauth.MFAClaim, mfaAt.Unix())
+	}
+	token, err := b.
+		JwtID(jti).
 		Subject(user.Id).
+		Claim(jwtauth.RoleClaim, string(user.Role)).
+		Claim(jwtauth.EmailVerifiedClaim, user.EmailVerifiedAt != nil).
 		IssuedAt(time.Now()).
-		Expiration(time.Now().Add(24 * time.Hour)).
+		Expiration(time.Now().Add(accessTokenTTL)).
 		Build()
 	if err != nil {
 		return "", err
@@ -184,3 +564,17 @@ func generateJWTFromUser(ja *jwtauth.JWTAuth, user *Account) (string, error) {
 
 	return string(tokenString), err
 }
+
+// randomToken returns 32 random bytes encoded in base64 url encoding
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
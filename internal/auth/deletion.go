@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DeletedUsernamePrefix starts usernames of anonymised accounts, new accounts can't take it
+	DeletedUsernamePrefix = "deleted-"
+	// deletionGracePeriod is how long deleted account can be restored before it's anonymised
+	deletionGracePeriod = 30 * 24 * time.Hour
+	// deletionCheckInterval is how often DeletionJob looks for accounts to anonymise
+	deletionCheckInterval = time.Hour
+	deletionBatch         = 100
+)
+
+// DeletionJob anonymises accounts whose deletion grace period is over. Account rows stay,
+// so campaigns and payments of other services keep referencing them
+type DeletionJob struct {
+	account AccountModel
+}
+
+func NewDeletionJob(db *pgxpool.Pool) *DeletionJob {
+	return &DeletionJob{account: &accountModel{db}}
+}
+
+// Run anonymises due accounts until ctx is done
+func (j *DeletionJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(deletionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.anonymise(ctx); err != nil {
+			log.Println(fmt.Errorf("unable to anonymise deleted accounts: %w", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// anonymise processes due accounts in batches until none is left
+func (j *DeletionJob) anonymise(ctx context.Context) error {
+	for {
+		ids, err := j.account.ListDueDeletion(ctx, deletionBatch)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := j.account.Anonymise(ctx, id); err != nil {
+				return fmt.Errorf("account %s: %w", id, err)
+			}
+			log.Printf("Anonymised deleted account %s\n", id)
+		}
+		if len(ids) < deletionBatch {
+			return nil
+		}
+	}
+}
+
+// reservedUsername reports whether username looks like one of anonymised account
+func reservedUsername(username string) bool {
+	return strings.HasPrefix(strings.ToLower(username), DeletedUsernamePrefix)
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/mail"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// emailTemplate is an email carrying a token, the link is page of the app that posts the token back to the api
+type emailTemplate struct {
+	ttl     time.Duration
+	path    string
+	subject string
+	// body is formatted with first name and the link
+	body string
+}
+
+var emailTemplates = map[TokenPurpose]emailTemplate{
+	PurposeVerifyEmail: {
+		ttl:     48 * time.Hour,
+		path:    "/verify-email",
+		subject: "Verify your email",
+		body: "Hello, %s!\n\nFollow the link to verify your email:\n%s\n\n" +
+			"The link expires in 48 hours.",
+	},
+	PurposeChangeEmail: {
+		ttl:     48 * time.Hour,
+		path:    "/confirm-email",
+		subject: "Confirm your new email",
+		body: "Hello, %s!\n\nFollow the link to use this email for your account:\n%s\n\n" +
+			"The link expires in 48 hours. Until then your account keeps its current email.",
+	},
+	PurposeResetPassword: {
+		ttl:     time.Hour,
+		path:    "/reset-password",
+		subject: "Reset your password",
+		body: "Hello, %s!\n\nFollow the link to set a new password:\n%s\n\n" +
+			"The link expires in 1 hour. If you didn't ask to reset password, ignore this email, your password stays the same.",
+	},
+}
+
+// VerifyEmail marks email of the token's account as verified. Access tokens carry verification,
+// so client has to refresh them afterwards
+func (a *Controller) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	err := db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		t, err := a.accountToken.Use(ctx, PurposeVerifyEmail, hashToken(req.Token))
+		if err != nil {
+			return err
+		}
+		_, err = a.account.MarkEmailVerified(ctx, t.AccountId)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrInvalidEmailToken)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	response.Message(w, "Email verified successfully")
+}
+
+// ResendVerification sends a new verification email, links of previous emails stop working
+func (a *Controller) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	user, err := a.account.GetByUUID(r.Context(), token.Subject())
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrAccountNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		response.WriteProblem(w, r, ErrEmailVerified)
+		return
+	}
+
+	if err := a.sendToken(r.Context(), user, PurposeVerifyEmail); err != nil {
+		response.Error(w, r, http.StatusBadGateway, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	response.Message(w, "Verification email is sent")
+}
+
+// ForgotPassword sends password reset email. Response is the same whether the email belongs to an account or not,
+// so the endpoint can't be used to find out registered emails
+func (a *Controller) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := a.account.FindByUsernameOrEmail(r.Context(), req.Email)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	default:
+		if err := a.sendToken(r.Context(), user, PurposeResetPassword); err != nil {
+			log.Printf("[%s] unable to send password reset email: %v", middleware.GetReqID(r.Context()), err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	response.Message(w, "If the email belongs to an account, password reset link is sent to it")
+}
+
+// ResetPassword sets a new password, clears sign in lockout and signs the account out everywhere.
+// Following the emailed link proves the email too, so it's marked as verified
+func (a *Controller) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		t, err := a.accountToken.Use(ctx, PurposeResetPassword, hashToken(req.Token))
+		if err != nil {
+			return err
+		}
+		if err := a.account.SetPassword(ctx, t.AccountId, string(hash)); err != nil {
+			return err
+		}
+		if err := a.accountToken.RevokeAll(ctx, t.AccountId, PurposeResetPassword); err != nil {
+			return err
+		}
+		if _, err := a.account.MarkEmailVerified(ctx, t.AccountId); err != nil {
+			return err
+		}
+		if err := a.throttle.Clear(ctx, ThrottleAccount, t.AccountId); err != nil {
+			return err
+		}
+		return a.refreshToken.RevokeAllByAccountId(ctx, t.AccountId)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrInvalidEmailToken)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	response.Message(w, "Password changed, sign in with the new password")
+}
+
+// sendToken emails a new token of the purpose to the account, earlier tokens of the purpose stop working
+func (a *Controller) sendToken(ctx context.Context, user *Account, purpose TokenPurpose) error {
+	tmpl := emailTemplates[purpose]
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	err = db.WithTx(ctx, a.db, func(ctx context.Context) error {
+		if err := a.accountToken.RevokeAll(ctx, user.Id, purpose); err != nil {
+			return err
+		}
+		return a.accountToken.Create(ctx, &AccountToken{
+			AccountId: user.Id,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(tmpl.ttl),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	link := a.appUrl + tmpl.path + "?" + url.Values{"token": {token}}.Encode()
+	return a.mailer.Send(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: tmpl.subject,
+		Body:    fmt.Sprintf(tmpl.body, user.FirstName, link),
+	})
+}
@@ -0,0 +1,66 @@
+package auth_test
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+)
+
+var linkRe = regexp.MustCompile(`http://app\.test(/[a-z-]+)\?(\S+)`)
+
+// mailToken returns token of the link to the app page at path from the last email sent to the address
+func (a *authTest) mailToken(t *testing.T, to, path string) string {
+	t.Helper()
+
+	msg := a.mail.Last(to)
+	if msg == nil {
+		t.Fatalf("no email is sent to %s", to)
+	}
+	m := linkRe.FindStringSubmatch(msg.Body)
+	if m == nil || m[1] != path {
+		t.Fatalf("email %q has no link to %s", msg.Subject, path)
+	}
+	q, err := url.ParseQuery(m[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q.Get("token")
+}
+
+func TestResetTokenIsUsedOnce(t *testing.T) {
+	a := newAuthTest(t)
+	a.signUp(t, "alice")
+	c := a.client()
+	ctx := context.Background()
+
+	if err := c.ForgotPassword(ctx, email("alice")); err != nil {
+		t.Fatal(err)
+	}
+	stale := a.mailToken(t, email("alice"), "/reset-password")
+	// Every new link replaces the previous one
+	if err := c.ForgotPassword(ctx, email("alice")); err != nil {
+		t.Fatal(err)
+	}
+	token := a.mailToken(t, email("alice"), "/reset-password")
+	if err := c.ResetPassword(ctx, stale, "new password"); client.ErrorCode(err) != auth.CodeInvalidEmailToken {
+		t.Fatalf("replaced token: got %v, want %s", err, auth.CodeInvalidEmailToken)
+	}
+
+	if err := c.ResetPassword(ctx, token, "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResetPassword(ctx, token, "another password"); client.ErrorCode(err) != auth.CodeInvalidEmailToken {
+		t.Fatalf("used token: got %v, want %s", err, auth.CodeInvalidEmailToken)
+	}
+
+	if _, err := c.SignIn(ctx, &client.SignInRequest{UsernameOrEmail: "alice", Password: "another password"}); client.ErrorCode(err) != auth.CodeInvalidCredentials {
+		t.Fatalf("got %v, want %s", err, auth.CodeInvalidCredentials)
+	}
+	if _, err := c.SignIn(ctx, &client.SignInRequest{UsernameOrEmail: "alice", Password: "new password"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+// Error codes of auth api, clients branch on them so they never change
+const (
+	CodeAlreadyAuthorized   = "already_authorized"
+	CodeAccountExists       = "account_exists"
+	CodeAccountNotFound     = "account_not_found"
+	CodeInvalidCredentials  = "invalid_credentials"
+	CodeInvalidRefreshToken = "invalid_refresh_token"
+	CodeRefreshTokenUsed    = "refresh_token_used"
+	CodeRefreshTokenExpired = "refresh_token_expired"
+	CodeAccountSuspended    = "account_suspended"
+	CodeOwnAccount          = "own_account"
+	CodeInvalidEmailToken   = "invalid_email_token"
+	CodeEmailVerified       = "email_already_verified"
+	CodeTooManyAttempts     = "too_many_attempts"
+	CodeLockoutNotFound     = "lockout_not_found"
+	CodeInvalidTwoFactor    = "invalid_two_factor_code"
+	CodeTwoFactorEnabled    = "two_factor_enabled"
+	CodeTwoFactorDisabled   = "two_factor_not_enabled"
+	CodeInvalidChallenge    = "invalid_challenge"
+	CodeProviderNotFound    = "oauth_provider_not_found"
+	CodeInvalidOAuthState   = "invalid_oauth_state"
+	CodeInvalidOAuthCode    = "invalid_oauth_code"
+	CodeProviderFailed      = "oauth_provider_failed"
+	CodeOAuthEmailRequired  = "oauth_email_required"
+	CodeIdentityEmailTaken  = "identity_email_taken"
+	CodeIdentityLinked      = "identity_linked"
+	CodeIdentityNotFound    = "identity_not_found"
+	CodeUsernameReserved    = "username_reserved"
+	CodeDeletionScheduled   = "deletion_scheduled"
+	CodeDeletionNotFound    = "deletion_not_scheduled"
+	CodeExportInProgress    = "export_in_progress"
+	CodeExportNotFound      = "export_not_found"
+)
+
+var (
+	ErrAlreadyAuthorized   = response.NewProblem(http.StatusBadRequest, CodeAlreadyAuthorized, "already authorized")
+	ErrAccountExists       = response.NewProblem(http.StatusConflict, CodeAccountExists, "username or email is already taken")
+	ErrAccountNotFound     = response.NewProblem(http.StatusNotFound, CodeAccountNotFound, "account not found")
+	ErrInvalidCredentials  = response.NewProblem(http.StatusUnauthorized, CodeInvalidCredentials, "invalid username or password")
+	ErrInvalidRefreshToken = response.NewProblem(http.StatusUnauthorized, CodeInvalidRefreshToken, "invalid refresh token")
+	ErrRefreshTokenUsed    = response.NewProblem(http.StatusUnauthorized, CodeRefreshTokenUsed, "refresh token is already used")
+	ErrRefreshTokenExpired = response.NewProblem(http.StatusUnauthorized, CodeRefreshTokenExpired, "refresh token is expired")
+	ErrAccountSuspended    = response.NewProblem(http.StatusForbidden, CodeAccountSuspended, "account is suspended")
+	ErrInvalidEmailToken   = response.NewProblem(http.StatusBadRequest, CodeInvalidEmailToken, "token is invalid, expired or already used")
+	ErrEmailVerified       = response.NewProblem(http.StatusConflict, CodeEmailVerified, "email is already verified")
+	ErrTooManyAttempts     = response.NewProblem(http.StatusTooManyRequests, CodeTooManyAttempts, "too many failed sign in attempts, try again later")
+	ErrLockoutNotFound     = response.NewProblem(http.StatusNotFound, CodeLockoutNotFound, "lockout not found")
+	ErrInvalidTwoFactor    = response.NewProblem(http.StatusUnauthorized, CodeInvalidTwoFactor, "invalid two-factor code")
+	ErrTwoFactorEnabled    = response.NewProblem(http.StatusConflict, CodeTwoFactorEnabled, "two-factor authentication is already enabled")
+	ErrTwoFactorDisabled   = response.NewProblem(http.StatusConflict, CodeTwoFactorDisabled, "two-factor authentication is not enabled")
+	ErrInvalidChallenge    = response.NewProblem(http.StatusUnauthorized, CodeInvalidChallenge, "sign in challenge is invalid or expired")
+	ErrProviderNotFound    = response.NewProblem(http.StatusNotFound, CodeProviderNotFound, "sign in provider not found")
+	ErrInvalidOAuthState   = response.NewProblem(http.StatusBadRequest, CodeInvalidOAuthState, "authorization request is invalid, expired or already finished")
+	ErrInvalidOAuthCode    = response.NewProblem(http.StatusBadRequest, CodeInvalidOAuthCode, "provider rejected the authorization code")
+	ErrProviderFailed      = response.NewProblem(http.StatusBadGateway, CodeProviderFailed, "provider is unavailable or returned invalid identity")
+	ErrOAuthEmailRequired  = response.NewProblem(http.StatusBadRequest, CodeOAuthEmailRequired, "provider didn't share email of the account, it's required to create an account")
+	ErrIdentityEmailTaken  = response.NewProblem(http.StatusConflict, CodeIdentityEmailTaken, "account with the email already exists, sign in with password and link the provider")
+	ErrIdentityLinked      = response.NewProblem(http.StatusConflict, CodeIdentityLinked, "identity is linked to another account or account already has identity of the provider")
+	ErrIdentityNotFound    = response.NewProblem(http.StatusNotFound, CodeIdentityNotFound, "account has no identity of the provider")
+	ErrUsernameReserved    = response.NewProblem(http.StatusBadRequest, CodeUsernameReserved, "usernames starting with "+DeletedUsernamePrefix+" are reserved")
+	ErrDeletionScheduled   = response.NewProblem(http.StatusConflict, CodeDeletionScheduled, "account deletion is already scheduled")
+	ErrDeletionNotFound    = response.NewProblem(http.StatusConflict, CodeDeletionNotFound, "account deletion is not scheduled")
+	ErrExportInProgress    = response.NewProblem(http.StatusConflict, CodeExportInProgress, "data export is already in progress")
+	ErrExportNotFound      = response.NewProblem(http.StatusNotFound, CodeExportNotFound, "data export link is invalid or expired")
+	ErrOwnAccount          = response.NewProblem(http.StatusConflict, CodeOwnAccount, "staff can't suspend or change role of their own account")
+)
+
+// isUniqueViolation reports whether err is postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/internalapi"
+	"github.com/robloxxa/DistrictFunding/pkg/mail"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+const (
+	AuditAccountExport         = "account.export"
+	AuditAccountExportDownload = "account.export_download"
+)
+
+const (
+	// exportCheckInterval is how often ExportJob looks for pending exports
+	exportCheckInterval = time.Minute
+	exportBatch         = 10
+	// exportMaxAttempts is how many times export is tried before it's failed, one attempt per check
+	exportMaxAttempts = 5
+)
+
+var exportEmail = emailTemplate{
+	ttl:     7 * 24 * time.Hour,
+	path:    "/data-export",
+	subject: "Your personal data export is ready",
+	body: "Hello, %s!\n\nFollow the link to download everything District Funding holds about you:\n%s\n\n" +
+		"The link expires in 7 days. If you didn't ask for your data, change your password.",
+}
+
+// ExportSource is a service holding data of accounts, its part of the export is put into the archive as {Name}.json
+type ExportSource interface {
+	Name() string
+	ExportAccount(ctx context.Context, accountId string) (json.RawMessage, error)
+}
+
+type serviceExportSource struct {
+	name          string
+	url           string
+	internalToken string
+	c             *http.Client
+}
+
+// NewServiceExportSource creates source calling /internal/accounts/{accountId}/export of the service at url
+func NewServiceExportSource(name, url, internalToken string) ExportSource {
+	return &serviceExportSource{name, url, internalToken, &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *serviceExportSource) Name() string {
+	return s.name
+}
+
+func (s *serviceExportSource) ExportAccount(ctx context.Context, accountId string) (json.RawMessage, error) {
+	urlString, err := url.JoinPath(s.url, "internal", "accounts", accountId, "export")
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlString, nil)
+	if err != nil {
+		return nil, err
+	}
+	internalapi.SetToken(req, s.internalToken)
+
+	res, err := s.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s service responded with %s", s.name, res.Status)
+	}
+
+	var data json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ExportJob builds archives of pending personal data exports and emails their download links
+type ExportJob struct {
+	db       *pgxpool.Pool
+	export   DataExportModel
+	account  AccountModel
+	identity IdentityModel
+	totp     TotpModel
+	mailer   mail.Mailer
+	appUrl   string
+	sources  []ExportSource
+}
+
+// NewExportJob creates job putting data of the sources into archives besides data of auth service,
+// links of emails lead to {appUrl}/data-export?token=...
+func NewExportJob(db *pgxpool.Pool, mailer mail.Mailer, appUrl string, sources ...ExportSource) *ExportJob {
+	return &ExportJob{
+		db:       db,
+		export:   &dataExportModel{db},
+		account:  &accountModel{db},
+		identity: &identityModel{db},
+		totp:     &totpModel{db},
+		mailer:   mailer,
+		appUrl:   appUrl,
+		sources:  sources,
+	}
+}
+
+// Run processes pending exports and removes expired archives until ctx is done
+func (j *ExportJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(exportCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.export.PurgeExpired(ctx); err != nil {
+			log.Println(fmt.Errorf("unable to purge expired data exports: %w", err))
+		}
+		if err := j.process(ctx); err != nil {
+			log.Println(fmt.Errorf("unable to process data exports: %w", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process tries every pending export once. Export stays locked while its archive is built,
+// so replicas never build the same archive
+func (j *ExportJob) process(ctx context.Context) error {
+	started := time.Now()
+	for i := 0; i < exportBatch; i++ {
+		var (
+			ready *DataExport
+			user  *Account
+			token string
+		)
+		err := db.WithTx(ctx, j.db, func(ctx context.Context) error {
+			e, err := j.export.LockPending(ctx, started)
+			if err != nil {
+				return err
+			}
+
+			var archive []byte
+			user, archive, err = j.build(ctx, e.AccountId)
+			if err != nil {
+				failed, ferr := j.export.Fail(ctx, e.Id, err.Error(), exportMaxAttempts)
+				if ferr != nil {
+					return ferr
+				}
+				log.Printf("Unable to export data of account %s, attempt %d of %d: %v\n",
+					e.AccountId, failed.Attempts, exportMaxAttempts, err)
+				return nil
+			}
+
+			if token, err = randomToken(); err != nil {
+				return err
+			}
+			ready, err = j.export.Complete(ctx, e.Id, archive, hashToken(token), time.Now().Add(exportEmail.ttl))
+			return err
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ready == nil {
+			continue
+		}
+
+		// Archive is ready anyway, the account can request another export if the email is lost
+		link := j.appUrl + exportEmail.path + "?" + url.Values{"token": {token}}.Encode()
+		err = j.mailer.Send(ctx, &mail.Message{
+			To:      user.Email,
+			Subject: exportEmail.subject,
+			Body:    fmt.Sprintf(exportEmail.body, user.FirstName, link),
+		})
+		if err != nil {
+			log.Printf("Unable to send data export email of account %s: %v\n", user.Id, err)
+		}
+	}
+	return nil
+}
+
+// build collects data of the account from auth service and every source and packs it into zip archive
+func (j *ExportJob) build(ctx context.Context, accountId string) (*Account, []byte, error) {
+	user, err := j.account.GetByUUID(ctx, accountId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, nil, fmt.Errorf("account is deleted")
+	}
+
+	identities, err := j.identity.ListByAccountId(ctx, accountId)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := j.totp.Get(ctx, accountId)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, err
+	}
+
+	account := AccountExport{
+		Account:             *newAccountResponse(user),
+		PendingEmail:        user.PendingEmail,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+		TwoFactorEnabled:    t != nil && t.EnabledAt != nil,
+		Identities:          make([]IdentityResponse, 0, len(identities)),
+		ExportedAt:          time.Now(),
+	}
+	for _, i := range identities {
+		account.Identities = append(account.Identities, newIdentityResponse(&i))
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := writeZipJson(zw, "account.json", &account); err != nil {
+		return nil, nil, err
+	}
+	for _, s := range j.sources {
+		data, err := s.ExportAccount(ctx, accountId)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writeZipJson(zw, s.Name()+".json", data); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return user, buf.Bytes(), nil
+}
+
+func writeZipJson(zw *zip.Writer, name string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	return err
+}
+
+// RequestExport queues personal data export of the account, its link is emailed once the archive is ready
+func (a *Controller) RequestExport(w http.ResponseWriter, r *http.Request) {
+	user, err := a.currentAccount(r)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	var e *DataExport
+	err = db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		e, err = a.export.Create(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+		details := struct {
+			ExportId string `json:"export_id"`
+		}{e.Id}
+		return audit.Record(ctx, db.Conn(ctx, a.db), audit.New(r, AuditAccountExport, AuditTargetAccount, user.Id), &details)
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			response.WriteProblem(w, r, ErrExportInProgress)
+			return
+		}
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	response.Json(w, newDataExportResponse(e))
+}
+
+func (a *Controller) ListExports(w http.ResponseWriter, r *http.Request) {
+	user, err := a.currentAccount(r)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	exports, err := a.export.ListByAccountId(r.Context(), user.Id)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := ListDataExportsResponse{Exports: make([]DataExportResponse, 0, len(exports))}
+	for _, e := range exports {
+		res.Exports = append(res.Exports, *newDataExportResponse(&e))
+	}
+
+	response.Json(w, &res)
+}
+
+// DownloadExport serves archive of the emailed link, the token is the only credential,
+// so the link works in a browser without access token
+func (a *Controller) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		response.WriteProblem(w, r, ErrExportNotFound)
+		return
+	}
+
+	e, err := a.export.Archive(r.Context(), hashToken(token))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrExportNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	entry := audit.New(r, AuditAccountExportDownload, AuditTargetAccount, e.AccountId)
+	entry.ActorId = &e.AccountId
+	details := struct {
+		ExportId string `json:"export_id"`
+	}{e.Id}
+	if err := audit.Record(r.Context(), db.Conn(r.Context(), a.db), entry, &details); err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="district-funding-%s.zip"`, e.CreatedAt.Format(time.DateOnly)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(e.Archive)))
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(e.Archive)
+}
+
+func newDataExportResponse(e *DataExport) *DataExportResponse {
+	status := e.Status
+	if status == ExportReady && e.ExpiresAt != nil && time.Now().After(*e.ExpiresAt) {
+		status = ExportExpired
+	}
+	return &DataExportResponse{
+		Id:          e.Id,
+		Status:      status,
+		CreatedAt:   e.CreatedAt,
+		CompletedAt: e.CompletedAt,
+		ExpiresAt:   e.ExpiresAt,
+	}
+}
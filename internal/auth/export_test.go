@@ -0,0 +1,159 @@
+package auth_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+)
+
+// exportSource is a service holding the same data of every account, it fails while err is set
+type exportSource struct {
+	data string
+	err  error
+}
+
+func (s *exportSource) Name() string {
+	return "campaigns"
+}
+
+func (s *exportSource) ExportAccount(context.Context, string) (json.RawMessage, error) {
+	return json.RawMessage(s.data), s.err
+}
+
+// runExportJob processes pending exports once and stops when the test ends
+func (a *authTest) runExportJob(t *testing.T, source auth.ExportSource) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go auth.NewExportJob(a.pool, a.mail, "http://app.test", source).Run(ctx)
+}
+
+// waitExport polls exports of the client until the latest one isn't pending
+func waitExport(t *testing.T, c *client.Client) *client.DataExportResponse {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		exports, err := c.Exports(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(exports) > 0 && exports[0].Status != auth.ExportPending {
+			return &exports[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("export is still pending")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// unzip returns files of the archive by name
+func unzip(t *testing.T, archive []byte) map[string][]byte {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = b
+	}
+	return files
+}
+
+func TestExportIsEmailedWithDataOfEveryService(t *testing.T) {
+	a := newAuthTest(t)
+	ctx := context.Background()
+	c := a.signUp(t, "alice")
+
+	if _, err := c.RequestExport(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RequestExport(ctx); client.ErrorCode(err) != auth.CodeExportInProgress {
+		t.Fatalf("got %v, want %s", err, auth.CodeExportInProgress)
+	}
+
+	a.runExportJob(t, &exportSource{data: `{"campaigns": []}`})
+	if e := waitExport(t, c); e.Status != auth.ExportReady {
+		t.Fatalf("export is %s, want %s", e.Status, auth.ExportReady)
+	}
+
+	archive, err := a.client().DownloadExport(ctx, a.mailToken(t, email("alice"), "/data-export"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := unzip(t, archive)
+
+	var account auth.AccountExport
+	if err := json.Unmarshal(files["account.json"], &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Account.Email != email("alice") {
+		t.Fatalf("exported email is %s, want %s", account.Account.Email, email("alice"))
+	}
+	var campaigns struct {
+		Campaigns []any `json:"campaigns"`
+	}
+	if err := json.Unmarshal(files["campaigns.json"], &campaigns); err != nil || campaigns.Campaigns == nil {
+		t.Fatalf("campaigns.json is %q: %v", files["campaigns.json"], err)
+	}
+
+	if _, err := a.client().DownloadExport(ctx, "wrong"); client.ErrorCode(err) != auth.CodeExportNotFound {
+		t.Fatalf("wrong token: got %v, want %s", err, auth.CodeExportNotFound)
+	}
+}
+
+func TestExportWaitsForFailedService(t *testing.T) {
+	a := newAuthTest(t)
+	ctx := context.Background()
+	c := a.signUp(t, "alice")
+
+	if _, err := c.RequestExport(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a.runExportJob(t, &exportSource{err: errors.New("campaign service is down")})
+
+	// Failed attempt leaves export pending for the next check and sends nothing
+	var attempts int
+	deadline := time.Now().Add(10 * time.Second)
+	for attempts == 0 {
+		if err := a.pool.QueryRow(ctx, `SELECT attempts FROM DataExport`).Scan(&attempts); err != nil {
+			t.Fatal(err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("export isn't tried")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	exports, err := c.Exports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exports) != 1 || exports[0].Status != auth.ExportPending {
+		t.Fatalf("exports are %+v, want one pending", exports)
+	}
+	if msg := a.mail.Last(email("alice")); msg != nil && msg.Subject == "Your personal data export is ready" {
+		t.Fatal("export email is sent for failed export")
+	}
+}
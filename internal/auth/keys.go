@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+)
+
+const (
+	// keyCheckInterval is how often KeyRotator checks whether current key should be rotated
+	keyCheckInterval = time.Minute
+	// encryptedKeyPrefix marks private keys encrypted with the key encryption key, keys stored before encryption are plain JWK
+	encryptedKeyPrefix = "aesgcm:"
+)
+
+// KeyRotator keeps signing keys in the database and rotates them every interval.
+// Previous keys stay in the key set until every token signed with them is expired
+type KeyRotator struct {
+	db       *pgxpool.Pool
+	keys     *jwtauth.KeySet
+	model    SigningKeyModel
+	alg      jwa.SignatureAlgorithm
+	interval time.Duration
+	// aead encrypts private keys stored in the database
+	aead cipher.AEAD
+}
+
+// NewKeyRotator loads signing keys and creates the first one if there is none,
+// private keys are encrypted in the database with AES-GCM using encryptionKey of 32 bytes
+func NewKeyRotator(ctx context.Context, db *pgxpool.Pool, alg jwa.SignatureAlgorithm, interval time.Duration, encryptionKey []byte) (*KeyRotator, error) {
+	if len(encryptionKey) != 32 {
+		return nil, fmt.Errorf("key encryption key must be 32 bytes, got %d", len(encryptionKey))
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	kr := &KeyRotator{
+		db:       db,
+		keys:     jwtauth.NewKeySet(nil, jwk.NewSet()),
+		model:    &signingKeyModel{db},
+		alg:      alg,
+		interval: interval,
+		aead:     aead,
+	}
+
+	if err := kr.rotate(ctx); err != nil {
+		return nil, err
+	}
+
+	return kr, nil
+}
+
+func (kr *KeyRotator) KeySet() *jwtauth.KeySet {
+	return kr.keys
+}
+
+// Run rotates and reloads keys until ctx is done
+func (kr *KeyRotator) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := kr.rotate(ctx); err != nil {
+				log.Println(fmt.Errorf("unable to rotate signing keys: %w", err))
+			}
+		}
+	}
+}
+
+// rotate creates a new key if the current one is older than interval and reloads keys from the database,
+// keys of other replicas are picked up here as well. Ages of keys are compared by the database clock
+func (kr *KeyRotator) rotate(ctx context.Context) error {
+	err := db.WithTx(ctx, kr.db, func(ctx context.Context) error {
+		// Replicas check and create keys one at a time, so only one of them creates the key
+		if err := kr.model.Lock(ctx); err != nil {
+			return err
+		}
+		current, err := kr.model.ExistsSince(ctx, kr.interval)
+		if err != nil || current {
+			return err
+		}
+
+		key, err := generateSigningKey(kr.alg)
+		if err != nil {
+			return err
+		}
+		privateKey, err := kr.encrypt(key)
+		if err != nil {
+			return err
+		}
+		return kr.model.Create(ctx, &SigningKey{Kid: key.KeyID(), PrivateKey: privateKey})
+	})
+	if err != nil {
+		return err
+	}
+
+	// Key is used for signing for interval (plus a check period of delay), and its tokens live for accessTokenTTL after that
+	keys, err := kr.model.ListSince(ctx, kr.interval+accessTokenTTL+keyCheckInterval)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no signing keys found")
+	}
+
+	set := jwk.NewSet()
+	var signKey jwk.Key
+	for _, k := range keys {
+		private, err := kr.decrypt(&k)
+		if err != nil {
+			return fmt.Errorf("unable to parse signing key %s: %w", k.Kid, err)
+		}
+		if signKey == nil {
+			signKey = private
+		}
+		public, err := private.PublicKey()
+		if err != nil {
+			return err
+		}
+		if err := set.AddKey(public); err != nil {
+			return err
+		}
+	}
+
+	kr.keys.Update(signKey, set)
+	return nil
+}
+
+// encrypt serializes private key as JWK and encrypts it, kid is authenticated with it so keys can't be swapped
+func (kr *KeyRotator) encrypt(key jwk.Key) (string, error) {
+	plain, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, kr.aead.NonceSize(), kr.aead.NonceSize()+len(plain)+kr.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := kr.aead.Seal(nonce, nonce, plain, []byte(key.KeyID()))
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (kr *KeyRotator) decrypt(k *SigningKey) (jwk.Key, error) {
+	encoded, ok := strings.CutPrefix(k.PrivateKey, encryptedKeyPrefix)
+	if !ok {
+		return jwk.ParseKey([]byte(k.PrivateKey))
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < kr.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted key is too short")
+	}
+	nonce, sealed := sealed[:kr.aead.NonceSize()], sealed[kr.aead.NonceSize():]
+	plain, err := kr.aead.Open(nil, nonce, sealed, []byte(k.Kid))
+	if err != nil {
+		return nil, err
+	}
+	return jwk.ParseKey(plain)
+}
+
+func generateSigningKey(alg jwa.SignatureAlgorithm) (jwk.Key, error) {
+	var raw interface{}
+	switch alg {
+	case jwa.EdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		raw = private
+	case jwa.RS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		raw = private
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := jwk.AssignKeyID(key); err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.AlgorithmKey, alg); err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
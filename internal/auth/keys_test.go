@@ -0,0 +1,63 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/pkg/db/dbtest"
+)
+
+var encryptionKey = bytes.Repeat([]byte{7}, 32)
+
+func TestReplicasCreateOneSigningKey(t *testing.T) {
+	pool := dbtest.New(t, auth.Migrations)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := auth.NewKeyRotator(ctx, pool, jwa.EdDSA, time.Hour, encryptionKey); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var keys int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM SigningKey`).Scan(&keys); err != nil {
+		t.Fatal(err)
+	}
+	if keys != 1 {
+		t.Fatalf("%d keys are created, want 1", keys)
+	}
+}
+
+func TestSigningKeyIsEncrypted(t *testing.T) {
+	pool := dbtest.New(t, auth.Migrations)
+	ctx := context.Background()
+
+	if _, err := auth.NewKeyRotator(ctx, pool, jwa.EdDSA, time.Hour, encryptionKey); err != nil {
+		t.Fatal(err)
+	}
+
+	var privateKey string
+	if err := pool.QueryRow(ctx, `SELECT private_key FROM SigningKey`).Scan(&privateKey); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(privateKey, `"d"`) {
+		t.Fatalf("private key is stored in plain: %s", privateKey)
+	}
+
+	// Keys are not readable with another key encryption key
+	if _, err := auth.NewKeyRotator(ctx, pool, jwa.EdDSA, time.Hour, bytes.Repeat([]byte{8}, 32)); err == nil {
+		t.Fatal("keys are loaded with wrong key encryption key")
+	}
+}
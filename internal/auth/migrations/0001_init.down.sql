@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS SigningKey;
+DROP TABLE IF EXISTS RevokedToken;
+DROP TABLE IF EXISTS RefreshToken;
+DROP TABLE IF EXISTS Account;
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS Account (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(32) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    first_name TEXT,
+    last_name TEXT,
+    -- Passwords stores as BCRYPT hash, thus the limit is 60 characters
+    password VARCHAR(60) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    -- TODO: make an automatic function changing updated_at
+    updated_at TIMESTAMPTZ DEFAULT current_timestamp
+);
+
+CREATE TABLE IF NOT EXISTS RefreshToken (
+    id SERIAL PRIMARY KEY,
+    account_id UUID NOT NULL,
+    -- Refresh tokens are stored as SHA-256 hex digest, raw token is only known to the client
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    CONSTRAINT fk_account
+        FOREIGN KEY(account_id)
+            REFERENCES Account(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS RevokedToken (
+    jti VARCHAR(64) PRIMARY KEY,
+    -- Expiration of the revoked access token, entries after it can be safely removed
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ DEFAULT current_timestamp
+);
+
+CREATE TABLE IF NOT EXISTS SigningKey (
+    kid VARCHAR(64) PRIMARY KEY,
+    -- Private key serialized as JWK, public part is served on /.well-known/jwks.json
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp
+);
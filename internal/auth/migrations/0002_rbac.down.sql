@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS AuditLog;
+
+ALTER TABLE Account
+    DROP COLUMN IF EXISTS suspended_at,
+    DROP COLUMN IF EXISTS role;
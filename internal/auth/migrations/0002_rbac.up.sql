@@ -0,0 +1,17 @@
+ALTER TABLE Account
+    ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+    -- Suspended account can't sign in or refresh its tokens
+    ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS AuditLog (
+    id BIGSERIAL PRIMARY KEY,
+    -- actor_id is NULL for actions made by operators with dfctl
+    actor_id UUID,
+    actor_role VARCHAR(16) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    target_type VARCHAR(32) NOT NULL,
+    target_id VARCHAR(64) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS AccountToken;
+
+ALTER TABLE Account
+    DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,20 @@
+ALTER TABLE Account
+    -- Accounts without verified email can't create campaigns or donate
+    ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+-- Accounts created before verification existed keep working
+UPDATE Account SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS AccountToken (
+    id SERIAL PRIMARY KEY,
+    account_id UUID NOT NULL,
+    purpose VARCHAR(16) NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+    -- Tokens are stored as SHA-256 hex digest like refresh tokens, raw token is only sent by mail
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    CONSTRAINT fk_account
+        FOREIGN KEY(account_id)
+            REFERENCES Account(id) ON DELETE CASCADE
+);
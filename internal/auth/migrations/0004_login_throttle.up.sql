@@ -0,0 +1,11 @@
+-- Failed sign in attempts by account, by unknown username or email, and by client ip
+CREATE TABLE IF NOT EXISTS LoginThrottle (
+    kind VARCHAR(8) NOT NULL CHECK (kind IN ('account', 'login', 'ip')),
+    key VARCHAR(255) NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (kind, key)
+);
+
+CREATE INDEX IF NOT EXISTS login_throttle_locked_idx ON LoginThrottle (locked_until) WHERE locked_until IS NOT NULL;
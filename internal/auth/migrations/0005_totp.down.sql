@@ -0,0 +1,7 @@
+DELETE FROM AccountToken WHERE purpose = 'sign_in';
+ALTER TABLE AccountToken DROP CONSTRAINT IF EXISTS accounttoken_purpose_check;
+ALTER TABLE AccountToken ADD CONSTRAINT accounttoken_purpose_check
+    CHECK (purpose IN ('verify_email', 'reset_password'));
+
+DROP TABLE IF EXISTS RecoveryCode;
+DROP TABLE IF EXISTS AccountTotp;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS AccountTotp (
+    account_id UUID PRIMARY KEY,
+    -- Base32 secret, it's needed in plain to check codes like signing keys are
+    secret VARCHAR(64) NOT NULL,
+    -- Counter of the last accepted code, codes of it and earlier periods are rejected
+    last_counter BIGINT NOT NULL DEFAULT 0,
+    -- Enrollment is pending until the first code is confirmed
+    enabled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    CONSTRAINT fk_account
+        FOREIGN KEY(account_id)
+            REFERENCES Account(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS RecoveryCode (
+    id SERIAL PRIMARY KEY,
+    account_id UUID NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    CONSTRAINT fk_totp
+        FOREIGN KEY(account_id)
+            REFERENCES AccountTotp(account_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS recovery_code_account_idx ON RecoveryCode (account_id);
+
+ALTER TABLE AccountToken DROP CONSTRAINT IF EXISTS accounttoken_purpose_check;
+ALTER TABLE AccountToken ADD CONSTRAINT accounttoken_purpose_check
+    CHECK (purpose IN ('verify_email', 'reset_password', 'sign_in'));
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS OAuthState;
+DROP TABLE IF EXISTS AccountIdentity;
@@ -0,0 +1,31 @@
+-- External identities of accounts signed in with OIDC providers, subject is the account id at the provider
+CREATE TABLE IF NOT EXISTS AccountIdentity (
+    provider VARCHAR(32) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    account_id UUID NOT NULL,
+    -- Email the provider gave on the last sign in, it may differ from account email
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    last_used_at TIMESTAMPTZ DEFAULT current_timestamp,
+    PRIMARY KEY (provider, subject),
+    -- Account links one identity of every provider
+    UNIQUE (account_id, provider),
+    CONSTRAINT fk_account
+        FOREIGN KEY(account_id)
+            REFERENCES Account(id) ON DELETE CASCADE
+);
+
+-- Pending authorization requests, state is stored as SHA-256 hex digest and used once by the callback
+CREATE TABLE IF NOT EXISTS OAuthState (
+    state_hash VARCHAR(64) PRIMARY KEY,
+    provider VARCHAR(32) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    -- Account linking the identity, NULL for sign in
+    account_id UUID,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    CONSTRAINT fk_account
+        FOREIGN KEY(account_id)
+            REFERENCES Account(id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+DELETE FROM AccountToken WHERE purpose = 'change_email';
+ALTER TABLE AccountToken DROP CONSTRAINT IF EXISTS accounttoken_purpose_check;
+ALTER TABLE AccountToken ADD CONSTRAINT accounttoken_purpose_check
+    CHECK (purpose IN ('verify_email', 'reset_password', 'sign_in'));
+
+DROP TRIGGER IF EXISTS account_updated_at ON Account;
+DROP FUNCTION IF EXISTS set_updated_at();
+
+DROP INDEX IF EXISTS account_deletion_idx;
+ALTER TABLE Account
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS deletion_scheduled_at,
+    DROP COLUMN IF EXISTS pending_email;
@@ -0,0 +1,23 @@
+ALTER TABLE Account
+    -- New email waits here until its owner follows the link of confirmation email
+    ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255),
+    -- Account deleted by its owner is anonymised after this time, until then deletion can be cancelled
+    ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS account_deletion_idx ON Account (deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = current_timestamp;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS account_updated_at ON Account;
+CREATE TRIGGER account_updated_at BEFORE UPDATE ON Account
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE AccountToken DROP CONSTRAINT IF EXISTS accounttoken_purpose_check;
+ALTER TABLE AccountToken ADD CONSTRAINT accounttoken_purpose_check
+    CHECK (purpose IN ('verify_email', 'reset_password', 'sign_in', 'change_email'));
@@ -0,0 +1,25 @@
+-- Personal data exports requested by accounts, archives are built by ExportJob from data of every service
+CREATE TABLE IF NOT EXISTS DataExport (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL,
+    -- pending, ready or failed, pending export is retried until it runs out of attempts
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    attempted_at TIMESTAMPTZ,
+    -- Zip archive and token of its download link, token is stored as SHA-256 hex digest.
+    -- Both are removed once the link expires
+    archive BYTEA,
+    token_hash VARCHAR(64) UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    CONSTRAINT fk_account
+        FOREIGN KEY(account_id)
+            REFERENCES Account(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS data_export_account_idx ON DataExport (account_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS data_export_pending_idx ON DataExport (created_at) WHERE status = 'pending';
+-- Account has at most one export in progress
+CREATE UNIQUE INDEX IF NOT EXISTS data_export_account_pending_idx ON DataExport (account_id) WHERE status = 'pending';
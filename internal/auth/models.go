@@ -1,5 +1,11 @@
 package auth
 
+import (
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+)
+
 // TODO: add other fields like phone number, firstname, secondname, etc.
 type SignUpRequest struct {
 	Email     string `json:"email" validate:"required,email"`
@@ -11,13 +17,212 @@ type SignUpRequest struct {
 
 type SignInRequest struct {
 	UsernameOrEmail string `json:"username_or_email"`
-	Password string `json:"password" validate:"required"`
+	Password        string `json:"password" validate:"required"`
 }
 
 type MeRequest struct {
-	Id string `json:"id"`
-	Email     string `json:"email"`
-	Username  string `json:"username"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	Id               string       `json:"id"`
+	Email            string       `json:"email"`
+	Username         string       `json:"username"`
+	FirstName        string       `json:"first_name"`
+	LastName         string       `json:"last_name"`
+	Role             jwtauth.Role `json:"role"`
+	EmailVerified    bool         `json:"email_verified"`
+	TwoFactorEnabled bool         `json:"two_factor_enabled"`
+	// PendingEmail replaces email once it's confirmed
+	PendingEmail *string `json:"pending_email,omitempty"`
+	// DeletionScheduledAt is when the account is anonymised unless deletion is cancelled
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is lifetime of access token in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// SignInResponse has either tokens or two-factor challenge if account has two-factor authentication enabled
+type SignInResponse struct {
+	*TokenResponse
+	Challenge *ChallengeResponse `json:"challenge,omitempty"`
+}
+
+// ChallengeResponse is redeemed at /signin/2fa with two-factor code
+type ChallengeResponse struct {
+	Token string `json:"token"`
+	// ExpiresIn is lifetime of the challenge in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+type SignInTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	// Code is totp code or one of recovery codes
+	Code string `json:"code" validate:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type SignOutRequest struct {
+	// RefreshToken is optional, if it's empty every refresh token of the account is revoked
+	RefreshToken string `json:"refresh_token"`
+}
+
+type SuspendAccountRequest struct {
+	// Reason is stored in audit log
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+type SetAccountRoleRequest struct {
+	Role jwtauth.Role `json:"role" validate:"required,oneof=user moderator admin"`
+}
+
+// AccountResponse is account as seen by staff
+type AccountResponse struct {
+	Id              string       `json:"id"`
+	Email           string       `json:"email"`
+	Username        string       `json:"username"`
+	FirstName       string       `json:"first_name"`
+	LastName        string       `json:"last_name"`
+	Role            jwtauth.Role `json:"role"`
+	SuspendedAt     *time.Time   `json:"suspended_at"`
+	EmailVerifiedAt *time.Time   `json:"email_verified_at"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
 }
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,gt=6"`
+}
+
+type (
+	// LockoutResponse is a locked key, Key is account id, lowercase login without account or client address
+	LockoutResponse struct {
+		Kind         ThrottleKind `json:"kind"`
+		Key          string       `json:"key"`
+		Username     *string      `json:"username,omitempty"`
+		Failures     int          `json:"failures"`
+		LastFailedAt time.Time    `json:"last_failed_at"`
+		LockedUntil  time.Time    `json:"locked_until"`
+	}
+
+	ListLockoutsResponse struct {
+		Lockouts []LockoutResponse `json:"lockouts"`
+	}
+)
+
+type (
+	// EnrollTwoFactorResponse is shown once, recovery codes replace totp codes when authenticator is lost
+	EnrollTwoFactorResponse struct {
+		Secret        string   `json:"secret"`
+		OtpauthUri    string   `json:"otpauth_uri"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	TwoFactorCodeRequest struct {
+		// Code is totp code, recovery codes are accepted too except for confirming enrollment
+		Code string `json:"code" validate:"required"`
+	}
+
+	// StepUpResponse is access token proving recent second factor check, refresh token stays the same
+	StepUpResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+)
+
+type (
+	OAuthProvidersResponse struct {
+		Providers []string `json:"providers"`
+	}
+
+	// OAuthStartResponse is provider sign in page, provider sends the browser back to redirect url
+	// of the provider with code and state
+	OAuthStartResponse struct {
+		AuthorizationUrl string `json:"authorization_url"`
+	}
+
+	OAuthCallbackRequest struct {
+		Code  string `json:"code" validate:"required"`
+		State string `json:"state" validate:"required"`
+	}
+
+	IdentityResponse struct {
+		Provider string `json:"provider"`
+		// Email is the one provider gave on the last sign in
+		Email      string    `json:"email"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastUsedAt time.Time `json:"last_used_at"`
+	}
+
+	ListIdentitiesResponse struct {
+		Identities []IdentityResponse `json:"identities"`
+	}
+)
+
+type (
+	// UpdateMeRequest changes only fields that are set
+	UpdateMeRequest struct {
+		Username  *string `json:"username" validate:"omitnil,min=1,lte=32"`
+		FirstName *string `json:"first_name" validate:"omitnil,min=1"`
+		LastName  *string `json:"last_name"`
+	}
+
+	ChangePasswordRequest struct {
+		CurrentPassword string `json:"current_password" validate:"required"`
+		NewPassword     string `json:"new_password" validate:"required,gt=6"`
+	}
+
+	ChangeEmailRequest struct {
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"required"`
+	}
+
+	DeleteMeRequest struct {
+		Password string `json:"password" validate:"required"`
+	}
+
+	DeleteMeResponse struct {
+		// DeletionScheduledAt is when the account is anonymised, until then deletion can be cancelled
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+)
+
+type (
+	DataExportResponse struct {
+		Id     string       `json:"id"`
+		Status ExportStatus `json:"status"`
+		// CreatedAt is when export is requested, CompletedAt when it's ready or failed
+		CreatedAt   time.Time  `json:"created_at"`
+		CompletedAt *time.Time `json:"completed_at,omitempty"`
+		// ExpiresAt is when download link of ready export stops working
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}
+
+	ListDataExportsResponse struct {
+		Exports []DataExportResponse `json:"exports"`
+	}
+
+	// AccountExport is account.json of personal data export
+	AccountExport struct {
+		Account             AccountResponse    `json:"account"`
+		PendingEmail        *string            `json:"pending_email,omitempty"`
+		DeletionScheduledAt *time.Time         `json:"deletion_scheduled_at,omitempty"`
+		TwoFactorEnabled    bool               `json:"two_factor_enabled"`
+		Identities          []IdentityResponse `json:"identities"`
+		ExportedAt          time.Time          `json:"exported_at"`
+	}
+)
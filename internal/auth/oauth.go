@@ -0,0 +1,419 @@
+package auth
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/oidc"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// oauthStateTTL is how long the account has to sign in at the provider
+	oauthStateTTL = 10 * time.Minute
+	// maxUsernameBase leaves room for suffix of generated usernames within 32 characters
+	maxUsernameBase     = 24
+	usernameSuffixTries = 5
+	// oauthStateCookie binds authorization request to the browser that started it, so callback with code and state
+	// of another browser is rejected and nobody is signed into account of someone else
+	oauthStateCookie = "oauth_state"
+)
+
+var usernameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func (a *Controller) ListOAuthProviders(w http.ResponseWriter, r *http.Request) {
+	res := OAuthProvidersResponse{Providers: make([]string, 0, len(a.providers))}
+	for name := range a.providers {
+		res.Providers = append(res.Providers, name)
+	}
+	slices.Sort(res.Providers)
+
+	response.Json(w, &res)
+}
+
+// StartOAuth returns sign in page of the provider, the code it gives is redeemed at OAuthCallback
+func (a *Controller) StartOAuth(w http.ResponseWriter, r *http.Request) {
+	p := a.oauthProvider(w, r)
+	if p == nil {
+		return
+	}
+
+	a.startOAuth(w, r, p, nil)
+}
+
+// OAuthCallback signs in with identity of the provider. Account is created on the first sign in,
+// unless the email already belongs to an account, which has to link the identity itself
+func (a *Controller) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	p := a.oauthProvider(w, r)
+	if p == nil {
+		return
+	}
+
+	claims, state := a.finishOAuth(w, r, p)
+	if claims == nil {
+		return
+	}
+	if state.AccountId != nil {
+		response.WriteProblem(w, r, ErrInvalidOAuthState)
+		return
+	}
+
+	identity, err := a.identity.Get(r.Context(), p.Name(), claims.Subject)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	var user *Account
+	if err == nil {
+		if err := a.identity.Touch(r.Context(), p.Name(), claims.Subject, claims.Email); err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		user, err = a.account.GetByUUID(r.Context(), identity.AccountId)
+	} else {
+		user, err = a.createOAuthAccount(r.Context(), p.Name(), claims)
+	}
+	if err != nil {
+		// Problems of account creation are written as is
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	a.completeSignIn(w, r, user)
+}
+
+func (a *Controller) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	identities, err := a.identity.ListByAccountId(r.Context(), token.Subject())
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := ListIdentitiesResponse{Identities: make([]IdentityResponse, 0, len(identities))}
+	for i := range identities {
+		res.Identities = append(res.Identities, newIdentityResponse(&identities[i]))
+	}
+	response.Json(w, &res)
+}
+
+// StartLinkIdentity returns sign in page of the provider, the code it gives is redeemed at LinkIdentity
+func (a *Controller) StartLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	p := a.oauthProvider(w, r)
+	if p == nil {
+		return
+	}
+
+	accountId := token.Subject()
+	a.startOAuth(w, r, p, &accountId)
+}
+
+// LinkIdentity links identity of the provider to the signed in account, so it can sign in with the provider
+func (a *Controller) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	p := a.oauthProvider(w, r)
+	if p == nil {
+		return
+	}
+
+	claims, state := a.finishOAuth(w, r, p)
+	if claims == nil {
+		return
+	}
+	// State of another account or of sign in can't link identities
+	if state.AccountId == nil || *state.AccountId != token.Subject() {
+		response.WriteProblem(w, r, ErrInvalidOAuthState)
+		return
+	}
+
+	identity := AccountIdentity{Provider: p.Name(), Subject: claims.Subject, AccountId: token.Subject(), Email: claims.Email}
+	if err := a.identity.Create(r.Context(), &identity); err != nil {
+		if isUniqueViolation(err) {
+			response.WriteProblem(w, r, ErrIdentityLinked)
+			return
+		}
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := a.identity.Get(r.Context(), p.Name(), claims.Subject)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := newIdentityResponse(created)
+	w.WriteHeader(http.StatusCreated)
+	response.Json(w, &res)
+}
+
+// UnlinkIdentity forgets identity of the provider, accounts created by the provider sign in with password
+// set by password reset afterwards
+func (a *Controller) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	if err := a.identity.Delete(r.Context(), token.Subject(), chi.URLParam(r, "provider")); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrIdentityNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	response.Message(w, "Identity unlinked")
+}
+
+// oauthProvider returns provider of the route, nil if response is already written
+func (a *Controller) oauthProvider(w http.ResponseWriter, r *http.Request) *oidc.Provider {
+	p, ok := a.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		response.WriteProblem(w, r, ErrProviderNotFound)
+		return nil
+	}
+	return p
+}
+
+// startOAuth stores state of authorization request and responds with sign in page of the provider,
+// accountId is set when the account links identity
+func (a *Controller) startOAuth(w http.ResponseWriter, r *http.Request, p *oidc.Provider, accountId *string) {
+	var values [3]string
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authUrl, err := p.AuthUrl(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("[%s] unable to start sign in with %s: %v", middleware.GetReqID(r.Context()), p.Name(), err)
+		response.WriteProblem(w, r, ErrProviderFailed)
+		return
+	}
+
+	err = a.oauthState.Create(r.Context(), &OAuthState{
+		StateHash:    hashToken(state),
+		Provider:     p.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		AccountId:    accountId,
+		ExpiresAt:    time.Now().Add(oauthStateTTL),
+	})
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	a.setOAuthStateCookie(w, state, int(oauthStateTTL.Seconds()))
+	response.Json(w, &OAuthStartResponse{AuthorizationUrl: authUrl})
+}
+
+// setOAuthStateCookie sets state cookie, negative maxAge removes it
+func (a *Controller) setOAuthStateCookie(w http.ResponseWriter, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.appUrl, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// finishOAuth uses state of the callback request and redeems its code, claims are nil if response is already written.
+// State has to match state cookie set by startOAuth
+func (a *Controller) finishOAuth(w http.ResponseWriter, r *http.Request, p *oidc.Provider) (*oidc.Claims, *OAuthState) {
+	var req OAuthCallbackRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return nil, nil
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return nil, nil
+	}
+
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.State)) != 1 {
+		response.WriteProblem(w, r, ErrInvalidOAuthState)
+		return nil, nil
+	}
+
+	state, err := a.oauthState.Use(r.Context(), p.Name(), hashToken(req.State))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrInvalidOAuthState)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return nil, nil
+	}
+	a.setOAuthStateCookie(w, "", -1)
+
+	claims, err := p.Exchange(r.Context(), req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("[%s] unable to sign in with %s: %v", middleware.GetReqID(r.Context()), p.Name(), err)
+		switch {
+		case errors.Is(err, oidc.ErrRejected):
+			response.WriteProblem(w, r, ErrInvalidOAuthCode)
+		default:
+			response.WriteProblem(w, r, ErrProviderFailed)
+		}
+		return nil, nil
+	}
+	return claims, state
+}
+
+// createOAuthAccount creates account with identity of the provider. It gets random password,
+// so it signs in with the provider until password is set by password reset
+func (a *Controller) createOAuthAccount(ctx context.Context, provider string, claims *oidc.Claims) (*Account, error) {
+	if claims.Email == "" {
+		return nil, ErrOAuthEmailRequired
+	}
+	if _, err := a.account.FindByUsernameOrEmail(ctx, claims.Email); err == nil {
+		return nil, ErrIdentityEmailTaken
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	username, err := a.freeUsername(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &Account{
+		Username:  username,
+		Email:     claims.Email,
+		FirstName: cmp.Or(claims.GivenName, claims.Name, username),
+		LastName:  claims.FamilyName,
+		Password:  string(hash),
+	}
+	err = db.WithTx(ctx, a.db, func(ctx context.Context) error {
+		if err := a.account.Create(ctx, user); err != nil {
+			return err
+		}
+		created, err := a.account.GetByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+		identity := AccountIdentity{Provider: provider, Subject: claims.Subject, AccountId: created.Id, Email: claims.Email}
+		if err := a.identity.Create(ctx, &identity); err != nil {
+			return err
+		}
+
+		// Provider already verified the email
+		if claims.EmailVerified {
+			created, err = a.account.MarkEmailVerified(ctx, created.Id)
+		}
+		user = created
+		return err
+	})
+	if err != nil {
+		// Concurrent sign up or sign in with the same username, email or identity
+		if isUniqueViolation(err) {
+			return nil, ErrAccountExists
+		}
+		return nil, err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := a.sendToken(ctx, user, PurposeVerifyEmail); err != nil {
+			log.Printf("[%s] unable to send verification email: %v", middleware.GetReqID(ctx), err)
+		}
+	}
+	return user, nil
+}
+
+// freeUsername derives username of a new account from its identity, random suffix is added if it's taken
+func (a *Controller) freeUsername(ctx context.Context, claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = usernameUnsafe.ReplaceAllString(base, "")
+	if len(base) > maxUsernameBase {
+		base = base[:maxUsernameBase]
+	}
+	if base == "" || reservedUsername(base) {
+		base = "user"
+	}
+
+	username := base
+	for i := 0; i < usernameSuffixTries; i++ {
+		err := a.account.HasUsername(ctx, username)
+		if err == nil {
+			return username, nil
+		}
+		if !errors.Is(err, ErrAccountExists) {
+			return "", err
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+		if err != nil {
+			return "", err
+		}
+		username = fmt.Sprintf("%s_%d", base, n)
+	}
+	return "", ErrAccountExists
+}
+
+func newIdentityResponse(i *AccountIdentity) IdentityResponse {
+	return IdentityResponse{Provider: i.Provider, Email: i.Email, CreatedAt: i.CreatedAt, LastUsedAt: i.LastUsedAt}
+}
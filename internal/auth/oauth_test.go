@@ -0,0 +1,243 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/db/dbtest"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/mail"
+	"github.com/robloxxa/DistrictFunding/pkg/oidc"
+)
+
+// oauthTest is auth service signing in with the fake OIDC provider
+type oauthTest struct {
+	pool *pgxpool.Pool
+	fake *oidc.FakeProvider
+	url  string
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	pool := dbtest.New(t, auth.Migrations)
+
+	fake, err := oidc.NewFakeProvider("http://oidc.test/fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := oidc.New(fake.Config("http://app.test/oauth/fake/callback")).WithHTTPClient(fake.Client())
+
+	c := auth.NewController(pool, jwtauth.New(jwa.HS256, []byte("secret")), nil, mail.NewMemory(), "http://app.test",
+		[]*oidc.Provider{provider}, "token")
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	return &oauthTest{pool, fake, srv.URL}
+}
+
+// client returns client of a new browser, browsers don't share cookies
+func (o *oauthTest) client() *client.Client {
+	return client.New(o.url, "", "")
+}
+
+// authorize signs in at the provider page of authUrl with email, returns code and state the browser comes back with
+func (o *oauthTest) authorize(t *testing.T, authUrl, email string) (string, string) {
+	t.Helper()
+
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("login_hint", email)
+	u.RawQuery = q.Encode()
+
+	rec := httptest.NewRecorder()
+	o.fake.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u.String(), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("provider responded with %d: %s", rec.Code, rec.Body)
+	}
+
+	callback, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+// signIn signs c in with the provider as email
+func (o *oauthTest) signIn(t *testing.T, c *client.Client, email string) (*client.TokenResponse, error) {
+	t.Helper()
+
+	authUrl, err := c.StartOAuth(context.Background(), oidc.FakeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := o.authorize(t, authUrl, email)
+	return c.FinishOAuth(context.Background(), oidc.FakeName, code, state)
+}
+
+func TestOAuthSignInCreatesAccount(t *testing.T) {
+	o := newOAuthTest(t)
+	ctx := context.Background()
+
+	c := o.client()
+	if _, err := o.signIn(t, c, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	me, err := c.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me.Username != "alice" || me.Email != "alice@example.com" || !me.EmailVerified {
+		t.Fatalf("unexpected account %+v", me)
+	}
+
+	identities, err := c.Identities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Provider != oidc.FakeName {
+		t.Fatalf("unexpected identities %+v", identities)
+	}
+
+	// The next sign in finds the account by identity
+	again := o.client()
+	if _, err := o.signIn(t, again, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	other, err := again.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Id != me.Id {
+		t.Fatalf("signed in as %s, want %s", other.Id, me.Id)
+	}
+}
+
+func TestOAuthLinkIdentity(t *testing.T) {
+	o := newOAuthTest(t)
+	ctx := context.Background()
+
+	c := o.client()
+	_, err := c.SignUp(ctx, &client.SignUpRequest{Email: "bob@example.com", Username: "bob", FirstName: "Bob", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	me, err := c.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Email belongs to the account, so sign in with the provider doesn't take it over
+	if _, err := o.signIn(t, o.client(), "bob@example.com"); client.ErrorCode(err) != auth.CodeIdentityEmailTaken {
+		t.Fatalf("got %v, want %s", err, auth.CodeIdentityEmailTaken)
+	}
+
+	authUrl, err := c.StartLinkIdentity(ctx, oidc.FakeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := o.authorize(t, authUrl, "bob@example.com")
+	if _, err := c.LinkIdentity(ctx, oidc.FakeName, code, state); err != nil {
+		t.Fatal(err)
+	}
+
+	linked := o.client()
+	if _, err := o.signIn(t, linked, "bob@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	other, err := linked.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Id != me.Id {
+		t.Fatalf("signed in as %s, want %s", other.Id, me.Id)
+	}
+}
+
+func TestOAuthStateIsUsedOnce(t *testing.T) {
+	o := newOAuthTest(t)
+	ctx := context.Background()
+
+	jar := &stateJar{}
+	c := o.client().WithHTTPClient(&http.Client{Jar: jar})
+	authUrl, err := c.StartOAuth(ctx, oidc.FakeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := o.authorize(t, authUrl, "carol@example.com")
+	if _, err := c.FinishOAuth(ctx, oidc.FakeName, code, state); err != nil {
+		t.Fatal(err)
+	}
+
+	// Callback removes the cookie, the replay brings it back to reach the state check
+	jar.state = state
+	if _, err := c.FinishOAuth(ctx, oidc.FakeName, code, state); client.ErrorCode(err) != auth.CodeInvalidOAuthState {
+		t.Fatalf("got %v, want %s", err, auth.CodeInvalidOAuthState)
+	}
+}
+
+func TestOAuthStateExpires(t *testing.T) {
+	o := newOAuthTest(t)
+	ctx := context.Background()
+
+	c := o.client()
+	authUrl, err := c.StartOAuth(ctx, oidc.FakeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := o.authorize(t, authUrl, "dave@example.com")
+
+	if _, err := o.pool.Exec(ctx, `UPDATE OAuthState SET expires_at = current_timestamp - interval '1 second'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FinishOAuth(ctx, oidc.FakeName, code, state); client.ErrorCode(err) != auth.CodeInvalidOAuthState {
+		t.Fatalf("got %v, want %s", err, auth.CodeInvalidOAuthState)
+	}
+}
+
+func TestOAuthStateIsBoundToBrowser(t *testing.T) {
+	o := newOAuthTest(t)
+	ctx := context.Background()
+
+	// Attacker starts sign in and hands code and state of their account to the victim
+	attacker := o.client()
+	authUrl, err := attacker.StartOAuth(ctx, oidc.FakeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := o.authorize(t, authUrl, "mallory@example.com")
+
+	victim := o.client()
+	if _, err := victim.FinishOAuth(ctx, oidc.FakeName, code, state); client.ErrorCode(err) != auth.CodeInvalidOAuthState {
+		t.Fatalf("got %v, want %s", err, auth.CodeInvalidOAuthState)
+	}
+}
+
+// stateJar sends state cookie it's given whatever the server sets
+type stateJar struct {
+	state string
+}
+
+func (j *stateJar) SetCookies(_ *url.URL, cookies []*http.Cookie) {
+	for _, c := range cookies {
+		if c.Name == "oauth_state" {
+			j.state = c.Value
+		}
+	}
+}
+
+func (j *stateJar) Cookies(_ *url.URL) []*http.Cookie {
+	if j.state == "" {
+		return nil
+	}
+	return []*http.Cookie{{Name: "oauth_state", Value: j.state}}
+}
@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/openapi"
+)
+
+// Spec is OpenAPI document of auth api, it has to be changed together with routes of NewController
+func Spec() *openapi.Document {
+	message := struct {
+		Message string `json:"message"`
+	}{}
+
+	d := openapi.New("Auth service", "0.1.0").
+		Enum(jwtauth.RoleUser, jwtauth.RoleModerator, jwtauth.RoleAdmin).
+		Enum(ExportPending, ExportReady, ExportFailed, ExportExpired)
+
+	d.Add(http.MethodPost, "/signin", openapi.Route{
+		Summary:     "Sign in with username or email and password",
+		Description: "Failed attempts lock the account and the client address for a while, 429 has Retry-After header. Accounts with two-factor authentication get a challenge instead of tokens",
+		Request:     SignInRequest{},
+		Response:    SignInResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+	})
+	d.Add(http.MethodPost, "/signin/2fa", openapi.Route{
+		Summary:     "Finish sign in with challenge and two-factor code",
+		Description: "Wrong codes are counted like wrong passwords, the challenge stays valid until it expires",
+		Request:     SignInTwoFactorRequest{},
+		Response:    TokenResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusTooManyRequests},
+	})
+	d.Add(http.MethodPost, "/signup", openapi.Route{
+		Summary:  "Create account and sign in",
+		Request:  SignUpRequest{},
+		Status:   http.StatusCreated,
+		Response: TokenResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict},
+	})
+	d.Add(http.MethodPost, "/refresh", openapi.Route{
+		Summary:     "Exchange refresh token for a new token pair",
+		Description: "Refresh token can be used once, reusing it revokes every refresh token of the account",
+		Request:     RefreshRequest{},
+		Response:    TokenResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+	})
+	d.Add(http.MethodGet, "/revoked", openapi.Route{
+		Summary:  "List revoked access tokens that are not expired yet",
+		Security: openapi.SecurityInternal,
+		Response: jwtauth.RevokedTokensResponse{},
+		Errors:   []int{http.StatusUnauthorized},
+	})
+	d.Add(http.MethodGet, "/.well-known/jwks.json", openapi.Route{
+		Summary:  "Public keys access tokens are signed with",
+		Response: &openapi.Schema{Type: "object", Description: "JSON Web Key Set"},
+	})
+	d.Add(http.MethodPost, "/signout", openapi.Route{
+		Summary:  "Revoke access token and refresh tokens",
+		Security: openapi.SecurityBearer,
+		Request:  SignOutRequest{},
+		Response: message,
+		Errors:   []int{http.StatusBadRequest},
+	})
+	d.Add(http.MethodGet, "/me", openapi.Route{
+		Summary:  "Account of the access token",
+		Security: openapi.SecurityBearer,
+		Response: MeRequest{},
+		Errors:   []int{http.StatusNotFound},
+	})
+	d.Add(http.MethodPatch, "/me", openapi.Route{
+		Summary:     "Change username and names of the account",
+		Description: "Fields missing from the body stay the same",
+		Security:    openapi.SecurityBearer,
+		Request:     UpdateMeRequest{},
+		Response:    MeRequest{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	})
+	d.Add(http.MethodDelete, "/me", openapi.Route{
+		Summary:     "Delete the account",
+		Description: "Account is signed out everywhere and anonymised after 30 days unless deletion is cancelled. Campaigns and payments keep referencing it",
+		Security:    openapi.SecurityBearer,
+		Request:     DeleteMeRequest{},
+		Status:      http.StatusAccepted,
+		Response:    DeleteMeResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests},
+	})
+	d.Add(http.MethodPost, "/me/restore", openapi.Route{
+		Summary:  "Cancel scheduled deletion of the account",
+		Security: openapi.SecurityBearer,
+		Response: MeRequest{},
+		Errors:   []int{http.StatusNotFound, http.StatusConflict},
+	})
+	d.Add(http.MethodPost, "/me/password", openapi.Route{
+		Summary:     "Change password",
+		Description: "Wrong current passwords are counted like failed sign in attempts. Other sessions are signed out, the current one gets a new token pair",
+		Security:    openapi.SecurityBearer,
+		Request:     ChangePasswordRequest{},
+		Response:    TokenResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusTooManyRequests},
+	})
+	d.Add(http.MethodPost, "/me/email", openapi.Route{
+		Summary:     "Send confirmation link to a new email",
+		Description: "Account keeps its current email until the link is followed",
+		Security:    openapi.SecurityBearer,
+		Request:     ChangeEmailRequest{},
+		Status:      http.StatusAccepted,
+		Response:    message,
+		Errors:      []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests, http.StatusBadGateway},
+	})
+	d.Add(http.MethodPost, "/me/export", openapi.Route{
+		Summary:     "Request export of personal data",
+		Description: "Archive with data of every service is built in background, its download link is emailed and expires in 7 days",
+		Security:    openapi.SecurityBearer,
+		Status:      http.StatusAccepted,
+		Response:    DataExportResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusConflict},
+	})
+	d.Add(http.MethodGet, "/me/exports", openapi.Route{
+		Summary:  "List personal data exports of the account",
+		Security: openapi.SecurityBearer,
+		Response: ListDataExportsResponse{},
+		Errors:   []int{http.StatusNotFound},
+	})
+	d.Add(http.MethodGet, "/me/export/download", openapi.Route{
+		Summary:     "Download personal data export with token of the emailed link",
+		Description: "Zip archive of json files, account.json of auth service and a file of every other service",
+		Params:      []openapi.Parameter{openapi.QueryParam("token", openapi.String(), "token of the emailed link")},
+		Response:    &openapi.Schema{Type: "string", Format: "binary"},
+		ContentType: "application/zip",
+		Errors:      []int{http.StatusNotFound},
+	})
+	d.Add(http.MethodPost, "/me/email/confirm", openapi.Route{
+		Summary:     "Change email with token of confirmation email",
+		Description: "Access tokens carry email verification, so they have to be refreshed afterwards",
+		Request:     VerifyEmailRequest{},
+		Response:    message,
+		Errors:      []int{http.StatusBadRequest, http.StatusConflict},
+	})
+
+	d.Add(http.MethodPost, "/verify-email", openapi.Route{
+		Summary:     "Verify email with token of verification email",
+		Description: "Access tokens carry email verification, so they have to be refreshed afterwards",
+		Request:     VerifyEmailRequest{},
+		Response:    message,
+		Errors:      []int{http.StatusBadRequest},
+	})
+	d.Add(http.MethodPost, "/verify-email/resend", openapi.Route{
+		Summary:     "Send a new verification email",
+		Description: "Links of earlier verification emails stop working",
+		Security:    openapi.SecurityBearer,
+		Status:      http.StatusAccepted,
+		Response:    message,
+		Errors:      []int{http.StatusNotFound, http.StatusConflict, http.StatusBadGateway},
+	})
+	d.Add(http.MethodPost, "/password/forgot", openapi.Route{
+		Summary:     "Send password reset email",
+		Description: "Response is the same whether the email belongs to an account or not",
+		Request:     ForgotPasswordRequest{},
+		Status:      http.StatusAccepted,
+		Response:    message,
+		Errors:      []int{http.StatusBadRequest},
+	})
+	d.Add(http.MethodPost, "/password/reset", openapi.Route{
+		Summary:     "Set a new password with token of password reset email",
+		Description: "Every refresh token of the account is revoked",
+		Request:     ResetPasswordRequest{},
+		Response:    message,
+		Errors:      []int{http.StatusBadRequest},
+	})
+	d.Add(http.MethodPost, "/2fa/enroll", openapi.Route{
+		Summary:     "Create two-factor secret and recovery codes",
+		Description: "Secret is enabled after it's confirmed, enrolling again before that replaces it",
+		Security:    openapi.SecurityBearer,
+		Response:    EnrollTwoFactorResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusConflict},
+	})
+	twoFactorErrors := []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests}
+	d.Add(http.MethodPost, "/2fa/confirm", openapi.Route{
+		Summary:  "Enable two-factor authentication with the first code",
+		Security: openapi.SecurityBearer,
+		Request:  TwoFactorCodeRequest{},
+		Response: message,
+		Errors:   twoFactorErrors,
+	})
+	d.Add(http.MethodPost, "/2fa/disable", openapi.Route{
+		Summary:  "Disable two-factor authentication",
+		Security: openapi.SecurityBearer,
+		Request:  TwoFactorCodeRequest{},
+		Response: message,
+		Errors:   twoFactorErrors,
+	})
+	d.Add(http.MethodPost, "/2fa/step-up", openapi.Route{
+		Summary:     "Get access token proving a recent two-factor check",
+		Description: "Payouts require such token",
+		Security:    openapi.SecurityBearer,
+		Request:     TwoFactorCodeRequest{},
+		Response:    StepUpResponse{},
+		Errors:      twoFactorErrors,
+	})
+	provider := openapi.PathParam("provider", openapi.String(), "name of OIDC provider, e.g. google")
+	d.Add(http.MethodGet, "/oauth/providers", openapi.Route{
+		Summary:  "List OIDC providers accounts can sign in with",
+		Response: OAuthProvidersResponse{},
+	})
+	d.Add(http.MethodPost, "/oauth/{provider}/start", openapi.Route{
+		Summary: "Start sign in with OIDC provider",
+		Description: "Provider sends the browser back to the app with code and state, they are valid for 10 minutes. " +
+			"Response sets oauth_state cookie, callback is accepted only with it",
+		Params:   []openapi.Parameter{provider},
+		Response: OAuthStartResponse{},
+		Errors:   []int{http.StatusNotFound, http.StatusBadGateway},
+	})
+	d.Add(http.MethodPost, "/oauth/{provider}/callback", openapi.Route{
+		Summary: "Finish sign in with code and state given by OIDC provider",
+		Description: "Account is created on the first sign in, unless the email belongs to an account, " +
+			"which has to sign in and link the provider. Accounts with two-factor authentication get a challenge instead of tokens",
+		Params:   []openapi.Parameter{provider},
+		Request:  OAuthCallbackRequest{},
+		Response: SignInResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway},
+	})
+	d.Add(http.MethodGet, "/identities", openapi.Route{
+		Summary:  "List OIDC identities linked to the account",
+		Security: openapi.SecurityBearer,
+		Response: ListIdentitiesResponse{},
+	})
+	d.Add(http.MethodPost, "/identities/{provider}/start", openapi.Route{
+		Summary:  "Start linking identity of OIDC provider",
+		Security: openapi.SecurityBearer,
+		Params:   []openapi.Parameter{provider},
+		Response: OAuthStartResponse{},
+		Errors:   []int{http.StatusNotFound, http.StatusBadGateway},
+	})
+	d.Add(http.MethodPost, "/identities/{provider}/callback", openapi.Route{
+		Summary:  "Link identity with code and state given by OIDC provider",
+		Security: openapi.SecurityBearer,
+		Params:   []openapi.Parameter{provider},
+		Request:  OAuthCallbackRequest{},
+		Status:   http.StatusCreated,
+		Response: IdentityResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway},
+	})
+	d.Add(http.MethodDelete, "/identities/{provider}", openapi.Route{
+		Summary:     "Unlink identity of OIDC provider",
+		Description: "Accounts created by the provider need password reset to sign in afterwards",
+		Security:    openapi.SecurityBearer,
+		Params:      []openapi.Parameter{provider},
+		Response:    message,
+		Errors:      []int{http.StatusNotFound},
+	})
+
+	accountId := openapi.PathParam("accountId", &openapi.Schema{Type: "string", Format: "uuid"}, "")
+	d.Add(http.MethodGet, "/admin/audit", audit.Route())
+	d.Add(http.MethodGet, "/admin/lockouts", openapi.Route{
+		Summary:  "List locked accounts, unknown logins and client addresses",
+		Security: openapi.SecurityBearer,
+		Response: ListLockoutsResponse{},
+		Errors:   []int{http.StatusForbidden},
+	})
+	d.Add(http.MethodDelete, "/admin/lockouts/{kind}/{key}", openapi.Route{
+		Summary:  "Clear lockout and forget failed attempts",
+		Security: openapi.SecurityBearer,
+		Params: []openapi.Parameter{
+			openapi.PathParam("kind", &openapi.Schema{Type: "string", Enum: []any{ThrottleAccount, ThrottleLogin, ThrottleIP}}, ""),
+			openapi.PathParam("key", openapi.String(), "account id, lowercase login or client address"),
+		},
+		Response: message,
+		Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	})
+	d.Add(http.MethodPost, "/admin/accounts/{accountId}/suspend", openapi.Route{
+		Summary:     "Suspend account",
+		Description: "Refresh tokens of the account are revoked, access tokens stay valid until they expire. Moderators suspend users only",
+		Security:    openapi.SecurityBearer,
+		Params:      []openapi.Parameter{accountId},
+		Request:     SuspendAccountRequest{},
+		Response:    AccountResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	})
+	d.Add(http.MethodPost, "/admin/accounts/{accountId}/unsuspend", openapi.Route{
+		Summary:  "Lift account suspension",
+		Security: openapi.SecurityBearer,
+		Params:   []openapi.Parameter{accountId},
+		Request:  SuspendAccountRequest{},
+		Response: AccountResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	})
+	d.Add(http.MethodPut, "/admin/accounts/{accountId}/role", openapi.Route{
+		Summary:     "Change account role",
+		Description: "New role is put into access tokens on the next refresh",
+		Security:    openapi.SecurityBearer,
+		Params:      []openapi.Parameter{accountId},
+		Request:     SetAccountRoleRequest{},
+		Response:    AccountResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	})
+
+	return d
+}
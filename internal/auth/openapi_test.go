@@ -0,0 +1,17 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/openapi"
+)
+
+func TestSpecMatchesRoutes(t *testing.T) {
+	c := NewController(nil, jwtauth.New(jwa.HS256, []byte("secret")), nil, nil, "", nil, "token")
+
+	if err := openapi.Verify(c.Routes(), Spec()); err != nil {
+		t.Fatal(err)
+	}
+}
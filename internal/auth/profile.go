@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UpdateMe changes username and names of the account, fields missing from the body stay the same
+func (a *Controller) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	var req UpdateMeRequest
+
+	user, err := a.currentAccount(r)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Username != nil && *req.Username != user.Username && reservedUsername(*req.Username) {
+		response.WriteProblem(w, r, ErrUsernameReserved)
+		return
+	}
+
+	user, err = a.account.Update(r.Context(), user.Id, req.Username, req.FirstName, req.LastName)
+	if err != nil {
+		if isUniqueViolation(err) {
+			response.WriteProblem(w, r, ErrAccountExists.WithDetail("username is taken"))
+			return
+		}
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	a.writeMe(w, r, user)
+}
+
+// ChangePassword sets a new password after checking the current one. Other sessions are signed out,
+// the current one gets a new token pair
+func (a *Controller) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+
+	user, err := a.currentAccount(r)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !a.checkPassword(w, r, user, req.CurrentPassword) {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	var tokens *TokenResponse
+	err = db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		if err := a.account.SetPassword(ctx, user.Id, string(hash)); err != nil {
+			return err
+		}
+		if err := a.accountToken.RevokeAll(ctx, user.Id, PurposeResetPassword); err != nil {
+			return err
+		}
+		if err := a.refreshToken.RevokeAllByAccountId(ctx, user.Id); err != nil {
+			return err
+		}
+		tokens, err = a.issueTokens(ctx, user, time.Time{})
+		return err
+	})
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	response.Json(w, tokens)
+}
+
+// ChangeEmail sends confirmation link to the new email, the account keeps its current email until
+// the link is followed
+func (a *Controller) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req ChangeEmailRequest
+
+	user, err := a.currentAccount(r)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !a.checkPassword(w, r, user, req.Password) {
+		return
+	}
+
+	if _, err := a.account.FindByUsernameOrEmail(r.Context(), req.Email); err == nil {
+		response.WriteProblem(w, r, ErrAccountExists.WithDetail("email is taken"))
+		return
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	user, err = a.account.SetPendingEmail(r.Context(), user.Id, req.Email)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Link goes to the new email, following it proves the address
+	pending := *user
+	pending.Email = req.Email
+	if err := a.sendToken(r.Context(), &pending, PurposeChangeEmail); err != nil {
+		response.Error(w, r, http.StatusBadGateway, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	response.Message(w, "Confirmation email is sent to the new email")
+}
+
+// ConfirmEmailChange replaces email of the token's account with the pending one. It's already verified,
+// access tokens carry verification, so client has to refresh them afterwards
+func (a *Controller) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	err := db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		t, err := a.accountToken.Use(ctx, PurposeChangeEmail, hashToken(req.Token))
+		if err != nil {
+			return err
+		}
+		_, err = a.account.ConfirmEmail(ctx, t.AccountId)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrInvalidEmailToken)
+		case isUniqueViolation(err):
+			// Another account took the email after the link was sent
+			response.WriteProblem(w, r, ErrAccountExists.WithDetail("email is taken"))
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	response.Message(w, "Email changed successfully")
+}
+
+// DeleteMe schedules anonymisation of the account after the grace period and signs it out everywhere.
+// Signing in again and calling /me/restore cancels deletion until then
+func (a *Controller) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	var req DeleteMeRequest
+
+	user, err := a.currentAccount(r)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if user.DeletionScheduledAt != nil {
+		response.WriteProblem(w, r, ErrDeletionScheduled)
+		return
+	}
+
+	if !a.checkPassword(w, r, user, req.Password) {
+		return
+	}
+
+	err = db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		user, err = a.account.ScheduleDeletion(ctx, user.Id, time.Now().Add(deletionGracePeriod))
+		if err != nil {
+			return err
+		}
+		return a.refreshToken.RevokeAllByAccountId(ctx, user.Id)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrAccountNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	response.Json(w, &DeleteMeResponse{DeletionScheduledAt: *user.DeletionScheduledAt})
+}
+
+// RestoreMe cancels scheduled deletion of the account
+func (a *Controller) RestoreMe(w http.ResponseWriter, r *http.Request) {
+	user, err := a.currentAccount(r)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if user.DeletionScheduledAt == nil {
+		response.WriteProblem(w, r, ErrDeletionNotFound)
+		return
+	}
+
+	user, err = a.account.ScheduleDeletion(r.Context(), user.Id, time.Time{})
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrAccountNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	a.writeMe(w, r, user)
+}
+
+// currentAccount returns account of the access token, anonymised accounts are not found
+func (a *Controller) currentAccount(r *http.Request) (*Account, error) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return nil, response.NewProblem(http.StatusUnauthorized, response.CodeUnauthorized, err.Error())
+	}
+
+	user, err := a.account.GetByUUID(r.Context(), token.Subject())
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrAccountNotFound
+	}
+	return user, nil
+}
+
+// checkPassword checks password of the signed in account, wrong passwords count as failed sign in attempts.
+// Returns false if response is already written
+func (a *Controller) checkPassword(w http.ResponseWriter, r *http.Request, user *Account, password string) bool {
+	account, ip := throttleKey{ThrottleAccount, user.Id}, throttleKey{ThrottleIP, clientIP(r)}
+	until, err := a.lockedUntil(r.Context(), account, ip)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return false
+	}
+	if until != nil {
+		writeLocked(w, r, *until)
+		return false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		if err := a.fail(r.Context(), account, ip); err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return false
+		}
+		response.WriteProblem(w, r, ErrInvalidCredentials.WithDetail("invalid password"))
+		return false
+	}
+
+	if err := a.throttle.Clear(r.Context(), account.kind, account.key); err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+)
+
+func TestChangePassword(t *testing.T) {
+	a := newAuthTest(t)
+	ctx := context.Background()
+	c := a.signUp(t, "alice")
+	other := a.client()
+	if _, err := other.SignIn(ctx, &client.SignInRequest{UsernameOrEmail: "alice", Password: password}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ChangePassword(ctx, "wrong password", "new password"); client.ErrorCode(err) != auth.CodeInvalidCredentials {
+		t.Fatalf("got %v, want %s", err, auth.CodeInvalidCredentials)
+	}
+	if _, err := c.ChangePassword(ctx, password, "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Me(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.client().SignIn(ctx, &client.SignInRequest{UsernameOrEmail: "alice", Password: password}); client.ErrorCode(err) != auth.CodeInvalidCredentials {
+		t.Fatalf("old password: got %v, want %s", err, auth.CodeInvalidCredentials)
+	}
+	if _, err := a.client().SignIn(ctx, &client.SignInRequest{UsernameOrEmail: "alice", Password: "new password"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other session is signed out, its refresh token doesn't work anymore
+	stale := a.client().WithTokens(&client.TokenResponse{RefreshToken: other.Tokens().RefreshToken})
+	if _, err := stale.Me(ctx); client.ErrorCode(err) != auth.CodeRefreshTokenUsed {
+		t.Fatalf("other session: got %v, want %s", err, auth.CodeRefreshTokenUsed)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	a := newAuthTest(t)
+	ctx := context.Background()
+	c := a.signUp(t, "alice")
+	a.signUp(t, "bob")
+
+	if err := c.ChangeEmail(ctx, email("bob"), password); client.ErrorCode(err) != auth.CodeAccountExists {
+		t.Fatalf("taken email: got %v, want %s", err, auth.CodeAccountExists)
+	}
+	if err := c.ChangeEmail(ctx, "alice@example.org", "wrong password"); client.ErrorCode(err) != auth.CodeInvalidCredentials {
+		t.Fatalf("wrong password: got %v, want %s", err, auth.CodeInvalidCredentials)
+	}
+	if err := c.ChangeEmail(ctx, "alice@example.org", password); err != nil {
+		t.Fatal(err)
+	}
+
+	// Account keeps its email until the link sent to the new one is followed
+	me, err := c.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me.Email != email("alice") {
+		t.Fatalf("email is %s before confirmation, want %s", me.Email, email("alice"))
+	}
+
+	token := a.mailToken(t, "alice@example.org", "/confirm-email")
+	if err := c.ConfirmEmailChange(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ConfirmEmailChange(ctx, token); client.ErrorCode(err) != auth.CodeInvalidEmailToken {
+		t.Fatalf("used token: got %v, want %s", err, auth.CodeInvalidEmailToken)
+	}
+
+	if me, err = c.Me(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if me.Email != "alice@example.org" || !me.EmailVerified {
+		t.Fatalf("email is %s, verified: %t, want verified alice@example.org", me.Email, me.EmailVerified)
+	}
+	if _, err := a.client().SignIn(ctx, &client.SignInRequest{UsernameOrEmail: "alice@example.org", Password: password}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,8 +2,9 @@ package auth
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -17,22 +18,51 @@ const (
 )
 
 type Account struct {
-	Id        string    `db:"id"`
-	Username  string    `db:"username"`
-	Email     string    `db:"email"`
-	FirstName string    `db:"first_name"`
-	LastName  string    `db:"last_name"`
-	Password  string    `db:"password"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	Id        string       `db:"id"`
+	Username  string       `db:"username"`
+	Email     string       `db:"email"`
+	FirstName string       `db:"first_name"`
+	LastName  string       `db:"last_name"`
+	Password  string       `db:"password"`
+	CreatedAt time.Time    `db:"created_at"`
+	UpdatedAt time.Time    `db:"updated_at"`
+	Role      jwtauth.Role `db:"role"`
+	// SuspendedAt is set while account is suspended by staff
+	SuspendedAt *time.Time `db:"suspended_at"`
+	// EmailVerifiedAt is set once account follows the link of verification email
+	EmailVerifiedAt *time.Time `db:"email_verified_at"`
+	// PendingEmail replaces Email once it's confirmed
+	PendingEmail *string `db:"pending_email"`
+	// DeletionScheduledAt is set while account waits for anonymisation, DeletedAt once it's anonymised
+	DeletionScheduledAt *time.Time `db:"deletion_scheduled_at"`
+	DeletedAt           *time.Time `db:"deleted_at"`
 }
 
 type AccountModel interface {
-	GetByUUID(string) (*Account, error)
-	GetByUsername(string) (*Account, error)
-	HasUsername(string) error
-	Create(*Account) error
-	FindByUsernameOrEmail(string) (*Account, error)
+	GetByUUID(ctx context.Context, id string) (*Account, error)
+	GetByUsername(ctx context.Context, username string) (*Account, error)
+	HasUsername(ctx context.Context, username string) error
+	Create(context.Context, *Account) error
+	FindByUsernameOrEmail(ctx context.Context, usernameOrEmail string) (*Account, error)
+	SetRole(ctx context.Context, id string, role jwtauth.Role) (*Account, error)
+	// SetSuspended suspends the account or lifts its suspension
+	SetSuspended(ctx context.Context, id string, suspended bool) (*Account, error)
+	MarkEmailVerified(ctx context.Context, id string) (*Account, error)
+	// SetPassword replaces password hash of the account
+	SetPassword(ctx context.Context, id string, hash string) error
+	// Update changes names of the account, nil fields stay the same
+	Update(ctx context.Context, id string, username, firstName, lastName *string) (*Account, error)
+	SetPendingEmail(ctx context.Context, id string, email string) (*Account, error)
+	// ConfirmEmail replaces email with the pending one and marks it verified,
+	// returns pgx.ErrNoRows if there is no pending email
+	ConfirmEmail(ctx context.Context, id string) (*Account, error)
+	// ScheduleDeletion schedules anonymisation of the account, zero at cancels it
+	ScheduleDeletion(ctx context.Context, id string, at time.Time) (*Account, error)
+	// ListDueDeletion returns ids of accounts whose deletion time has come
+	ListDueDeletion(ctx context.Context, limit int) ([]string, error)
+	// Anonymise removes personal data of the account and everything it signs in with,
+	// the row stays so campaigns and payments keep referencing it
+	Anonymise(ctx context.Context, id string) error
 
 	//Truncate() error
 }
@@ -41,51 +71,776 @@ type accountModel struct {
 	db *pgxpool.Pool
 }
 
-func (u *accountModel) GetByUUID(uuid string) (*Account, error) {
+func NewAccountModel(db *pgxpool.Pool) AccountModel {
+	return &accountModel{db}
+}
+
+func (u *accountModel) GetByUUID(ctx context.Context, uuid string) (*Account, error) {
 	query := `SELECT * FROM account WHERE id = $1`
 
-	return db.QueryOneRowToAddrStruct[Account](context.Background(), u.db, query, uuid)
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, uuid)
 }
 
-func (u *accountModel) GetByUsername(username string) (*Account, error) {
+func (u *accountModel) GetByUsername(ctx context.Context, username string) (*Account, error) {
 	query := `SELECT * FROM account WHERE username = $1`
 
-	return db.QueryOneRowToAddrStruct[Account](context.Background(), u.db, query, username)
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, username)
 }
 
-func (u *accountModel) HasUsername(username string) error {
+func (u *accountModel) HasUsername(ctx context.Context, username string) error {
 	var exists bool
 
 	query := `SELECT EXISTS(SELECT 1 FROM account WHERE username = $1)`
 
-	if err := u.db.QueryRow(context.Background(), query, pgx.QueryResultFormats{pgx.TextFormatCode}, username).Scan(&exists); err != nil {
+	if err := db.Conn(ctx, u.db).QueryRow(ctx, query, pgx.QueryResultFormats{pgx.TextFormatCode}, username).Scan(&exists); err != nil {
 		return err
 	}
 
 	if exists {
-		return fmt.Errorf("username already exists: %s", username)
+		return ErrAccountExists.WithDetail("username already exists: %s", username)
 	} else {
 		return nil
 	}
 }
 
-func (u *accountModel) FindByUsernameOrEmail(usernameOrEmail string) (*Account, error) {
+func (u *accountModel) FindByUsernameOrEmail(ctx context.Context, usernameOrEmail string) (*Account, error) {
 	query := `SELECT * FROM account WHERE username = $1 OR email = $1`
 
-	return db.QueryOneRowToAddrStruct[Account](context.Background(), u.db, query, usernameOrEmail)
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, usernameOrEmail)
 }
 
-func (u *accountModel) Create(account *Account) error {
+func (u *accountModel) Create(ctx context.Context, account *Account) error {
 	sql :=
 		`INSERT INTO account (username, email, first_name, last_name, password) VALUES ($1, $2, $3, $4, $5) RETURNING id`
 
-	if _, err := u.db.Exec(context.Background(), sql, account.Username, account.Email, account.FirstName, account.LastName, account.Password); err != nil {
+	if _, err := db.Conn(ctx, u.db).Exec(ctx, sql, account.Username, account.Email, account.FirstName, account.LastName, account.Password); err != nil {
 		return err
 	}
 	return nil
 }
 
+func (u *accountModel) SetRole(ctx context.Context, id string, role jwtauth.Role) (*Account, error) {
+	query := `UPDATE account SET role = $2, updated_at = current_timestamp WHERE id = $1 RETURNING *`
+
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, id, role)
+}
+
+func (u *accountModel) SetSuspended(ctx context.Context, id string, suspended bool) (*Account, error) {
+	query :=
+		`UPDATE account SET suspended_at = CASE WHEN $2 THEN COALESCE(suspended_at, current_timestamp) END,
+		updated_at = current_timestamp WHERE id = $1 RETURNING *`
+
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, id, suspended)
+}
+
+// MarkEmailVerified keeps the time of the first verification if email is already verified
+func (u *accountModel) MarkEmailVerified(ctx context.Context, id string) (*Account, error) {
+	query :=
+		`UPDATE account SET email_verified_at = COALESCE(email_verified_at, current_timestamp),
+		updated_at = current_timestamp WHERE id = $1 RETURNING *`
+
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, id)
+}
+
+func (u *accountModel) SetPassword(ctx context.Context, id string, hash string) error {
+	query := `UPDATE account SET password = $2, updated_at = current_timestamp WHERE id = $1`
+
+	return db.Exec(ctx, db.Conn(ctx, u.db), query, id, hash)
+}
+
+func (u *accountModel) Update(ctx context.Context, id string, username, firstName, lastName *string) (*Account, error) {
+	query :=
+		`UPDATE account SET username = COALESCE($2, username), first_name = COALESCE($3, first_name),
+		last_name = COALESCE($4, last_name) WHERE id = $1 RETURNING *`
+
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, id, username, firstName, lastName)
+}
+
+func (u *accountModel) SetPendingEmail(ctx context.Context, id string, email string) (*Account, error) {
+	query := `UPDATE account SET pending_email = $2 WHERE id = $1 RETURNING *`
+
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, id, email)
+}
+
+func (u *accountModel) ConfirmEmail(ctx context.Context, id string) (*Account, error) {
+	query :=
+		`UPDATE account SET email = pending_email, pending_email = NULL, email_verified_at = current_timestamp
+		WHERE id = $1 AND pending_email IS NOT NULL RETURNING *`
+
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, id)
+}
+
+func (u *accountModel) ScheduleDeletion(ctx context.Context, id string, at time.Time) (*Account, error) {
+	var scheduled *time.Time
+	if !at.IsZero() {
+		scheduled = &at
+	}
+	query := `UPDATE account SET deletion_scheduled_at = $2 WHERE id = $1 AND deleted_at IS NULL RETURNING *`
+
+	return db.QueryOne[Account](ctx, db.Conn(ctx, u.db), query, id, scheduled)
+}
+
+func (u *accountModel) ListDueDeletion(ctx context.Context, limit int) ([]string, error) {
+	query :=
+		`SELECT id FROM account WHERE deletion_scheduled_at <= current_timestamp AND deleted_at IS NULL
+		ORDER BY deletion_scheduled_at LIMIT $1`
+
+	rows, err := db.Conn(ctx, u.db).Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (u *accountModel) Anonymise(ctx context.Context, id string) error {
+	return db.WithTx(ctx, u.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, u.db)
+
+		// Username and email are derived from the id, so they stay unique. Empty password matches nothing
+		query :=
+			`UPDATE account SET username = $2 || left(replace(id::TEXT, '-', ''), 24),
+			email = replace(id::TEXT, '-', '') || '@deleted.invalid', first_name = '', last_name = '', password = '',
+			role = 'user', email_verified_at = NULL, pending_email = NULL, deletion_scheduled_at = NULL,
+			deleted_at = current_timestamp
+			WHERE id = $1 AND deleted_at IS NULL`
+		if err := db.Exec(ctx, tx, query, id, DeletedUsernamePrefix); err != nil {
+			return err
+		}
+
+		for _, query := range []string{
+			`UPDATE RefreshToken SET revoked_at = current_timestamp WHERE account_id = $1 AND revoked_at IS NULL`,
+			`DELETE FROM AccountToken WHERE account_id = $1`,
+			`DELETE FROM AccountTotp WHERE account_id = $1`,
+			`DELETE FROM AccountIdentity WHERE account_id = $1`,
+			`DELETE FROM OAuthState WHERE account_id = $1`,
+			`DELETE FROM DataExport WHERE account_id = $1`,
+			`DELETE FROM LoginThrottle WHERE kind = 'account' AND key = $1::TEXT`,
+		} {
+			if err := db.Exec(ctx, tx, query, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 //func (u *accountModel) Truncate() error {
 //	_, err := u.db.Exec(context.Background(), `TRUNCATE TABLE "user"`)
 //	return err
 //}
+
+type RefreshToken struct {
+	Id        int        `db:"id"`
+	AccountId string     `db:"account_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+type RefreshTokenModel interface {
+	Create(context.Context, *RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	Revoke(ctx context.Context, id int) error
+	RevokeAllByAccountId(ctx context.Context, accountId string) error
+}
+
+type refreshTokenModel struct {
+	db *pgxpool.Pool
+}
+
+func (rm *refreshTokenModel) Create(ctx context.Context, t *RefreshToken) error {
+	query :=
+		`INSERT INTO RefreshToken (account_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+
+	_, err := db.Conn(ctx, rm.db).Exec(ctx, query, t.AccountId, t.TokenHash, t.ExpiresAt)
+	return err
+}
+
+func (rm *refreshTokenModel) GetByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	query := `SELECT * FROM RefreshToken WHERE token_hash = $1`
+
+	return db.QueryOne[RefreshToken](ctx, db.Conn(ctx, rm.db), query, hash)
+}
+
+// Revoke marks refresh token as used, returns pgx.ErrNoRows if token was already revoked,
+// so two concurrent refreshes with the same token can't both succeed
+func (rm *refreshTokenModel) Revoke(ctx context.Context, id int) error {
+	query :=
+		`UPDATE RefreshToken SET revoked_at = current_timestamp WHERE id = $1 AND revoked_at IS NULL`
+
+	tag, err := db.Conn(ctx, rm.db).Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (rm *refreshTokenModel) RevokeAllByAccountId(ctx context.Context, accountId string) error {
+	query :=
+		`UPDATE RefreshToken SET revoked_at = current_timestamp WHERE account_id = $1 AND revoked_at IS NULL`
+
+	_, err := db.Conn(ctx, rm.db).Exec(ctx, query, accountId)
+	return err
+}
+
+type TokenPurpose string
+
+const (
+	PurposeVerifyEmail   TokenPurpose = "verify_email"
+	PurposeResetPassword TokenPurpose = "reset_password"
+	// PurposeSignIn is challenge of two-step sign in, it's redeemed with two-factor code
+	PurposeSignIn TokenPurpose = "sign_in"
+	// PurposeChangeEmail confirms pending email, it's sent to the new address
+	PurposeChangeEmail TokenPurpose = "change_email"
+)
+
+// AccountToken is a single-use token sent to account email, e.g. to verify it or to reset password
+type AccountToken struct {
+	Id        int          `db:"id"`
+	AccountId string       `db:"account_id"`
+	Purpose   TokenPurpose `db:"purpose"`
+	TokenHash string       `db:"token_hash"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	UsedAt    *time.Time   `db:"used_at"`
+	CreatedAt time.Time    `db:"created_at"`
+}
+
+type AccountTokenModel interface {
+	Create(context.Context, *AccountToken) error
+	// Get returns unused and unexpired token of the purpose, pgx.ErrNoRows otherwise
+	Get(ctx context.Context, purpose TokenPurpose, hash string) (*AccountToken, error)
+	// Use marks the token as used, returns pgx.ErrNoRows if there is no such token of the purpose
+	// or it's already used or expired
+	Use(ctx context.Context, purpose TokenPurpose, hash string) (*AccountToken, error)
+	// RevokeAll marks every unused token of the account with the purpose as used
+	RevokeAll(ctx context.Context, accountId string, purpose TokenPurpose) error
+}
+
+type accountTokenModel struct {
+	db *pgxpool.Pool
+}
+
+func (tm *accountTokenModel) Create(ctx context.Context, t *AccountToken) error {
+	query :=
+		`INSERT INTO AccountToken (account_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)`
+
+	return db.Exec(ctx, db.Conn(ctx, tm.db), query, t.AccountId, t.Purpose, t.TokenHash, t.ExpiresAt)
+}
+
+func (tm *accountTokenModel) Get(ctx context.Context, purpose TokenPurpose, hash string) (*AccountToken, error) {
+	query :=
+		`SELECT * FROM AccountToken
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > current_timestamp`
+
+	return db.QueryOne[AccountToken](ctx, db.Conn(ctx, tm.db), query, hash, purpose)
+}
+
+func (tm *accountTokenModel) Use(ctx context.Context, purpose TokenPurpose, hash string) (*AccountToken, error) {
+	query :=
+		`UPDATE AccountToken SET used_at = current_timestamp
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > current_timestamp RETURNING *`
+
+	return db.QueryOne[AccountToken](ctx, db.Conn(ctx, tm.db), query, hash, purpose)
+}
+
+func (tm *accountTokenModel) RevokeAll(ctx context.Context, accountId string, purpose TokenPurpose) error {
+	query :=
+		`UPDATE AccountToken SET used_at = current_timestamp WHERE account_id = $1 AND purpose = $2 AND used_at IS NULL`
+
+	return db.Exec(ctx, db.Conn(ctx, tm.db), query, accountId, purpose)
+}
+
+// AccountTotp is two-factor secret of the account, it's enabled once the first code is confirmed
+type AccountTotp struct {
+	AccountId   string     `db:"account_id"`
+	Secret      string     `db:"secret"`
+	LastCounter int64      `db:"last_counter"`
+	EnabledAt   *time.Time `db:"enabled_at"`
+	CreatedAt   time.Time  `db:"created_at"`
+}
+
+type TotpModel interface {
+	// Get returns pgx.ErrNoRows if account has no two-factor secret
+	Get(ctx context.Context, accountId string) (*AccountTotp, error)
+	// Enroll stores a new pending secret with hashes of its recovery codes, replacing earlier pending secret
+	Enroll(ctx context.Context, accountId string, secret string, codeHashes []string) error
+	Enable(ctx context.Context, accountId string) error
+	// UseCounter records counter of accepted code, returns pgx.ErrNoRows if code of the counter
+	// or a later one was already used
+	UseCounter(ctx context.Context, accountId string, counter int64) error
+	// UseRecoveryCode marks unused recovery code as used, returns pgx.ErrNoRows if there is no such code
+	UseRecoveryCode(ctx context.Context, accountId string, hash string) error
+	Delete(ctx context.Context, accountId string) error
+}
+
+type totpModel struct {
+	db *pgxpool.Pool
+}
+
+func NewTotpModel(db *pgxpool.Pool) TotpModel {
+	return &totpModel{db}
+}
+
+func (tm *totpModel) Get(ctx context.Context, accountId string) (*AccountTotp, error) {
+	query := `SELECT * FROM AccountTotp WHERE account_id = $1`
+
+	return db.QueryOne[AccountTotp](ctx, db.Conn(ctx, tm.db), query, accountId)
+}
+
+func (tm *totpModel) Enroll(ctx context.Context, accountId string, secret string, codeHashes []string) error {
+	return db.WithTx(ctx, tm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, tm.db)
+
+		query :=
+			`INSERT INTO AccountTotp (account_id, secret) VALUES ($1, $2)
+			ON CONFLICT (account_id) DO UPDATE SET secret = EXCLUDED.secret, last_counter = 0,
+			created_at = current_timestamp WHERE AccountTotp.enabled_at IS NULL`
+		tag, err := tx.Exec(ctx, query, accountId, secret)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+
+		if err := db.Exec(ctx, tx, `DELETE FROM RecoveryCode WHERE account_id = $1`, accountId); err != nil {
+			return err
+		}
+		return db.Exec(ctx, tx,
+			`INSERT INTO RecoveryCode (account_id, code_hash) SELECT $1, unnest($2::TEXT[])`, accountId, codeHashes)
+	})
+}
+
+func (tm *totpModel) Enable(ctx context.Context, accountId string) error {
+	query := `UPDATE AccountTotp SET enabled_at = current_timestamp WHERE account_id = $1 AND enabled_at IS NULL`
+
+	return db.Exec(ctx, db.Conn(ctx, tm.db), query, accountId)
+}
+
+func (tm *totpModel) UseCounter(ctx context.Context, accountId string, counter int64) error {
+	query := `UPDATE AccountTotp SET last_counter = $2 WHERE account_id = $1 AND last_counter < $2`
+
+	tag, err := db.Conn(ctx, tm.db).Exec(ctx, query, accountId, counter)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (tm *totpModel) UseRecoveryCode(ctx context.Context, accountId string, hash string) error {
+	query :=
+		`UPDATE RecoveryCode SET used_at = current_timestamp WHERE account_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	tag, err := db.Conn(ctx, tm.db).Exec(ctx, query, accountId, hash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (tm *totpModel) Delete(ctx context.Context, accountId string) error {
+	return db.Exec(ctx, db.Conn(ctx, tm.db), `DELETE FROM AccountTotp WHERE account_id = $1`, accountId)
+}
+
+type ThrottleKind string
+
+const (
+	// ThrottleAccount counts failures of existing account, ThrottleLogin of username or email without account.
+	// Both are limited the same way, so lockouts don't tell whether account exists
+	ThrottleAccount ThrottleKind = "account"
+	ThrottleLogin   ThrottleKind = "login"
+	ThrottleIP      ThrottleKind = "ip"
+)
+
+// LoginThrottle is failed sign in attempts of a key, Username is set for ThrottleAccount keys
+type LoginThrottle struct {
+	Kind         ThrottleKind `db:"kind"`
+	Key          string       `db:"key"`
+	Failures     int          `db:"failures"`
+	LastFailedAt time.Time    `db:"last_failed_at"`
+	LockedUntil  *time.Time   `db:"locked_until"`
+	Username     *string      `db:"username"`
+}
+
+type LoginThrottleModel interface {
+	// LockedUntil returns end of the key lockout, nil if it isn't locked
+	LockedUntil(ctx context.Context, kind ThrottleKind, key string) (*time.Time, error)
+	// Fail counts failed attempt and returns failures of the key, failures older than window are forgotten
+	Fail(ctx context.Context, kind ThrottleKind, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, kind ThrottleKind, key string, until time.Time) error
+	Clear(ctx context.Context, kind ThrottleKind, key string) error
+	ListLocked(ctx context.Context) ([]LoginThrottle, error)
+}
+
+type loginThrottleModel struct {
+	db *pgxpool.Pool
+}
+
+func (tm *loginThrottleModel) LockedUntil(ctx context.Context, kind ThrottleKind, key string) (*time.Time, error) {
+	query :=
+		`SELECT locked_until FROM LoginThrottle WHERE kind = $1 AND key = $2 AND locked_until > current_timestamp`
+
+	var until time.Time
+	err := db.Conn(ctx, tm.db).QueryRow(ctx, query, kind, key).Scan(&until)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &until, nil
+}
+
+func (tm *loginThrottleModel) Fail(ctx context.Context, kind ThrottleKind, key string, window time.Duration) (int, error) {
+	query :=
+		`INSERT INTO LoginThrottle (kind, key, failures) VALUES ($1, $2, 1)
+		ON CONFLICT (kind, key) DO UPDATE SET
+		failures = CASE WHEN LoginThrottle.last_failed_at < current_timestamp - make_interval(secs => $3)
+			THEN 1 ELSE LoginThrottle.failures + 1 END,
+		last_failed_at = current_timestamp
+		RETURNING failures`
+
+	var failures int
+	err := db.Conn(ctx, tm.db).QueryRow(ctx, query, kind, key, window.Seconds()).Scan(&failures)
+	return failures, err
+}
+
+func (tm *loginThrottleModel) Lock(ctx context.Context, kind ThrottleKind, key string, until time.Time) error {
+	query := `UPDATE LoginThrottle SET locked_until = $3 WHERE kind = $1 AND key = $2`
+
+	return db.Exec(ctx, db.Conn(ctx, tm.db), query, kind, key, until)
+}
+
+func (tm *loginThrottleModel) Clear(ctx context.Context, kind ThrottleKind, key string) error {
+	query := `DELETE FROM LoginThrottle WHERE kind = $1 AND key = $2`
+
+	return db.Exec(ctx, db.Conn(ctx, tm.db), query, kind, key)
+}
+
+func (tm *loginThrottleModel) ListLocked(ctx context.Context) ([]LoginThrottle, error) {
+	query :=
+		`SELECT t.*, a.username FROM LoginThrottle t
+		LEFT JOIN Account a ON t.kind = 'account' AND a.id::TEXT = t.key
+		WHERE t.locked_until > current_timestamp ORDER BY t.locked_until DESC`
+
+	return db.QueryAll[LoginThrottle](ctx, db.Conn(ctx, tm.db), query)
+}
+
+type RevokedToken struct {
+	Jti       string    `db:"jti"`
+	ExpiresAt time.Time `db:"expires_at"`
+	RevokedAt time.Time `db:"revoked_at"`
+}
+
+type RevokedTokenModel interface {
+	Create(context.Context, *RevokedToken) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	ListActive(context.Context) ([]RevokedToken, error)
+}
+
+type revokedTokenModel struct {
+	db *pgxpool.Pool
+}
+
+func (rm *revokedTokenModel) Create(ctx context.Context, t *RevokedToken) error {
+	query :=
+		`INSERT INTO RevokedToken (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+
+	_, err := db.Conn(ctx, rm.db).Exec(ctx, query, t.Jti, t.ExpiresAt)
+	return err
+}
+
+// IsRevoked implements jwtauth.RevocationList
+func (rm *revokedTokenModel) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var exists bool
+
+	query := `SELECT EXISTS(SELECT 1 FROM RevokedToken WHERE jti = $1)`
+
+	if err := db.Conn(ctx, rm.db).QueryRow(ctx, query, jti).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// ListActive returns revoked tokens that are not expired yet
+func (rm *revokedTokenModel) ListActive(ctx context.Context) ([]RevokedToken, error) {
+	query := `SELECT * FROM RevokedToken WHERE expires_at > current_timestamp`
+
+	return db.QueryAll[RevokedToken](ctx, db.Conn(ctx, rm.db), query)
+}
+
+type SigningKey struct {
+	Kid        string    `db:"kid"`
+	PrivateKey string    `db:"private_key"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type SigningKeyModel interface {
+	// Lock takes transaction advisory lock of key rotation
+	Lock(ctx context.Context) error
+	// ExistsSince reports whether a key is younger than age
+	ExistsSince(ctx context.Context, age time.Duration) (bool, error)
+	Create(context.Context, *SigningKey) error
+	// ListSince returns keys younger than age, newest first
+	ListSince(ctx context.Context, age time.Duration) ([]SigningKey, error)
+}
+
+type signingKeyModel struct {
+	db *pgxpool.Pool
+}
+
+// signingKeyLockId is the advisory lock key held while rotating keys, so replicas don't create more than one key
+const signingKeyLockId = 7340210617
+
+func (sm *signingKeyModel) Lock(ctx context.Context) error {
+	return db.Exec(ctx, db.Conn(ctx, sm.db), `SELECT pg_advisory_xact_lock($1)`, signingKeyLockId)
+}
+
+func (sm *signingKeyModel) ExistsSince(ctx context.Context, age time.Duration) (bool, error) {
+	var exists bool
+
+	query := `SELECT EXISTS(SELECT 1 FROM SigningKey WHERE created_at > current_timestamp - make_interval(secs => $1))`
+
+	if err := db.Conn(ctx, sm.db).QueryRow(ctx, query, age.Seconds()).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func (sm *signingKeyModel) Create(ctx context.Context, key *SigningKey) error {
+	query := `INSERT INTO SigningKey (kid, private_key) VALUES ($1, $2)`
+
+	return db.Exec(ctx, db.Conn(ctx, sm.db), query, key.Kid, key.PrivateKey)
+}
+
+func (sm *signingKeyModel) ListSince(ctx context.Context, age time.Duration) ([]SigningKey, error) {
+	query :=
+		`SELECT * FROM SigningKey WHERE created_at > current_timestamp - make_interval(secs => $1)
+		ORDER BY created_at DESC`
+
+	return db.QueryAll[SigningKey](ctx, db.Conn(ctx, sm.db), query, age.Seconds())
+}
+
+// AccountIdentity links account to its account at OIDC provider
+type AccountIdentity struct {
+	Provider   string    `db:"provider"`
+	Subject    string    `db:"subject"`
+	AccountId  string    `db:"account_id"`
+	Email      string    `db:"email"`
+	CreatedAt  time.Time `db:"created_at"`
+	LastUsedAt time.Time `db:"last_used_at"`
+}
+
+type IdentityModel interface {
+	Get(ctx context.Context, provider, subject string) (*AccountIdentity, error)
+	ListByAccountId(ctx context.Context, accountId string) ([]AccountIdentity, error)
+	// Create returns unique violation if the identity or identity of the provider of the account is already linked
+	Create(context.Context, *AccountIdentity) error
+	// Touch updates email and last use of the identity
+	Touch(ctx context.Context, provider, subject, email string) error
+	// Delete returns pgx.ErrNoRows if the account has no identity of the provider
+	Delete(ctx context.Context, accountId, provider string) error
+}
+
+type identityModel struct {
+	db *pgxpool.Pool
+}
+
+func (im *identityModel) Get(ctx context.Context, provider, subject string) (*AccountIdentity, error) {
+	query := `SELECT * FROM AccountIdentity WHERE provider = $1 AND subject = $2`
+
+	return db.QueryOne[AccountIdentity](ctx, db.Conn(ctx, im.db), query, provider, subject)
+}
+
+func (im *identityModel) ListByAccountId(ctx context.Context, accountId string) ([]AccountIdentity, error) {
+	query := `SELECT * FROM AccountIdentity WHERE account_id = $1 ORDER BY provider`
+
+	return db.QueryAll[AccountIdentity](ctx, db.Conn(ctx, im.db), query, accountId)
+}
+
+func (im *identityModel) Create(ctx context.Context, i *AccountIdentity) error {
+	query :=
+		`INSERT INTO AccountIdentity (provider, subject, account_id, email) VALUES ($1, $2, $3, $4)`
+
+	return db.Exec(ctx, db.Conn(ctx, im.db), query, i.Provider, i.Subject, i.AccountId, i.Email)
+}
+
+func (im *identityModel) Touch(ctx context.Context, provider, subject, email string) error {
+	query :=
+		`UPDATE AccountIdentity SET email = $3, last_used_at = current_timestamp WHERE provider = $1 AND subject = $2`
+
+	return db.Exec(ctx, db.Conn(ctx, im.db), query, provider, subject, email)
+}
+
+func (im *identityModel) Delete(ctx context.Context, accountId, provider string) error {
+	query := `DELETE FROM AccountIdentity WHERE account_id = $1 AND provider = $2`
+
+	tag, err := db.Conn(ctx, im.db).Exec(ctx, query, accountId, provider)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// OAuthState is pending authorization request to OIDC provider
+type OAuthState struct {
+	StateHash    string `db:"state_hash"`
+	Provider     string `db:"provider"`
+	Nonce        string `db:"nonce"`
+	CodeVerifier string `db:"code_verifier"`
+	// AccountId is set when signed in account links the identity
+	AccountId *string   `db:"account_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type OAuthStateModel interface {
+	// Create stores the state and forgets expired ones
+	Create(context.Context, *OAuthState) error
+	// Use deletes and returns unexpired state of the provider, pgx.ErrNoRows if there is none
+	Use(ctx context.Context, provider, hash string) (*OAuthState, error)
+}
+
+type oauthStateModel struct {
+	db *pgxpool.Pool
+}
+
+func (sm *oauthStateModel) Create(ctx context.Context, s *OAuthState) error {
+	conn := db.Conn(ctx, sm.db)
+	if err := db.Exec(ctx, conn, `DELETE FROM OAuthState WHERE expires_at < current_timestamp`); err != nil {
+		return err
+	}
+
+	query :=
+		`INSERT INTO OAuthState (state_hash, provider, nonce, code_verifier, account_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	return db.Exec(ctx, conn, query, s.StateHash, s.Provider, s.Nonce, s.CodeVerifier, s.AccountId, s.ExpiresAt)
+}
+
+func (sm *oauthStateModel) Use(ctx context.Context, provider, hash string) (*OAuthState, error) {
+	query :=
+		`DELETE FROM OAuthState WHERE state_hash = $1 AND provider = $2 AND expires_at > current_timestamp RETURNING *`
+
+	return db.QueryOne[OAuthState](ctx, db.Conn(ctx, sm.db), query, hash, provider)
+}
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+	// ExportExpired is status of ready export whose link expired, it's never stored
+	ExportExpired ExportStatus = "expired"
+)
+
+// DataExport is personal data export requested by the account, its archive is read only by Archive
+type DataExport struct {
+	Id          string       `db:"id"`
+	AccountId   string       `db:"account_id"`
+	Status      ExportStatus `db:"status"`
+	Attempts    int          `db:"attempts"`
+	LastError   *string      `db:"last_error"`
+	AttemptedAt *time.Time   `db:"attempted_at"`
+	CreatedAt   time.Time    `db:"created_at"`
+	CompletedAt *time.Time   `db:"completed_at"`
+	ExpiresAt   *time.Time   `db:"expires_at"`
+}
+
+type DataExportArchive struct {
+	DataExport
+	Archive []byte `db:"archive"`
+}
+
+const dataExportColumns = `id, account_id, status, attempts, last_error, attempted_at, created_at, completed_at, expires_at`
+
+type DataExportModel interface {
+	// Create returns unique violation if the account already has pending export
+	Create(ctx context.Context, accountId string) (*DataExport, error)
+	ListByAccountId(ctx context.Context, accountId string) ([]DataExport, error)
+	// LockPending locks the oldest pending export not attempted since the time, call it in a transaction.
+	// Exports locked by other replicas are skipped
+	LockPending(ctx context.Context, attemptedBefore time.Time) (*DataExport, error)
+	// Complete stores the archive and hash of its download link token
+	Complete(ctx context.Context, id string, archive []byte, tokenHash string, expiresAt time.Time) (*DataExport, error)
+	// Fail counts failed attempt, export with maxAttempts failed attempts is failed for good
+	Fail(ctx context.Context, id string, reason string, maxAttempts int) (*DataExport, error)
+	// Archive returns ready export of the token whose link isn't expired, pgx.ErrNoRows otherwise
+	Archive(ctx context.Context, tokenHash string) (*DataExportArchive, error)
+	// PurgeExpired removes archives and tokens of expired exports, exports themselves stay
+	PurgeExpired(ctx context.Context) error
+}
+
+type dataExportModel struct {
+	db *pgxpool.Pool
+}
+
+func (em *dataExportModel) Create(ctx context.Context, accountId string) (*DataExport, error) {
+	query := `INSERT INTO DataExport (account_id) VALUES ($1) RETURNING ` + dataExportColumns
+
+	return db.QueryOne[DataExport](ctx, db.Conn(ctx, em.db), query, accountId)
+}
+
+func (em *dataExportModel) ListByAccountId(ctx context.Context, accountId string) ([]DataExport, error) {
+	query := `SELECT ` + dataExportColumns + ` FROM DataExport WHERE account_id = $1 ORDER BY created_at DESC`
+
+	return db.QueryAll[DataExport](ctx, db.Conn(ctx, em.db), query, accountId)
+}
+
+func (em *dataExportModel) LockPending(ctx context.Context, attemptedBefore time.Time) (*DataExport, error) {
+	query :=
+		`SELECT ` + dataExportColumns + ` FROM DataExport
+		WHERE status = 'pending' AND (attempted_at IS NULL OR attempted_at < $1)
+		ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED`
+
+	return db.QueryOne[DataExport](ctx, db.Conn(ctx, em.db), query, attemptedBefore)
+}
+
+func (em *dataExportModel) Complete(ctx context.Context, id string, archive []byte, tokenHash string, expiresAt time.Time) (*DataExport, error) {
+	query :=
+		`UPDATE DataExport SET status = 'ready', attempts = attempts + 1, attempted_at = current_timestamp,
+		archive = $2, token_hash = $3, completed_at = current_timestamp, expires_at = $4
+		WHERE id = $1 AND status = 'pending' RETURNING ` + dataExportColumns
+
+	return db.QueryOne[DataExport](ctx, db.Conn(ctx, em.db), query, id, archive, tokenHash, expiresAt)
+}
+
+func (em *dataExportModel) Fail(ctx context.Context, id string, reason string, maxAttempts int) (*DataExport, error) {
+	query :=
+		`UPDATE DataExport SET attempts = attempts + 1, attempted_at = current_timestamp, last_error = $2,
+		status = CASE WHEN attempts + 1 >= $3 THEN 'failed' ELSE status END,
+		completed_at = CASE WHEN attempts + 1 >= $3 THEN current_timestamp END
+		WHERE id = $1 AND status = 'pending' RETURNING ` + dataExportColumns
+
+	return db.QueryOne[DataExport](ctx, db.Conn(ctx, em.db), query, id, reason, maxAttempts)
+}
+
+func (em *dataExportModel) Archive(ctx context.Context, tokenHash string) (*DataExportArchive, error) {
+	query :=
+		`SELECT ` + dataExportColumns + `, archive FROM DataExport
+		WHERE token_hash = $1 AND status = 'ready' AND expires_at > current_timestamp`
+
+	return db.QueryOne[DataExportArchive](ctx, db.Conn(ctx, em.db), query, tokenHash)
+}
+
+func (em *dataExportModel) PurgeExpired(ctx context.Context) error {
+	query :=
+		`UPDATE DataExport SET archive = NULL, token_hash = NULL
+		WHERE expires_at < current_timestamp AND archive IS NOT NULL`
+
+	return db.Exec(ctx, db.Conn(ctx, em.db), query)
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// throttlePolicy locks a key once it has more than free failures within window, lockout starts at base
+// and doubles with every next failure up to max
+type throttlePolicy struct {
+	free   int
+	base   time.Duration
+	max    time.Duration
+	window time.Duration
+}
+
+var throttlePolicies = map[ThrottleKind]throttlePolicy{
+	ThrottleAccount: {free: 5, base: 30 * time.Second, max: time.Hour, window: 24 * time.Hour},
+	ThrottleLogin:   {free: 5, base: 30 * time.Second, max: time.Hour, window: 24 * time.Hour},
+	// Many users may share an address, so it gets more attempts before being locked
+	ThrottleIP: {free: 50, base: 10 * time.Second, max: time.Hour, window: time.Hour},
+}
+
+func (p throttlePolicy) lockout(failures int) time.Duration {
+	if failures <= p.free {
+		return 0
+	}
+	n := failures - p.free - 1
+	if n >= 32 || p.base<<n > p.max {
+		return p.max
+	}
+	return p.base << n
+}
+
+// dummyHash is compared with password of unknown accounts, so they take as long as wrong passwords
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// Audit log action of clearing lockout by staff
+const (
+	AuditLockoutClear = "lockout.clear"
+
+	AuditTargetLockout = "lockout"
+)
+
+type throttleKey struct {
+	kind ThrottleKind
+	key  string
+}
+
+// loginKey returns throttle key of sign in attempt, attempts of unknown accounts are counted by lowercase login
+func loginKey(user *Account, login string) throttleKey {
+	if user != nil {
+		return throttleKey{ThrottleAccount, user.Id}
+	}
+	key := strings.ToLower(login)
+	if len(key) > 255 {
+		key = key[:255]
+	}
+	return throttleKey{ThrottleLogin, key}
+}
+
+// clientIP returns address of the client, RemoteAddr is already replaced by middleware.RealIP behind proxies
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// lockedUntil returns the latest lockout end of the keys, nil if none of them is locked
+func (a *Controller) lockedUntil(ctx context.Context, keys ...throttleKey) (*time.Time, error) {
+	var latest *time.Time
+	for _, k := range keys {
+		until, err := a.throttle.LockedUntil(ctx, k.kind, k.key)
+		if err != nil {
+			return nil, err
+		}
+		if until != nil && (latest == nil || until.After(*latest)) {
+			latest = until
+		}
+	}
+	return latest, nil
+}
+
+// fail counts failed attempt of every key and locks keys that ran out of free attempts.
+// Keys are always passed in the same order, so concurrent failures can't deadlock
+func (a *Controller) fail(ctx context.Context, keys ...throttleKey) error {
+	return db.WithTx(ctx, a.db, func(ctx context.Context) error {
+		for _, k := range keys {
+			policy := throttlePolicies[k.kind]
+			failures, err := a.throttle.Fail(ctx, k.kind, k.key, policy.window)
+			if err != nil {
+				return err
+			}
+			if d := policy.lockout(failures); d > 0 {
+				if err := a.throttle.Lock(ctx, k.kind, k.key, time.Now().Add(d)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// writeLocked responds with 429 and Retry-After of the lockout
+func writeLocked(w http.ResponseWriter, r *http.Request, until time.Time) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+	response.WriteProblem(w, r, ErrTooManyAttempts)
+}
+
+// ListLockouts lists locked accounts, logins and addresses
+func (a *Controller) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	locked, err := a.throttle.ListLocked(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := ListLockoutsResponse{Lockouts: make([]LockoutResponse, 0, len(locked))}
+	for _, t := range locked {
+		res.Lockouts = append(res.Lockouts, LockoutResponse{
+			Kind:         t.Kind,
+			Key:          t.Key,
+			Username:     t.Username,
+			Failures:     t.Failures,
+			LastFailedAt: t.LastFailedAt,
+			LockedUntil:  *t.LockedUntil,
+		})
+	}
+
+	response.Json(w, &res)
+}
+
+// ClearLockout unlocks the key and forgets its failures
+func (a *Controller) ClearLockout(w http.ResponseWriter, r *http.Request) {
+	kind, key := ThrottleKind(chi.URLParam(r, "kind")), chi.URLParam(r, "key")
+	if _, ok := throttlePolicies[kind]; !ok {
+		response.WriteProblem(w, r, ErrLockoutNotFound)
+		return
+	}
+
+	err := db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		until, err := a.throttle.LockedUntil(ctx, kind, key)
+		if err != nil {
+			return err
+		}
+		if until == nil {
+			return ErrLockoutNotFound
+		}
+		if err := a.throttle.Clear(ctx, kind, key); err != nil {
+			return err
+		}
+		entry := audit.New(r, AuditLockoutClear, AuditTargetLockout, string(kind)+":"+key)
+		return audit.Record(ctx, db.Conn(ctx, a.db), entry, nil)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrLockoutNotFound):
+			response.WriteProblem(w, r, ErrLockoutNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	response.Message(w, "Lockout cleared")
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottleLockout(t *testing.T) {
+	p := throttlePolicy{free: 5, base: 30 * time.Second, max: time.Hour, window: 24 * time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{5, 0},
+		{6, 30 * time.Second},
+		{7, time.Minute},
+		{8, 2 * time.Minute},
+		{12, 32 * time.Minute},
+		// 64 minutes is over max
+		{13, time.Hour},
+		{37, time.Hour},
+		// Shift of 32 and more would overflow
+		{38, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := p.lockout(tt.failures); got != tt.want {
+			t.Errorf("lockout after %d failures is %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleLockoutOverflow(t *testing.T) {
+	// base<<n is still under max for n just below 32, the guard keeps larger shifts from wrapping around
+	p := throttlePolicy{free: 0, base: time.Nanosecond, max: 1 << 62}
+
+	for _, tt := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{32, 1 << 31},
+		{33, 1 << 62},
+		{100, 1 << 62},
+	} {
+		if got := p.lockout(tt.failures); got != tt.want {
+			t.Errorf("lockout after %d failures is %d, want %d", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginKey(t *testing.T) {
+	long := strings.Repeat("a", 300)
+
+	tests := []struct {
+		user  *Account
+		login string
+		want  throttleKey
+	}{
+		{&Account{Id: "id"}, "Alice", throttleKey{ThrottleAccount, "id"}},
+		{nil, "Alice@Example.com", throttleKey{ThrottleLogin, "alice@example.com"}},
+		{nil, strings.ToUpper(long), throttleKey{ThrottleLogin, long[:255]}},
+	}
+	for _, tt := range tests {
+		if got := loginKey(tt.user, tt.login); got != tt.want {
+			t.Errorf("key of %.20q is %v, want %v", tt.login, got, tt.want)
+		}
+	}
+}
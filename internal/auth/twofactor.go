@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/totp"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
+)
+
+const (
+	totpIssuer = "District Funding"
+	// totpSkew is how many periods codes may be off because of clock drift
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	challengeTTL      = 5 * time.Minute
+)
+
+// AuditTwoFactorDisable is audit log action of disabling two-factor authentication of a locked out account by operator
+const AuditTwoFactorDisable = "account.disable_2fa"
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTwoFactor creates a pending totp secret with recovery codes, it's enabled after ConfirmTwoFactor.
+// Enrolling again before confirming replaces the secret
+func (a *Controller) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	user, err := a.account.GetByUUID(r.Context(), token.Subject())
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrAccountNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = recoveryCode(); err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		hashes[i] = hashToken(codes[i])
+	}
+
+	if err := a.totp.Enroll(r.Context(), user.Id, secret, hashes); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrTwoFactorEnabled)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	response.Json(w, &EnrollTwoFactorResponse{
+		Secret:        secret,
+		OtpauthUri:    totp.URI(totpIssuer, user.Email, secret),
+		RecoveryCodes: codes,
+	})
+}
+
+// ConfirmTwoFactor enables pending secret with its first code
+func (a *Controller) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	a.withCode(w, r, func(ctx context.Context, t *AccountTotp) error {
+		if t.EnabledAt != nil {
+			return ErrTwoFactorEnabled
+		}
+		return a.totp.Enable(ctx, t.AccountId)
+	}, func(*Account) {
+		response.Message(w, "Two-factor authentication enabled")
+	})
+}
+
+func (a *Controller) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	a.withCode(w, r, func(ctx context.Context, t *AccountTotp) error {
+		return a.totp.Delete(ctx, t.AccountId)
+	}, func(*Account) {
+		response.Message(w, "Two-factor authentication disabled")
+	})
+}
+
+// StepUp checks the code again and returns access token proving it, actions like payouts require such token
+func (a *Controller) StepUp(w http.ResponseWriter, r *http.Request) {
+	a.withCode(w, r, func(ctx context.Context, t *AccountTotp) error {
+		if t.EnabledAt == nil {
+			return ErrTwoFactorDisabled
+		}
+		return nil
+	}, func(user *Account) {
+		accessToken, err := generateJWTFromUser(a.jwt, user, time.Now())
+		if err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		response.Json(w, &StepUpResponse{
+			AccessToken: accessToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(accessTokenTTL.Seconds()),
+		})
+	})
+}
+
+// SignInTwoFactor redeems challenge of SignIn with two-factor code. Wrong codes are throttled like wrong passwords
+// and leave the challenge usable until it expires
+func (a *Controller) SignInTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req SignInTwoFactorRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	challenge, err := a.accountToken.Get(r.Context(), PurposeSignIn, hashToken(req.ChallengeToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrInvalidChallenge)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	user, err := a.account.GetByUUID(r.Context(), challenge.AccountId)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if user.SuspendedAt != nil {
+		response.WriteProblem(w, r, ErrAccountSuspended)
+		return
+	}
+
+	ok := a.checkCode(w, r, user, req.Code, func(ctx context.Context, t *AccountTotp) error {
+		if t.EnabledAt == nil {
+			return ErrTwoFactorDisabled
+		}
+		if _, err := a.accountToken.Use(ctx, PurposeSignIn, challenge.TokenHash); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrInvalidChallenge
+			}
+			return err
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	tokens, err := a.issueTokens(r.Context(), user, time.Now())
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	response.Json(w, tokens)
+}
+
+// withCode decodes TwoFactorCodeRequest of the signed in account, runs fn if the code is right and then writes
+// the response with respond
+func (a *Controller) withCode(w http.ResponseWriter, r *http.Request, fn func(context.Context, *AccountTotp) error, respond func(*Account)) {
+	var req TwoFactorCodeRequest
+
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := a.account.GetByUUID(r.Context(), token.Subject())
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrAccountNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	if a.checkCode(w, r, user, req.Code, fn) {
+		respond(user)
+	}
+}
+
+// checkCode checks two-factor code of the account and runs fn in the same transaction, so the code is used
+// only if fn succeeds. Wrong codes count as failed sign in attempts. Returns false if response is already written
+func (a *Controller) checkCode(w http.ResponseWriter, r *http.Request, user *Account, code string, fn func(context.Context, *AccountTotp) error) bool {
+	account, ip := throttleKey{ThrottleAccount, user.Id}, throttleKey{ThrottleIP, clientIP(r)}
+	until, err := a.lockedUntil(r.Context(), account, ip)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return false
+	}
+	if until != nil {
+		writeLocked(w, r, *until)
+		return false
+	}
+
+	err = db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		t, err := a.totp.Get(ctx, user.Id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrTwoFactorDisabled
+			}
+			return err
+		}
+		if err := a.useCode(ctx, t, code); err != nil {
+			return err
+		}
+		return fn(ctx, t)
+	})
+	switch {
+	case errors.Is(err, ErrInvalidTwoFactor):
+		if err := a.fail(r.Context(), account, ip); err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return false
+		}
+		response.WriteProblem(w, r, ErrInvalidTwoFactor)
+		return false
+	case err != nil:
+		// Problems returned by fn are written as is
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if err := a.throttle.Clear(r.Context(), account.kind, account.key); err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
+
+// useCode accepts totp code once or unused recovery code of enabled secret, returns ErrInvalidTwoFactor otherwise
+func (a *Controller) useCode(ctx context.Context, t *AccountTotp, code string) error {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	var err error
+	if counter, ok := totp.Validate(t.Secret, code, time.Now(), totpSkew); ok {
+		err = a.totp.UseCounter(ctx, t.AccountId, counter)
+	} else if t.EnabledAt != nil {
+		err = a.totp.UseRecoveryCode(ctx, t.AccountId, hashToken(strings.ToUpper(code)))
+	} else {
+		return ErrInvalidTwoFactor
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidTwoFactor
+	}
+	return err
+}
+
+// createChallenge stores single-use challenge of two-step sign in
+func (a *Controller) createChallenge(ctx context.Context, user *Account) (*ChallengeResponse, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.accountToken.Create(ctx, &AccountToken{
+		AccountId: user.Id,
+		Purpose:   PurposeSignIn,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(challengeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChallengeResponse{Token: token, ExpiresIn: int(challengeTTL.Seconds())}, nil
+}
+
+// recoveryCode returns random code like ABCDE-FGHIJ, 50 bits are enough as every code works once
+// and wrong codes are throttled
+func recoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := recoveryEncoding.EncodeToString(b)[:10]
+	return s[:5] + "-" + s[5:], nil
+}
@@ -0,0 +1,65 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/totp"
+)
+
+// enableTwoFactor enrolls two-factor authentication of the signed in client, returns its secret
+func enableTwoFactor(t *testing.T, c *client.Client) string {
+	t.Helper()
+
+	enrolled, err := c.EnrollTwoFactor(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(enrolled.Secret, totp.Counter(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ConfirmTwoFactor(context.Background(), code); err != nil {
+		t.Fatal(err)
+	}
+	return enrolled.Secret
+}
+
+// challenge signs in username with password, returns token of the two-factor challenge
+func (a *authTest) challenge(t *testing.T, c *client.Client, username string) string {
+	t.Helper()
+
+	_, err := c.SignIn(context.Background(), &client.SignInRequest{UsernameOrEmail: username, Password: password})
+	var challenge *client.ChallengeError
+	if !errors.As(err, &challenge) {
+		t.Fatalf("got %v, want two-factor challenge", err)
+	}
+	return challenge.Token
+}
+
+func TestPasswordDoesNotResetTwoFactorFailures(t *testing.T) {
+	a := newAuthTest(t)
+	enableTwoFactor(t, a.signUp(t, "alice"))
+	c := a.client()
+	ctx := context.Background()
+
+	challenge := a.challenge(t, c, "alice")
+	for range 5 {
+		if _, err := c.SignInTwoFactor(ctx, challenge, "wrong"); client.ErrorCode(err) != auth.CodeInvalidTwoFactor {
+			t.Fatalf("got %v, want %s", err, auth.CodeInvalidTwoFactor)
+		}
+	}
+
+	// Right password only issues a new challenge, failed codes are still counted
+	challenge = a.challenge(t, c, "alice")
+	if _, err := c.SignInTwoFactor(ctx, challenge, "wrong"); client.ErrorCode(err) != auth.CodeInvalidTwoFactor {
+		t.Fatalf("got %v, want %s", err, auth.CodeInvalidTwoFactor)
+	}
+	if _, err := c.SignInTwoFactor(ctx, challenge, "wrong"); client.ErrorCode(err) != auth.CodeTooManyAttempts {
+		t.Fatalf("got %v, want %s", err, auth.CodeTooManyAttempts)
+	}
+}
@@ -0,0 +1,92 @@
+package campaign
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
+)
+
+// Audit log actions of campaign admin api
+const (
+	AuditCampaignArchive = "campaign.archive"
+
+	AuditTargetCampaign = "campaign"
+)
+
+// AdminArchiveCampaign archives any campaign on behalf of staff, donations are refunded like
+// when creator archives it
+func (a *Api) AdminArchiveCampaign(w http.ResponseWriter, r *http.Request) {
+	var req AdminArchiveCampaignRequest
+
+	c, err := CampaignFromCtx(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	actorId := token.Subject()
+	entry := audit.New(r, AuditCampaignArchive, AuditTargetCampaign, strconv.Itoa(c.Id))
+	details := struct {
+		Reason    string         `json:"reason"`
+		CreatorId string         `json:"creator_id"`
+		From      CampaignStatus `json:"from"`
+	}{req.Reason, c.CreatorId, c.Status}
+
+	err = db.WithTx(r.Context(), a.db, func(ctx context.Context) error {
+		var err error
+		if c, err = a.campaign.Transition(ctx, c.Id, StatusClosed, &actorId, TransitionReasonArchived); err != nil {
+			return err
+		}
+		return audit.Record(ctx, db.Conn(ctx, a.db), entry, &details)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrIllegalTransition):
+			response.WriteProblem(w, r, transitionProblem(err))
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	response.Json(w, &GetCampaignResponse{
+		c.Id,
+		c.CreatorId,
+		c.Name,
+		c.Description,
+		c.Goal,
+		c.CurrentAmount,
+		c.Deadline,
+		c.AllOrNothing,
+		c.Status,
+		c.Outcome,
+		c.Archived,
+		c.CreatedAt,
+		c.UpdatedAt,
+	})
+}
@@ -0,0 +1,62 @@
+package campaign_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/db/dbtest"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+)
+
+const (
+	creatorId = "9b0f3c1e-3c55-4f0e-8d1a-7e0c2b6f0a01"
+	otherId   = "9b0f3c1e-3c55-4f0e-8d1a-7e0c2b6f0a02"
+	staffId   = "9b0f3c1e-3c55-4f0e-8d1a-7e0c2b6f0a03"
+)
+
+// campaignTest is campaign service accepting tokens signed by ja
+type campaignTest struct {
+	pool *pgxpool.Pool
+	ja   *jwtauth.JWTAuth
+	url  string
+}
+
+func newCampaignTest(t *testing.T) *campaignTest {
+	pool := dbtest.New(t, campaign.Migrations)
+	ja := jwtauth.New(jwa.HS256, []byte("secret"))
+	srv := httptest.NewServer(campaign.NewController(pool, ja, "token"))
+	t.Cleanup(srv.Close)
+	return &campaignTest{pool, ja, srv.URL}
+}
+
+// client returns client signed in as the account, empty accountId is anonymous client
+func (c *campaignTest) client(t *testing.T, accountId string, role jwtauth.Role) *client.Client {
+	t.Helper()
+
+	cl := client.New("", c.url, "")
+	if accountId == "" {
+		return cl
+	}
+
+	token, err := jwt.NewBuilder().
+		Subject(accountId).
+		JwtID(accountId).
+		Claim(jwtauth.RoleClaim, role).
+		Claim(jwtauth.EmailVerifiedClaim, true).
+		Expiration(time.Now().Add(time.Hour)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := c.ja.Sign(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cl.WithTokens(&client.TokenResponse{AccessToken: string(signed), TokenType: "Bearer", ExpiresIn: 3600})
+}
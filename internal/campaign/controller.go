@@ -3,12 +3,27 @@ package campaign
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/internalapi"
 	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+	"github.com/robloxxa/DistrictFunding/pkg/openapi"
 	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
 )
 
 var (
@@ -18,55 +33,93 @@ var (
 
 type Api struct {
 	r               chi.Router
+	db              *pgxpool.Pool
 	ja              *jwtauth.JWTAuth
 	campaign        CampaignModel
 	campaignHistory CampaignEditHistoryModel
 	campaignDonated CampaignDonatedModel
+	transition      CampaignTransitionModel
 }
 
-func NewController(db *pgxpool.Pool, ja *jwtauth.JWTAuth) *Api {
+// NewController creates campaign api, internalToken protects routes called by other services
+func NewController(db *pgxpool.Pool, ja *jwtauth.JWTAuth, internalToken string) *Api {
 	a := &Api{
 		chi.NewRouter(),
+		db,
 		ja,
 		&campaignModel{db},
 		&campaignEditHistoryModel{db},
 		&campaignDonatedModel{db},
+		&campaignTransitionModel{db},
 	}
 
-	// TODO: list campaigns
-	//a.r.Get("/", http.NotFound)
+	// Token is optional on read routes, it lets creator and staff see drafts
+	a.r.With(jwtauth.Verifier(ja)).Get("/", a.ListCampaigns)
+
+	a.r.Route("/internal", func(r chi.Router) {
+		r.Use(internalapi.RequireToken(internalToken))
+
+		r.Post("/donation-events", a.ApplyDonationEvent)
+		r.Get("/accounts/{accountId}/export", a.ExportAccount)
+	})
 
 	// Campaign creating route
 	a.r.Group(func(r chi.Router) {
 		r.Use(jwtauth.Verifier(ja))
 		r.Use(jwtauth.Authenticator)
+		r.Use(jwtauth.RequireVerifiedEmail)
 
 		r.Post("/", a.CreateCampaign)
 	})
 
+	// Staff routes, every action is recorded in audit log
+	a.r.Route("/admin", func(r chi.Router) {
+		r.Use(jwtauth.Verifier(ja))
+		r.Use(jwtauth.Authenticator)
+
+		r.With(jwtauth.RequirePermission(jwtauth.PermissionReadAudit)).Get("/audit", audit.ListHandler(db))
+		r.With(jwtauth.RequirePermission(jwtauth.PermissionArchiveCampaigns), a.CampaignCtx).
+			Post("/campaigns/{campaignId}/archive", a.AdminArchiveCampaign)
+	})
+
 	// All routes with campaignId as path parameter
 	a.r.Route("/{campaignId}", func(r chi.Router) {
+		r.Use(jwtauth.Verifier(ja))
 		r.Use(a.CampaignCtx)
 		r.Get("/", a.GetCampaign)
-		r.Get("/history", a.GetCampaignHistory) //TODO:
+		r.Get("/history", a.GetCampaignHistory)
+		r.Get("/history/{revision}", a.GetCampaignRevision)
+		r.Get("/transitions", a.ListCampaignTransitions)
 		r.Group(func(r chi.Router) {
-			r.Use(jwtauth.Verifier(ja))
 			r.Use(jwtauth.Authenticator)
 			r.Use(IsCampaignOwner)
-			r.Use(IsArchived)
 
-			r.Put("/", a.UpdateCampaign)
+			r.With(IsEditable).Put("/", a.UpdateCampaign)
 			r.Delete("/", a.DeleteCampaign)
+			r.Post("/status", a.ChangeCampaignStatus)
 		})
 	})
+	openapi.Serve(a.r, Spec())
 
 	return a
 }
 
+// CampaignCtx loads campaign of the path, drafts are found only by their creator and staff, it must follow Verifier
 func (a *Api) CampaignCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		campaignId := chi.URLParam(r, "campaignId")
-		campaign, err := a.campaign.GetById(campaignId)
+
+		var (
+			campaign *Campaign
+			err      error
+		)
+		if _, err = strconv.Atoi(campaignId); err != nil {
+			err = ErrCampaignNotFound
+		} else if campaign, err = a.campaign.GetById(r.Context(), campaignId); errors.Is(err, pgx.ErrNoRows) {
+			err = ErrCampaignNotFound
+		} else if err == nil && !canSee(r, campaign) {
+			campaign, err = nil, ErrCampaignNotFound
+		}
 		ctx := NewCampaignContext(r.Context(), campaign, err)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -76,18 +129,18 @@ func IsCampaignOwner(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := jwtauth.FromContext(r.Context())
 		if err != nil {
-			response.Error(w, http.StatusUnauthorized, err)
+			response.Error(w, r, http.StatusUnauthorized, err)
 			return
 		}
 
 		campaign, err := CampaignFromCtx(r.Context())
 		if err != nil {
-			response.Error(w, http.StatusUnauthorized, err)
+			response.Error(w, r, http.StatusInternalServerError, err)
 			return
 		}
 
 		if token.Subject() != campaign.CreatorId {
-			response.Error(w, http.StatusUnauthorized, fmt.Errorf("campaign creator id is not equal to requester id"))
+			response.WriteProblem(w, r, ErrNotCampaignOwner)
 			return
 		}
 
@@ -95,16 +148,35 @@ func IsCampaignOwner(next http.Handler) http.Handler {
 	})
 }
 
-func IsArchived(next http.Handler) http.Handler {
+// viewer returns account id and staff flag of the request token, anonymous requests have empty id
+func viewer(r *http.Request) (string, bool) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return "", false
+	}
+	return token.Subject(), jwtauth.RoleFromToken(token) != jwtauth.RoleUser
+}
+
+// canSee reports whether the request may read the campaign, drafts are seen only by their creator and staff
+func canSee(r *http.Request, c *Campaign) bool {
+	if c.Status != StatusDraft {
+		return true
+	}
+	accountId, staff := viewer(r)
+	return staff || accountId == c.CreatorId
+}
+
+// IsEditable rejects changes of campaigns that are past their deadline, expired or closed
+func IsEditable(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		campaign, err := CampaignFromCtx(r.Context())
 		if err != nil {
-			response.Error(w, http.StatusBadRequest, err)
+			response.Error(w, r, http.StatusInternalServerError, err)
 			return
 		}
 
-		if campaign.Archived {
-			response.Error(w, http.StatusBadRequest, fmt.Errorf("campaign is archived"))
+		if !campaign.Editable() {
+			response.WriteProblem(w, r, ErrCampaignNotEditable.WithDetail("campaign is %s and can't be changed after deadline", campaign.Status))
 			return
 		}
 
@@ -117,7 +189,7 @@ func (a *Api) GetCampaign(w http.ResponseWriter, r *http.Request) {
 
 	c, err := CampaignFromCtx(r.Context())
 	if err != nil {
-		response.Error(w, http.StatusNotFound, err)
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -129,6 +201,9 @@ func (a *Api) GetCampaign(w http.ResponseWriter, r *http.Request) {
 		c.Goal,
 		c.CurrentAmount,
 		c.Deadline,
+		c.AllOrNothing,
+		c.Status,
+		c.Outcome,
 		c.Archived,
 		c.CreatedAt,
 		c.UpdatedAt,
@@ -137,9 +212,227 @@ func (a *Api) GetCampaign(w http.ResponseWriter, r *http.Request) {
 	response.Json(w, &res)
 }
 
-// TODO campaign history getter with /{campaignId}/history route
+// ListCampaigns lists campaigns with filters and cursor pagination
+func (a *Api) ListCampaigns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter, err := parseCampaignFilter(q)
+	if err != nil {
+		response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("%s", err))
+		return
+	}
+	filter.viewerId, filter.staff = viewer(r)
+
+	sort, err := ParseCampaignSort(q.Get("sort"))
+	if err != nil {
+		response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("%s", err))
+		return
+	}
+
+	limit := defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("limit must be between 1 and %d", maxListLimit))
+			return
+		}
+	}
+
+	var cursor *CampaignCursor
+	if v := q.Get("cursor"); v != "" {
+		cursor, err = DecodeCampaignCursor(v, sort)
+		if err != nil {
+			response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("%s", err))
+			return
+		}
+	}
+
+	// Fetch one more campaign to know if there is a next page
+	campaigns, err := a.campaign.List(r.Context(), filter, sort, cursor, limit+1)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	total, err := a.campaign.Count(r.Context(), filter)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := ListCampaignsResponse{Campaigns: make([]GetCampaignResponse, 0, limit), Total: total}
+	if len(campaigns) > limit {
+		campaigns = campaigns[:limit]
+		res.NextCursor = NewCampaignCursor(sort, &campaigns[limit-1]).Encode()
+	}
+	for _, c := range campaigns {
+		res.Campaigns = append(res.Campaigns, GetCampaignResponse{
+			c.Id,
+			c.CreatorId,
+			c.Name,
+			c.Description,
+			c.Goal,
+			c.CurrentAmount,
+			c.Deadline,
+			c.AllOrNothing,
+			c.Status,
+			c.Outcome,
+			c.Archived,
+			c.CreatedAt,
+			c.UpdatedAt,
+		})
+	}
+
+	response.Json(w, &res)
+}
+
+// GetCampaignHistory lists campaign revisions with changed fields, cursor is the last revision number of previous page
 func (a *Api) GetCampaignHistory(w http.ResponseWriter, r *http.Request) {
+	c, err := CampaignFromCtx(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	q := r.URL.Query()
+
+	limit := defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("limit must be between 1 and %d", maxListLimit))
+			return
+		}
+	}
+
+	after := 0
+	if v := q.Get("cursor"); v != "" {
+		after, err = strconv.Atoi(v)
+		if err != nil || after < 0 {
+			response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("invalid cursor"))
+			return
+		}
+	}
+
+	// Next revision holds new values of the previous one, so one more revision is fetched
+	revisions, err := a.campaignHistory.ListRevisions(r.Context(), c.Id, after, limit+1)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
 
+	total, err := a.campaignHistory.Count(r.Context(), c.Id)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := GetCampaignHistoryResponse{Revisions: make([]CampaignRevisionResponse, 0, limit), Total: total}
+	for i := 0; i < len(revisions) && i < limit; i++ {
+		next := campaignState(c)
+		if i+1 < len(revisions) {
+			next = revisions[i+1].CampaignEditHistory
+		}
+
+		res.Revisions = append(res.Revisions, CampaignRevisionResponse{
+			Revision:   revisions[i].Revision,
+			EditorId:   revisions[i].EditorId,
+			ModifiedAt: revisions[i].ModifiedAt,
+			Changes:    diffCampaignStates(&revisions[i].CampaignEditHistory, &next),
+		})
+	}
+	if len(revisions) > limit {
+		res.NextCursor = strconv.Itoa(revisions[limit-1].Revision)
+	}
+
+	response.Json(w, &res)
+}
+
+// GetCampaignRevision returns the campaign as it was right after the revision
+func (a *Api) GetCampaignRevision(w http.ResponseWriter, r *http.Request) {
+	c, err := CampaignFromCtx(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	revision, err := strconv.Atoi(chi.URLParam(r, "revision"))
+	if err != nil || revision < 0 {
+		response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("invalid revision"))
+		return
+	}
+
+	res := GetCampaignRevisionResponse{Revision: revision, ModifiedAt: c.CreatedAt}
+
+	// Values after the revision are kept in the snapshot of the next one
+	after, limit := 0, 1
+	if revision > 0 {
+		after, limit = revision-1, 2
+	}
+	revisions, err := a.campaignHistory.ListRevisions(r.Context(), c.Id, after, limit)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if revision > 0 {
+		if len(revisions) == 0 {
+			response.WriteProblem(w, r, ErrRevisionNotFound)
+			return
+		}
+		res.EditorId = revisions[0].EditorId
+		res.ModifiedAt = revisions[0].ModifiedAt
+		revisions = revisions[1:]
+	}
+
+	state := campaignState(c)
+	if len(revisions) > 0 {
+		state = revisions[0].CampaignEditHistory
+	}
+
+	res.Campaign = GetCampaignResponse{
+		c.Id,
+		c.CreatorId,
+		c.Name,
+		state.Description,
+		state.Goal,
+		c.CurrentAmount,
+		state.Deadline,
+		c.AllOrNothing,
+		c.Status,
+		c.Outcome,
+		c.Archived,
+		c.CreatedAt,
+		c.UpdatedAt,
+	}
+
+	response.Json(w, &res)
+}
+
+// campaignState returns current campaign values in the form of history snapshot
+func campaignState(c *Campaign) CampaignEditHistory {
+	return CampaignEditHistory{
+		CampaignId:  c.Id,
+		Description: c.Description,
+		Goal:        c.Goal,
+		Deadline:    c.Deadline,
+	}
+}
+
+func diffCampaignStates(old, new *CampaignEditHistory) CampaignChanges {
+	var changes CampaignChanges
+
+	if old.Description != new.Description {
+		changes.Description = &FieldChange[string]{old.Description, new.Description}
+	}
+	if old.Goal != new.Goal {
+		changes.Goal = &FieldChange[money.Money]{old.Goal, new.Goal}
+	}
+	if !old.Deadline.Equal(new.Deadline) {
+		changes.Deadline = &FieldChange[time.Time]{old.Deadline, new.Deadline}
+	}
+
+	return changes
 }
 
 func (a *Api) CreateCampaign(w http.ResponseWriter, r *http.Request) {
@@ -149,26 +442,46 @@ func (a *Api) CreateCampaign(w http.ResponseWriter, r *http.Request) {
 
 	token, err := jwtauth.FromContext(r.Context())
 	if err != nil {
-		response.Error(w, http.StatusUnauthorized, err)
+		response.Error(w, r, http.StatusUnauthorized, err)
 		return
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !req.Goal.IsPositive() {
+		response.WriteProblem(w, r, ErrInvalidGoal)
+		return
+	}
+
+	if !req.Deadline.After(time.Now()) {
+		response.WriteProblem(w, r, ErrInvalidDeadline)
 		return
 	}
 
 	c := &Campaign{
-		CreatorId:   token.Subject(),
-		Name:        req.Name,
-		Description: req.Description,
-		Goal:        req.Goal,
-		Deadline:    req.Deadline,
+		CreatorId:    token.Subject(),
+		Name:         req.Name,
+		Description:  req.Description,
+		Goal:         req.Goal,
+		Deadline:     req.Deadline,
+		AllOrNothing: req.AllOrNothing,
+		Status:       StatusActive,
+	}
+	if req.Draft {
+		c.Status = StatusDraft
 	}
 
-	c, err = a.campaign.Create(c)
+	c, err = a.campaign.Create(r.Context(), c)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -180,6 +493,9 @@ func (a *Api) CreateCampaign(w http.ResponseWriter, r *http.Request) {
 		c.Goal,
 		c.CurrentAmount,
 		c.Deadline,
+		c.AllOrNothing,
+		c.Status,
+		c.Outcome,
 		c.Archived,
 		c.CreatedAt,
 		c.UpdatedAt,
@@ -192,32 +508,125 @@ func (a *Api) CreateCampaign(w http.ResponseWriter, r *http.Request) {
 func (a *Api) DeleteCampaign(w http.ResponseWriter, r *http.Request) {
 	campaign, err := CampaignFromCtx(r.Context())
 	if err != nil {
-		response.Error(w, http.StatusNotFound, err)
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	token, err := jwtauth.FromContext(r.Context())
 	if err != nil {
-		response.Error(w, http.StatusUnauthorized, err)
+		response.Error(w, r, http.StatusUnauthorized, err)
 		return
 	}
 
 	if campaign.CreatorId != token.Subject() {
-		response.Error(w, http.StatusBadRequest, fmt.Errorf("you can't delete campaign created by other users"))
+		response.WriteProblem(w, r, ErrNotCampaignOwner)
+		return
+	}
+
+	// Closing campaign archives it, payment service then refunds every donation
+	actorId := token.Subject()
+	if _, err = a.campaign.Transition(r.Context(), campaign.Id, StatusClosed, &actorId, TransitionReasonArchived); err != nil {
+		switch {
+		case errors.Is(err, ErrIllegalTransition):
+			response.WriteProblem(w, r, transitionProblem(err))
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+}
+
+// ChangeCampaignStatus moves campaign to the status requested by its creator,
+// publishing a draft or closing the campaign
+func (a *Api) ChangeCampaignStatus(w http.ResponseWriter, r *http.Request) {
+	var req ChangeCampaignStatusRequest
+
+	c, err := CampaignFromCtx(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
 		return
 	}
 
-	if campaign.Archived == true {
-		response.Error(w, http.StatusBadRequest, fmt.Errorf("campaign already archived"))
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
 		return
 	}
 
-	// TODO: add logic to return money back to donaters
-	err = a.campaign.Archive(campaign.Id)
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := ParseCampaignStatus(string(req.Status)); err != nil {
+		response.WriteProblem(w, r, transitionProblem(err))
+		return
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		switch req.Status {
+		case StatusActive:
+			reason = TransitionReasonPublished
+		case StatusClosed:
+			reason = TransitionReasonArchived
+		}
+	}
+
+	actorId := token.Subject()
+	c, err = a.campaign.Transition(r.Context(), c.Id, req.Status, &actorId, reason)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+		switch {
+		case errors.Is(err, ErrIllegalTransition):
+			response.WriteProblem(w, r, transitionProblem(err))
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
 		return
 	}
+
+	response.Json(w, &GetCampaignResponse{
+		c.Id,
+		c.CreatorId,
+		c.Name,
+		c.Description,
+		c.Goal,
+		c.CurrentAmount,
+		c.Deadline,
+		c.AllOrNothing,
+		c.Status,
+		c.Outcome,
+		c.Archived,
+		c.CreatedAt,
+		c.UpdatedAt,
+	})
+}
+
+// ListCampaignTransitions lists every status change of the campaign, oldest first
+func (a *Api) ListCampaignTransitions(w http.ResponseWriter, r *http.Request) {
+	c, err := CampaignFromCtx(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	transitions, err := a.transition.ListByCampaignId(r.Context(), c.Id)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := ListCampaignTransitionsResponse{Transitions: make([]CampaignTransitionResponse, 0, len(transitions))}
+	for _, t := range transitions {
+		res.Transitions = append(res.Transitions, CampaignTransitionResponse{t.FromStatus, t.ToStatus, t.ActorId, t.Reason, t.CreatedAt})
+	}
+
+	response.Json(w, &res)
 }
 
 func (a *Api) UpdateCampaign(w http.ResponseWriter, r *http.Request) {
@@ -226,36 +635,46 @@ func (a *Api) UpdateCampaign(w http.ResponseWriter, r *http.Request) {
 	)
 	campaign, err := CampaignFromCtx(r.Context())
 	if err != nil {
-		response.Error(w, http.StatusNotFound, err)
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	token, err := jwtauth.FromContext(r.Context())
 	if err != nil {
-		response.Error(w, http.StatusUnauthorized, err)
+		response.Error(w, r, http.StatusUnauthorized, err)
 		return
 	}
 
 	if campaign.CreatorId != token.Subject() {
-		response.Error(w, http.StatusBadRequest, fmt.Errorf("you can't update campaign created by other users"))
+		response.WriteProblem(w, r, ErrNotCampaignOwner)
 		return
 	}
 
-	if campaign.Archived {
-		response.Error(w, http.StatusBadRequest, fmt.Errorf("campaign is archived"))
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
 		return
 	}
 
-	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+	if req == (UpdateCampaignRequest{}) {
+		response.WriteProblem(w, r, ErrEmptyUpdate)
 		return
 	}
 
-	if req == (UpdateCampaignRequest{}) {
-		response.Error(w, http.StatusBadRequest, fmt.Errorf("No request"))
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
 	}
 
 	if req.Goal != nil {
+		if !req.Goal.IsPositive() {
+			response.WriteProblem(w, r, ErrInvalidGoal)
+			return
+		}
+		// Collected money can't be converted, so goal keeps its currency
+		if req.Goal.Currency() != campaign.CurrentAmount.Currency() {
+			response.WriteProblem(w, r, ErrInvalidGoal.WithDetail("goal currency can't be changed"))
+			return
+		}
 		campaign.Goal = *req.Goal
 	}
 
@@ -264,20 +683,253 @@ func (a *Api) UpdateCampaign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.Deadline != nil {
+		if !req.Deadline.After(time.Now()) {
+			response.WriteProblem(w, r, ErrInvalidDeadline)
+			return
+		}
 		campaign.Deadline = *req.Deadline
 	}
 
-	err = a.campaign.Update(campaign)
+	err = a.campaign.Update(r.Context(), campaign, token.Subject())
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err)
+		response.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 }
 
+func parseCampaignFilter(q url.Values) (*CampaignFilter, error) {
+	var filter CampaignFilter
+
+	if v := q.Get("creator_id"); v != "" {
+		filter.CreatorId = &v
+	}
+
+	if v := q.Get("status"); v != "" {
+		status, err := ParseCampaignStatus(v)
+		if err != nil {
+			return nil, err
+		}
+		filter.Status = &status
+	}
+
+	if v := q.Get("archived"); v != "" {
+		archived, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archived: %s", v)
+		}
+		filter.Archived = &archived
+	}
+
+	times := []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"deadline_from", &filter.DeadlineFrom},
+		{"deadline_to", &filter.DeadlineTo},
+	}
+	for _, t := range times {
+		if v := q.Get(t.name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s, expected RFC3339 time: %s", t.name, v)
+			}
+			*t.dst = &parsed
+		}
+	}
+
+	// Goal bounds are decimal amounts in the currency from query, RUB by default
+	currency := money.RUB
+	if v := q.Get("currency"); v != "" {
+		c, err := money.ParseCurrency(v)
+		if err != nil {
+			return nil, err
+		}
+		currency = c
+	}
+
+	amounts := []struct {
+		name string
+		dst  **money.Money
+	}{
+		{"goal_min", &filter.GoalMin},
+		{"goal_max", &filter.GoalMax},
+	}
+	for _, a := range amounts {
+		if v := q.Get(a.name); v != "" {
+			parsed, err := money.Parse(v, currency)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", a.name, v)
+			}
+			*a.dst = &parsed
+		}
+	}
+
+	uints := []struct {
+		name string
+		dst  **uint
+	}{
+		{"funded_min", &filter.FundedMin},
+		{"funded_max", &filter.FundedMax},
+	}
+	for _, u := range uints {
+		if v := q.Get(u.name); v != "" {
+			parsed, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", u.name, v)
+			}
+			n := uint(parsed)
+			*u.dst = &n
+		}
+	}
+
+	return &filter, nil
+}
+
+// Encode sets query parameters of the filter, it's the inverse of parseCampaignFilter.
+// Goal bounds are sent in currency of GoalMin, or of GoalMax if there is no lower bound
+func (f *CampaignFilter) Encode(q url.Values) {
+	if f.CreatorId != nil {
+		q.Set("creator_id", *f.CreatorId)
+	}
+	if f.Status != nil {
+		q.Set("status", string(*f.Status))
+	}
+	if f.Archived != nil {
+		q.Set("archived", strconv.FormatBool(*f.Archived))
+	}
+	if f.DeadlineFrom != nil {
+		q.Set("deadline_from", f.DeadlineFrom.Format(time.RFC3339Nano))
+	}
+	if f.DeadlineTo != nil {
+		q.Set("deadline_to", f.DeadlineTo.Format(time.RFC3339Nano))
+	}
+	if f.GoalMin != nil {
+		q.Set("currency", string(f.GoalMin.Currency()))
+		q.Set("goal_min", f.GoalMin.Decimal())
+	}
+	if f.GoalMax != nil {
+		if f.GoalMin == nil {
+			q.Set("currency", string(f.GoalMax.Currency()))
+		}
+		q.Set("goal_max", f.GoalMax.Decimal())
+	}
+	if f.FundedMin != nil {
+		q.Set("funded_min", strconv.FormatUint(uint64(*f.FundedMin), 10))
+	}
+	if f.FundedMax != nil {
+		q.Set("funded_max", strconv.FormatUint(uint64(*f.FundedMax), 10))
+	}
+}
+
+// ApplyDonationEvent applies payment service event to campaign current amount,
+// repeated events are acknowledged without changing anything
+func (a *Api) ApplyDonationEvent(w http.ResponseWriter, r *http.Request) {
+	var req DonationEventRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !req.Amount.IsPositive() {
+		response.WriteProblem(w, r, ErrInvalidAmount)
+		return
+	}
+
+	d := &CampaignDonated{
+		CampaignId:    req.CampaignId,
+		AccountId:     req.AccountId,
+		AmountDonated: req.Amount,
+		PaymentId:     req.PaymentId,
+		DonatedAt:     req.OccurredAt,
+	}
+
+	var (
+		applied bool
+		err     error
+	)
+	switch req.Type {
+	case DonationEventSucceeded:
+		applied, err = a.campaignDonated.ApplyDonated(r.Context(), d)
+	case DonationEventRefunded:
+		d.RefundedAt = &req.OccurredAt
+		applied, err = a.campaignDonated.ApplyRefunded(r.Context(), d)
+	}
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Json(w, &DonationEventResponse{applied})
+}
+
+// ExportAccount returns campaigns and donations of the account for its personal data export
+func (a *Api) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	accountId := chi.URLParam(r, "accountId")
+	if err := validate.Var(accountId, "uuid"); err != nil {
+		response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("accountId must be uuid"))
+		return
+	}
+
+	campaigns, err := a.campaign.ListByCreatorId(r.Context(), accountId)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	donations, err := a.campaignDonated.ListByAccountId(r.Context(), accountId)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := AccountExportResponse{
+		Campaigns: make([]GetCampaignResponse, 0, len(campaigns)),
+		Donations: make([]DonationResponse, 0, len(donations)),
+	}
+	for _, c := range campaigns {
+		res.Campaigns = append(res.Campaigns, GetCampaignResponse{
+			c.Id,
+			c.CreatorId,
+			c.Name,
+			c.Description,
+			c.Goal,
+			c.CurrentAmount,
+			c.Deadline,
+			c.AllOrNothing,
+			c.Status,
+			c.Outcome,
+			c.Archived,
+			c.CreatedAt,
+			c.UpdatedAt,
+		})
+	}
+	for _, d := range donations {
+		res.Donations = append(res.Donations, DonationResponse{
+			CampaignId: d.CampaignId,
+			Amount:     d.AmountDonated,
+			PaymentId:  d.PaymentId,
+			DonatedAt:  d.DonatedAt,
+			RefundedAt: d.RefundedAt,
+		})
+	}
+
+	response.Json(w, &res)
+}
+
 func (a *Api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.r.ServeHTTP(w, r)
 }
 
+// Routes returns routes of the api, openapi_test.go checks them against Spec
+func (a *Api) Routes() chi.Routes {
+	return a.r
+}
+
 func NewCampaignContext(ctx context.Context, c *Campaign, err error) context.Context {
 	ctx = context.WithValue(ctx, campaignKey, c)
 	ctx = context.WithValue(ctx, errorKey, err)
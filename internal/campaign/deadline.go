@@ -0,0 +1,50 @@
+package campaign
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const deadlineBatchSize = 50
+
+// DeadlineScheduler closes campaigns past their deadline. Campaigns are locked with SKIP LOCKED,
+// so every replica can run it without closing the same campaign twice
+type DeadlineScheduler struct {
+	campaign CampaignModel
+	interval time.Duration
+}
+
+func NewDeadlineScheduler(db *pgxpool.Pool, interval time.Duration) *DeadlineScheduler {
+	return &DeadlineScheduler{&campaignModel{db}, interval}
+}
+
+func (ds *DeadlineScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(ds.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			closed, err := ds.campaign.CloseOverdue(ctx, deadlineBatchSize)
+			if err != nil {
+				log.Println(fmt.Errorf("unable to close overdue campaigns: %w", err))
+				break
+			}
+			for _, c := range closed {
+				log.Printf("Campaign %d closed after deadline, outcome %s", c.Id, *c.Outcome)
+			}
+			if len(closed) < deadlineBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package campaign_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/internalapi"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+// donate applies succeeded donation to the campaign the way payment service does
+func (c *campaignTest) donate(t *testing.T, campaignId int, amount money.Money) {
+	t.Helper()
+
+	b, err := json.Marshal(&campaign.DonationEventRequest{
+		Type:       campaign.DonationEventSucceeded,
+		PaymentId:  time.Now().Format(time.RFC3339Nano),
+		CampaignId: campaignId,
+		AccountId:  otherId,
+		Amount:     amount,
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url+"/internal/donation-events", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	internalapi.SetToken(req, "token")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("donation event responded with %s", res.Status)
+	}
+}
+
+// pastDeadline moves deadline of the campaign an hour back
+func (c *campaignTest) pastDeadline(t *testing.T, campaignId int) {
+	t.Helper()
+
+	if _, err := c.pool.Exec(context.Background(), `UPDATE Campaign SET deadline = current_timestamp - interval '1 hour' WHERE id = $1`, campaignId); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *campaignTest) transitions(t *testing.T, campaignId int) []campaign.CampaignStatus {
+	t.Helper()
+
+	rows, err := c.pool.Query(context.Background(), `SELECT to_status FROM CampaignTransition WHERE campaign_id = $1 ORDER BY id`, campaignId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []campaign.CampaignStatus
+	for rows.Next() {
+		var s campaign.CampaignStatus
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return statuses
+}
+
+func TestOverdueCampaignsAreClosedWithOutcome(t *testing.T) {
+	c := newCampaignTest(t)
+	ctx := context.Background()
+	creator := c.client(t, creatorId, jwtauth.RoleUser)
+
+	create := func(draft bool) int {
+		req := newCampaignRequest()
+		req.Draft = draft
+		created, err := creator.CreateCampaign(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return created.Id
+	}
+	unfunded, funded, draft := create(false), create(false), create(true)
+	c.donate(t, unfunded, money.New(1000, money.RUB))
+	c.donate(t, funded, money.New(1000000, money.RUB))
+	for _, id := range []int{unfunded, funded, draft} {
+		c.pastDeadline(t, id)
+	}
+
+	closed, err := campaign.NewCampaignModel(c.pool).CloseOverdue(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 2 {
+		t.Fatalf("closed %d campaigns, want 2", len(closed))
+	}
+
+	tests := []struct {
+		name        string
+		id          int
+		status      campaign.CampaignStatus
+		outcome     campaign.CampaignOutcome
+		transitions []campaign.CampaignStatus
+	}{
+		{"below goal", unfunded, campaign.StatusClosed, campaign.OutcomeUnfunded,
+			[]campaign.CampaignStatus{campaign.StatusExpired, campaign.StatusClosed}},
+		{"goal reached", funded, campaign.StatusClosed, campaign.OutcomeFunded,
+			[]campaign.CampaignStatus{campaign.StatusFunded, campaign.StatusClosed}},
+		// Drafts wait for creator to move the deadline
+		{"draft", draft, campaign.StatusDraft, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := creator.GetCampaign(ctx, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var outcome campaign.CampaignOutcome
+			if got.Outcome != nil {
+				outcome = *got.Outcome
+			}
+			if got.Status != tt.status || outcome != tt.outcome {
+				t.Fatalf("campaign is %s with outcome %q, want %s with outcome %q", got.Status, outcome, tt.status, tt.outcome)
+			}
+			if transitions := c.transitions(t, tt.id); !slices.Equal(transitions, tt.transitions) {
+				t.Fatalf("campaign went through %v, want %v", transitions, tt.transitions)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package campaign_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+func newCampaignRequest() *client.CreateCampaignRequest {
+	return &client.CreateCampaignRequest{
+		Name:     "Playground",
+		Goal:     money.New(1000000, money.RUB),
+		Deadline: time.Now().Add(30 * 24 * time.Hour),
+		Draft:    true,
+	}
+}
+
+func TestDraftIsSeenByCreatorAndStaff(t *testing.T) {
+	c := newCampaignTest(t)
+	ctx := context.Background()
+
+	creator := c.client(t, creatorId, jwtauth.RoleUser)
+	draft, err := creator.CreateCampaign(ctx, newCampaignRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	draftStatus := campaign.StatusDraft
+	tests := []struct {
+		name   string
+		client *client.Client
+		seen   bool
+	}{
+		{"anonymous", c.client(t, "", ""), false},
+		{"other user", c.client(t, otherId, jwtauth.RoleUser), false},
+		{"creator", creator, true},
+		{"staff", c.client(t, staffId, jwtauth.RoleModerator), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.client.GetCampaign(ctx, draft.Id)
+			if tt.seen && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.seen && client.ErrorCode(err) != campaign.CodeCampaignNotFound {
+				t.Fatalf("got %v, want %s", err, campaign.CodeCampaignNotFound)
+			}
+
+			_, err = tt.client.CampaignHistory(ctx, draft.Id, nil)
+			if !tt.seen && client.ErrorCode(err) != campaign.CodeCampaignNotFound {
+				t.Fatalf("history: got %v, want %s", err, campaign.CodeCampaignNotFound)
+			}
+
+			list, err := tt.client.ListCampaigns(ctx, &client.ListCampaignsOptions{
+				CampaignFilter: client.CampaignFilter{Status: &draftStatus},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen := len(list.Campaigns) == 1 && list.Total == 1; seen != tt.seen {
+				t.Fatalf("draft is listed: %t, want %t", seen, tt.seen)
+			}
+		})
+	}
+}
+
+func TestCreateCampaignValidation(t *testing.T) {
+	c := newCampaignTest(t)
+	ctx := context.Background()
+	creator := c.client(t, creatorId, jwtauth.RoleUser)
+
+	noName := newCampaignRequest()
+	noName.Name = ""
+	var p *client.Problem
+	if _, err := creator.CreateCampaign(ctx, noName); !errors.As(err, &p) || p.Status != http.StatusBadRequest {
+		t.Fatalf("got %v, want bad request", err)
+	}
+
+	past := newCampaignRequest()
+	past.Deadline = time.Now().Add(-time.Hour)
+	if _, err := creator.CreateCampaign(ctx, past); client.ErrorCode(err) != campaign.CodeInvalidDeadline {
+		t.Fatalf("got %v, want %s", err, campaign.CodeInvalidDeadline)
+	}
+
+	draft, err := creator.CreateCampaign(ctx, newCampaignRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := creator.UpdateCampaign(ctx, draft.Id, &client.UpdateCampaignRequest{Deadline: &past.Deadline}); client.ErrorCode(err) != campaign.CodeInvalidDeadline {
+		t.Fatalf("got %v, want %s", err, campaign.CodeInvalidDeadline)
+	}
+}
+
+func TestDraftIsPublishedOnlyBeforeDeadline(t *testing.T) {
+	c := newCampaignTest(t)
+	ctx := context.Background()
+	creator := c.client(t, creatorId, jwtauth.RoleUser)
+
+	draft, err := creator.CreateCampaign(ctx, newCampaignRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.pool.Exec(ctx, `UPDATE Campaign SET deadline = current_timestamp - interval '1 hour' WHERE id = $1`, draft.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	publish := &client.ChangeCampaignStatusRequest{Status: campaign.StatusActive}
+	if _, err := creator.ChangeCampaignStatus(ctx, draft.Id, publish); client.ErrorCode(err) != campaign.CodeDeadlinePassed {
+		t.Fatalf("got %v, want %s", err, campaign.CodeDeadlinePassed)
+	}
+
+	// Draft stays editable, so creator moves the deadline and publishes it
+	deadline := time.Now().Add(24 * time.Hour)
+	if err := creator.UpdateCampaign(ctx, draft.Id, &client.UpdateCampaignRequest{Deadline: &deadline}); err != nil {
+		t.Fatal(err)
+	}
+	published, err := creator.ChangeCampaignStatus(ctx, draft.Id, publish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published.Status != campaign.StatusActive {
+		t.Fatalf("campaign is %s, want %s", published.Status, campaign.StatusActive)
+	}
+}
@@ -0,0 +1,44 @@
+package campaign
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+// Error codes of campaign api, clients branch on them so they never change
+const (
+	CodeCampaignNotFound    = "campaign_not_found"
+	CodeNotCampaignOwner    = "not_campaign_owner"
+	CodeCampaignNotEditable = "campaign_not_editable"
+	CodeIllegalTransition   = "illegal_transition"
+	CodeDeadlinePassed      = "deadline_passed"
+	CodeRevisionNotFound    = "revision_not_found"
+	CodeInvalidQuery        = "invalid_query"
+	CodeInvalidGoal         = "invalid_goal"
+	CodeInvalidDeadline     = "invalid_deadline"
+	CodeInvalidAmount       = "invalid_amount"
+	CodeEmptyUpdate         = "empty_update"
+)
+
+var (
+	ErrCampaignNotFound    = response.NewProblem(http.StatusNotFound, CodeCampaignNotFound, "campaign not found")
+	ErrNotCampaignOwner    = response.NewProblem(http.StatusForbidden, CodeNotCampaignOwner, "campaign belongs to other user")
+	ErrCampaignNotEditable = response.NewProblem(http.StatusConflict, CodeCampaignNotEditable, "campaign can't be changed")
+	ErrDeadlinePassed      = response.NewProblem(http.StatusConflict, CodeDeadlinePassed, "deadline has passed, move it to the future before publishing")
+	ErrRevisionNotFound    = response.NewProblem(http.StatusNotFound, CodeRevisionNotFound, "revision not found")
+	ErrInvalidQuery        = response.NewProblem(http.StatusBadRequest, CodeInvalidQuery, "invalid query parameter")
+	ErrInvalidGoal         = response.NewProblem(http.StatusBadRequest, CodeInvalidGoal, "goal must be positive")
+	ErrInvalidDeadline     = response.NewProblem(http.StatusBadRequest, CodeInvalidDeadline, "deadline must be in the future")
+	ErrInvalidAmount       = response.NewProblem(http.StatusBadRequest, CodeInvalidAmount, "amount must be positive")
+	ErrEmptyUpdate         = response.NewProblem(http.StatusBadRequest, CodeEmptyUpdate, "nothing to update")
+)
+
+// transitionProblem describes ErrIllegalTransition with the statuses it was made between
+func transitionProblem(err error) *response.Problem {
+	if errors.Is(err, errDeadlinePassed) {
+		return ErrDeadlinePassed
+	}
+	return response.NewProblem(http.StatusConflict, CodeIllegalTransition, err.Error())
+}
@@ -0,0 +1,209 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/outbox"
+)
+
+type CampaignStatus string
+
+const (
+	StatusDraft   CampaignStatus = "draft"
+	StatusActive  CampaignStatus = "active"
+	StatusFunded  CampaignStatus = "funded"
+	StatusExpired CampaignStatus = "expired"
+	StatusClosed  CampaignStatus = "closed"
+)
+
+// CampaignOutcome is the result of campaign closed after its deadline
+type CampaignOutcome string
+
+const (
+	OutcomeFunded   CampaignOutcome = "funded"
+	OutcomeUnfunded CampaignOutcome = "unfunded"
+)
+
+const (
+	TransitionReasonPublished   = "published"
+	TransitionReasonArchived    = "archived"
+	TransitionReasonGoalReached = "goal reached"
+	TransitionReasonBelowGoal   = "amount dropped below goal"
+	TransitionReasonDeadline    = "deadline passed"
+)
+
+var (
+	ErrIllegalTransition = errors.New("illegal campaign status transition")
+	// errDeadlinePassed is ErrIllegalTransition of campaign activated after its deadline
+	errDeadlinePassed = fmt.Errorf("%w: deadline has passed", ErrIllegalTransition)
+)
+
+// transitions lists allowed transitions, true means creator can request it,
+// the rest are made by the service itself when amount or deadline changes
+var transitions = map[CampaignStatus]map[CampaignStatus]bool{
+	StatusDraft:   {StatusActive: true, StatusClosed: true},
+	StatusActive:  {StatusFunded: false, StatusExpired: false, StatusClosed: true},
+	StatusFunded:  {StatusActive: false, StatusClosed: true},
+	StatusExpired: {StatusClosed: true},
+	StatusClosed:  {},
+}
+
+func ParseCampaignStatus(s string) (CampaignStatus, error) {
+	status := CampaignStatus(s)
+	if _, ok := transitions[status]; !ok {
+		return "", fmt.Errorf("unknown campaign status: %s", s)
+	}
+	return status, nil
+}
+
+// Editable reports whether creator can still change campaign description, goal and deadline
+func (s CampaignStatus) Editable() bool {
+	return s == StatusDraft || s == StatusActive || s == StatusFunded
+}
+
+// Editable reports whether creator can still change the campaign, published campaign can't be changed after deadline
+func (c *Campaign) Editable() bool {
+	return c.Status.Editable() && (c.Status == StatusDraft || c.Deadline.After(time.Now()))
+}
+
+// AcceptsDonations reports whether campaign in the status can be donated to before its deadline
+func (s CampaignStatus) AcceptsDonations() bool {
+	return s == StatusActive || s == StatusFunded
+}
+
+// checkTransition is the only place deciding if campaign can move to the status, byCreator is true
+// for transitions requested by campaign creator. Deadline of activated campaign is checked by transition
+// with database clock, the one deadline sweep uses
+func checkTransition(c *Campaign, to CampaignStatus, byCreator bool) error {
+	manual, ok := transitions[c.Status][to]
+	if !ok || (byCreator && !manual) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, c.Status, to)
+	}
+	return nil
+}
+
+// CampaignTransition is a recorded status change, ActorId is nil for transitions made by the service
+type CampaignTransition struct {
+	Id         int            `db:"id"`
+	CampaignId int            `db:"campaign_id"`
+	FromStatus CampaignStatus `db:"from_status"`
+	ToStatus   CampaignStatus `db:"to_status"`
+	ActorId    *string        `db:"actor_id"`
+	Reason     string         `db:"reason"`
+	CreatedAt  time.Time      `db:"created_at"`
+}
+
+type CampaignTransitionModel interface {
+	ListByCampaignId(ctx context.Context, campaignId int) ([]CampaignTransition, error)
+}
+
+type campaignTransitionModel struct {
+	db *pgxpool.Pool
+}
+
+func (ctm *campaignTransitionModel) ListByCampaignId(ctx context.Context, campaignId int) ([]CampaignTransition, error) {
+	query := `SELECT * FROM CampaignTransition WHERE campaign_id = $1 ORDER BY id`
+
+	return db.QueryAll[CampaignTransition](ctx, db.Conn(ctx, ctm.db), query, campaignId)
+}
+
+// lockCampaign selects campaign for update, so its status can't change until tx ends
+func lockCampaign(ctx context.Context, tx db.Querier, id int) (*Campaign, error) {
+	return db.QueryOne[Campaign](ctx, tx, `SELECT * FROM Campaign WHERE id = $1 FOR UPDATE`, id)
+}
+
+// transition moves locked campaign to the status, records the transition and emits CampaignEventStatusChanged.
+// Campaign closed by its creator is archived
+func transition(ctx context.Context, tx db.Querier, c *Campaign, to CampaignStatus, actorId *string, reason string) (*Campaign, error) {
+	if err := checkTransition(c, to, actorId != nil); err != nil {
+		return nil, err
+	}
+
+	// Deadline sweep skips drafts, so draft past its deadline waits for creator to move the deadline and publish it
+	archived := to == StatusClosed && actorId != nil
+	updated, err := db.QueryOne[Campaign](ctx, tx, `UPDATE Campaign SET status = $2, archived = archived OR $3, updated_at = current_timestamp
+	WHERE id = $1 AND ($2 <> 'active' OR deadline > current_timestamp) RETURNING *`, c.Id, to, archived)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errDeadlinePassed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var t CampaignTransition
+	err = tx.QueryRow(ctx, `INSERT INTO CampaignTransition (campaign_id, from_status, to_status, actor_id, reason)
+	VALUES ($1, $2, $3, $4, $5) RETURNING created_at`, c.Id, c.Status, to, actorId, reason).Scan(&t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &CampaignStatusEvent{
+		CampaignId:   c.Id,
+		From:         c.Status,
+		To:           to,
+		ActorId:      actorId,
+		Reason:       reason,
+		AllOrNothing: updated.AllOrNothing,
+		Archived:     updated.Archived,
+		Outcome:      updated.Outcome,
+		OccurredAt:   t.CreatedAt,
+	}
+	if err := outbox.Insert(ctx, strconv.Itoa(c.Id), CampaignEventStatusChanged, event); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// syncFunded moves campaign between active and funded after its amount or goal changed
+func syncFunded(ctx context.Context, tx db.Querier, id int) error {
+	c, err := lockCampaign(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	cmp, err := c.CurrentAmount.Cmp(c.Goal)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c.Status == StatusActive && cmp >= 0:
+		_, err = transition(ctx, tx, c, StatusFunded, nil, TransitionReasonGoalReached)
+	case c.Status == StatusFunded && cmp < 0:
+		// Funded campaign past its deadline stays funded until the sweep closes it
+		if _, err = transition(ctx, tx, c, StatusActive, nil, TransitionReasonBelowGoal); errors.Is(err, errDeadlinePassed) {
+			err = nil
+		}
+	}
+	return err
+}
+
+// closeOverdue closes locked campaign past its deadline, campaign is funded if it reached its goal.
+// Active campaign goes through expired, so every status it had is recorded
+func closeOverdue(ctx context.Context, tx db.Querier, c *Campaign) (*Campaign, error) {
+	var err error
+	if c.Status == StatusActive {
+		if c, err = transition(ctx, tx, c, StatusExpired, nil, TransitionReasonDeadline); err != nil {
+			return nil, err
+		}
+	}
+
+	outcome := OutcomeUnfunded
+	if c.Status == StatusFunded {
+		outcome = OutcomeFunded
+	}
+
+	if err = db.Exec(ctx, tx, `UPDATE Campaign SET outcome = $2 WHERE id = $1`, c.Id, outcome); err != nil {
+		return nil, err
+	}
+
+	return transition(ctx, tx, c, StatusClosed, nil, TransitionReasonDeadline)
+}
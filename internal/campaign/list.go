@@ -0,0 +1,170 @@
+package campaign
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+type CampaignSort string
+
+const (
+	SortNewest     CampaignSort = "newest"
+	SortEndingSoon CampaignSort = "ending_soon"
+	SortMostFunded CampaignSort = "most_funded"
+)
+
+func ParseCampaignSort(s string) (CampaignSort, error) {
+	switch sort := CampaignSort(s); sort {
+	case "":
+		return SortNewest, nil
+	case SortNewest, SortEndingSoon, SortMostFunded:
+		return sort, nil
+	default:
+		return "", fmt.Errorf("unknown sort: %s", s)
+	}
+}
+
+func (s CampaignSort) orderBy() string {
+	switch s {
+	case SortEndingSoon:
+		return "deadline ASC, id ASC"
+	case SortMostFunded:
+		return fundedRatio + " DESC, id DESC"
+	default:
+		return "created_at DESC, id DESC"
+	}
+}
+
+// CampaignFilter narrows campaign listing, nil fields are not applied
+type CampaignFilter struct {
+	CreatorId *string
+	// Status is any status besides draft if it's nil
+	Status       *CampaignStatus
+	Archived     *bool
+	DeadlineFrom *time.Time
+	DeadlineTo   *time.Time
+	GoalMin      *money.Money
+	GoalMax      *money.Money
+	// FundedMin and FundedMax are bounds of current_amount to goal ratio in percents
+	FundedMin *uint
+	FundedMax *uint
+
+	// viewerId is the account listing campaigns, drafts are listed only for their creator unless staff is set
+	viewerId string
+	staff    bool
+}
+
+// fundedRatio is an expression of current_amount to goal ratio, it doesn't depend on currency, so campaigns
+// collecting different currencies are sorted together. Campaigns with zero goal are considered fully funded.
+// campaign_funded_ratio_idx is built on the same expression
+const fundedRatio = `COALESCE((current_amount).minor::numeric / NULLIF((goal).minor, 0), 1)`
+
+// where returns sql conditions with their positional arguments
+func (f *CampaignFilter) where() ([]string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.CreatorId != nil {
+		add("creator_id = $%d", *f.CreatorId)
+	}
+	if f.Status != nil {
+		add("status = $%d", string(*f.Status))
+	} else {
+		where = append(where, "status <> 'draft'")
+	}
+	if !f.staff {
+		add("(status <> 'draft' OR creator_id::text = $%d)", f.viewerId)
+	}
+	if f.Archived != nil {
+		add("archived = $%d", *f.Archived)
+	}
+	if f.DeadlineFrom != nil {
+		add("deadline >= $%d", *f.DeadlineFrom)
+	}
+	if f.DeadlineTo != nil {
+		add("deadline <= $%d", *f.DeadlineTo)
+	}
+	// Goals in other currencies can't be compared, so they are filtered out
+	if f.GoalMin != nil {
+		add("(goal).currency = $%d", string(f.GoalMin.Currency()))
+		add("(goal).minor >= $%d", f.GoalMin.Minor())
+	}
+	if f.GoalMax != nil {
+		add("(goal).currency = $%d", string(f.GoalMax.Currency()))
+		add("(goal).minor <= $%d", f.GoalMax.Minor())
+	}
+	// Percents are compared multiplied out, integer division would round 99.9% down to 99%
+	if f.FundedMin != nil {
+		add("(current_amount).minor::numeric * 100 >= $%d::bigint::numeric * (goal).minor", *f.FundedMin)
+	}
+	if f.FundedMax != nil {
+		add("(current_amount).minor::numeric * 100 <= $%d::bigint::numeric * (goal).minor", *f.FundedMax)
+	}
+
+	return where, args
+}
+
+func whereClause(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(where, " AND ")
+}
+
+// CampaignCursor points to the last campaign of a page, only the field of the sort is used
+type CampaignCursor struct {
+	Sort          CampaignSort `json:"s"`
+	Id            int          `json:"id"`
+	CreatedAt     time.Time    `json:"c,omitempty"`
+	Deadline      time.Time    `json:"d,omitempty"`
+	CurrentAmount int64        `json:"a,omitempty"`
+	Goal          int64        `json:"g,omitempty"`
+}
+
+func NewCampaignCursor(sort CampaignSort, c *Campaign) *CampaignCursor {
+	cursor := &CampaignCursor{Sort: sort, Id: c.Id}
+	switch sort {
+	case SortEndingSoon:
+		cursor.Deadline = c.Deadline
+	case SortMostFunded:
+		cursor.CurrentAmount, cursor.Goal = c.CurrentAmount.Minor(), c.Goal.Minor()
+	default:
+		cursor.CreatedAt = c.CreatedAt
+	}
+	return cursor
+}
+
+func (c *CampaignCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCampaignCursor decodes cursor and checks that it was made for the same sort order
+func DecodeCampaignCursor(s string, sort CampaignSort) (*CampaignCursor, error) {
+	var cursor CampaignCursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("cursor doesn't match sort order")
+	}
+
+	return &cursor, nil
+}
@@ -0,0 +1,99 @@
+package campaign_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+// fundedCampaigns creates campaigns with goals and amounts in different currencies, returns their ids
+// from the most funded to the least
+func fundedCampaigns(t *testing.T, c *campaignTest) []int {
+	t.Helper()
+	ctx := context.Background()
+	creator := c.client(t, creatorId, jwtauth.RoleUser)
+
+	campaigns := []struct {
+		goal, amount money.Money
+	}{
+		{money.New(1000000, money.RUB), money.New(5000, money.RUB)}, // 0.5%
+		{money.New(1000, money.USD), money.New(1000, money.USD)},    // 100%, less money than the others
+		{money.New(100000, money.RUB), money.New(99900, money.RUB)}, // 99.9%
+	}
+	ids := make([]int, len(campaigns))
+	for i, f := range campaigns {
+		created, err := creator.CreateCampaign(ctx, &client.CreateCampaignRequest{
+			Name:     "Campaign",
+			Goal:     f.goal,
+			Deadline: time.Now().Add(24 * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.pool.Exec(ctx, `UPDATE Campaign SET current_amount = $2 WHERE id = $1`, created.Id, f.amount); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = created.Id
+	}
+	return []int{ids[1], ids[2], ids[0]}
+}
+
+func listIds(t *testing.T, c *client.Client, opts *client.ListCampaignsOptions) []int {
+	t.Helper()
+
+	var ids []int
+	for {
+		page, err := c.ListCampaigns(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, campaign := range page.Campaigns {
+			ids = append(ids, campaign.Id)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func TestListMostFundedSortsByGoalPercent(t *testing.T) {
+	c := newCampaignTest(t)
+	want := fundedCampaigns(t, c)
+
+	// Page of one campaign checks that cursor keeps the order
+	got := listIds(t, c.client(t, "", ""), &client.ListCampaignsOptions{Sort: campaign.SortMostFunded, Limit: 1})
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestListFundedPercentFilter(t *testing.T) {
+	c := newCampaignTest(t)
+	ids := fundedCampaigns(t, c)
+
+	percent := func(n uint) *uint { return &n }
+	tests := []struct {
+		name   string
+		filter client.CampaignFilter
+		want   []int
+	}{
+		{"reached goal", client.CampaignFilter{FundedMin: percent(100)}, ids[:1]},
+		{"almost reached goal", client.CampaignFilter{FundedMin: percent(99)}, ids[:2]},
+		{"below 99 percent", client.CampaignFilter{FundedMax: percent(99)}, ids[2:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &client.ListCampaignsOptions{CampaignFilter: tt.filter, Sort: campaign.SortMostFunded}
+			if got := listIds(t, c.client(t, "", ""), opts); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
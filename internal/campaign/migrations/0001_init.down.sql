@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS Outbox;
+DROP TABLE IF EXISTS CampaignTransition;
+DROP TABLE IF EXISTS CampaignEditHistory;
+DROP TABLE IF EXISTS CampaignDonated;
+DROP TABLE IF EXISTS Campaign;
+DROP TYPE IF EXISTS money_amount;
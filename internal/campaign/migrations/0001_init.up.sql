@@ -0,0 +1,101 @@
+-- Amount of money in minor units (kopecks, cents) with ISO 4217 currency, see pkg/money
+DO $$ BEGIN
+    CREATE TYPE money_amount AS (minor BIGINT, currency VARCHAR(3));
+EXCEPTION
+    WHEN duplicate_object THEN null;
+END $$;
+
+CREATE TABLE IF NOT EXISTS Campaign (
+    id SERIAL PRIMARY KEY,
+    creator_id UUID NOT NULL,
+    -- TODO: think about campaign name length
+    name VARCHAR(255),
+    description TEXT,
+    goal money_amount NOT NULL,
+    -- Always in the same currency as goal
+    current_amount money_amount NOT NULL,
+    deadline TIMESTAMPTZ NOT NULL,
+    archived BOOL DEFAULT false,
+    -- All or nothing campaign refunds every donation if goal isn't reached by deadline
+    all_or_nothing BOOL NOT NULL DEFAULT false,
+    -- draft, active, funded, expired or closed, see internal/campaign/lifecycle.go
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    -- funded or unfunded, set when campaign is closed after deadline
+    outcome VARCHAR(16),
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    -- TODO: make an automatic function changing updated_at
+    updated_at TIMESTAMPTZ DEFAULT current_timestamp
+);
+
+CREATE TABLE IF NOT EXISTS CampaignDonated (
+    id SERIAL PRIMARY KEY,
+    campaign_id INT,
+    account_id UUID NOT NULL,
+    amount_donated money_amount NOT NULL,
+    -- Payment service events are delivered at least once, payment_id makes applying them idempotent
+    payment_id VARCHAR(36) UNIQUE NOT NULL,
+    donated_at TIMESTAMPTZ DEFAULT current_timestamp,
+    refunded_at TIMESTAMPTZ,
+    CONSTRAINT fk_campaign
+        FOREIGN KEY(campaign_id)
+            REFERENCES Campaign(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS CampaignEditHistory (
+    id SERIAL PRIMARY KEY,
+    campaign_id INT NOT NULL,
+    description TEXT,
+    goal money_amount,
+    deadline TIMESTAMPTZ,
+    -- Account that made the edit, row itself keeps values before the edit
+    editor_id UUID NOT NULL,
+    modified_at timestamptz DEFAULT current_timestamp,
+    CONSTRAINT fk_campaign
+        FOREIGN KEY(campaign_id)
+            REFERENCES Campaign(id) ON DELETE CASCADE
+);
+
+-- Every campaign status change, actor_id is NULL for changes made by the service itself
+CREATE TABLE IF NOT EXISTS CampaignTransition (
+    id SERIAL PRIMARY KEY,
+    campaign_id INT NOT NULL,
+    from_status VARCHAR(16) NOT NULL,
+    to_status VARCHAR(16) NOT NULL,
+    actor_id UUID,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    CONSTRAINT fk_campaign
+        FOREIGN KEY(campaign_id)
+            REFERENCES Campaign(id) ON DELETE CASCADE
+);
+
+-- Transactional outbox, see pkg/outbox
+CREATE TABLE IF NOT EXISTS Outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    -- Events of one aggregate (campaign) are delivered in order, the next one waits until the previous is delivered
+    aggregate_id VARCHAR(64) NOT NULL DEFAULT '',
+    -- Relay lease, events are claimed and delivered outside of transaction, expired lease means the relay died
+    locked_until TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_undelivered_idx ON Outbox (next_attempt_at) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_aggregate_idx ON Outbox (aggregate_id, id) WHERE delivered_at IS NULL;
+
+-- Indexes for campaign listing, every sort order has its own index matching the keyset cursor
+CREATE INDEX IF NOT EXISTS campaign_creator_id_idx ON Campaign (creator_id);
+CREATE INDEX IF NOT EXISTS campaign_created_at_idx ON Campaign (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS campaign_deadline_idx ON Campaign (deadline, id);
+-- Most funded campaigns are sorted by percent of the goal, see fundedRatio of list.go.
+-- The expression has to stay the same as there, otherwise the index isn't used
+CREATE INDEX IF NOT EXISTS campaign_funded_ratio_idx
+    ON Campaign ((COALESCE((current_amount).minor::numeric / NULLIF((goal).minor, 0), 1)) DESC, id DESC);
+CREATE INDEX IF NOT EXISTS campaign_edit_history_campaign_id_idx ON CampaignEditHistory (campaign_id, id);
+CREATE INDEX IF NOT EXISTS campaign_status_deadline_idx ON Campaign (status, deadline);
+CREATE INDEX IF NOT EXISTS campaign_transition_campaign_id_idx ON CampaignTransition (campaign_id, id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS AuditLog (
+    id BIGSERIAL PRIMARY KEY,
+    -- actor_id is NULL for actions made by operators with dfctl
+    actor_id UUID,
+    actor_role VARCHAR(16) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    target_type VARCHAR(32) NOT NULL,
+    target_id VARCHAR(64) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
@@ -1,27 +1,39 @@
 package campaign
 
-import "time"
+import (
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
 
 type GetCampaignResponse struct {
-	Id            int       `json:"id"`
-	CreatorId     string    `json:"creator_id"`
-	Name          string    `json:"name"`
-	Description   string    `json:"description"`
-	Goal          uint      `json:"goal"`
-	CurrentAmount uint      `json:"current_amount"`
-	Deadline      time.Time `json:"deadline"`
-	Archived      bool      `json:"archived"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	Id            int         `json:"id"`
+	CreatorId     string      `json:"creator_id"`
+	Name          string      `json:"name"`
+	Description   string      `json:"description"`
+	Goal          money.Money `json:"goal"`
+	CurrentAmount money.Money `json:"current_amount"`
+	Deadline      time.Time   `json:"deadline"`
+	// AllOrNothing campaign refunds every donation if goal isn't reached by deadline
+	AllOrNothing bool           `json:"all_or_nothing"`
+	Status       CampaignStatus `json:"status"`
+	// Outcome is set once campaign is closed after its deadline
+	Outcome   *CampaignOutcome `json:"outcome,omitempty"`
+	Archived  bool             `json:"archived"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
 }
 
 type (
-	// TODO: add verify to fields
+	// CreateCampaignRequest has positive goal and deadline in the future, they are checked by the handler
 	CreateCampaignRequest struct {
-		Name        string    `json:"name"`
-		Description string    `json:"description"`
-		Goal        uint      `json:"goal"`
-		Deadline    time.Time `json:"deadline"`
+		Name         string      `json:"name" validate:"required,max=255"`
+		Description  string      `json:"description" validate:"max=10000"`
+		Goal         money.Money `json:"goal"`
+		Deadline     time.Time   `json:"deadline" validate:"required"`
+		AllOrNothing bool        `json:"all_or_nothing"`
+		// Draft campaign isn't listed and doesn't accept donations until it's published
+		Draft bool `json:"draft"`
 	}
 
 	CreateCampaignResponse = GetCampaignResponse
@@ -29,11 +41,133 @@ type (
 
 type (
 	UpdateCampaignRequest struct {
-		Description *string    `json:"description,omitempty"`
-		Goal        *uint      `json:"goal,omitempty"`
-		Deadline    *time.Time `json:"deadline,omitempty"`
+		Description *string      `json:"description,omitempty" validate:"omitempty,max=10000"`
+		Goal        *money.Money `json:"goal,omitempty"`
+		Deadline    *time.Time   `json:"deadline,omitempty"`
 	}
 
 	UpdateCampaignResponse struct {
 	}
 )
+
+type ListCampaignsResponse struct {
+	Campaigns []GetCampaignResponse `json:"campaigns"`
+	// NextCursor is empty when there are no more campaigns
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+type (
+	FieldChange[T any] struct {
+		Old T `json:"old"`
+		New T `json:"new"`
+	}
+
+	// CampaignChanges contains only fields that were changed by the revision
+	CampaignChanges struct {
+		Description *FieldChange[string]      `json:"description,omitempty"`
+		Goal        *FieldChange[money.Money] `json:"goal,omitempty"`
+		Deadline    *FieldChange[time.Time]   `json:"deadline,omitempty"`
+	}
+
+	CampaignRevisionResponse struct {
+		Revision   int             `json:"revision"`
+		EditorId   string          `json:"editor_id"`
+		ModifiedAt time.Time       `json:"modified_at"`
+		Changes    CampaignChanges `json:"changes"`
+	}
+
+	GetCampaignHistoryResponse struct {
+		Revisions  []CampaignRevisionResponse `json:"revisions"`
+		NextCursor string                     `json:"next_cursor,omitempty"`
+		Total      int                        `json:"total"`
+	}
+
+	// GetCampaignRevisionResponse is the campaign as it was right after the revision, revision 0 is the original campaign.
+	// Only description, goal and deadline are tracked by history, other fields have current values
+	GetCampaignRevisionResponse struct {
+		Revision   int                 `json:"revision"`
+		EditorId   string              `json:"editor_id,omitempty"`
+		ModifiedAt time.Time           `json:"modified_at"`
+		Campaign   GetCampaignResponse `json:"campaign"`
+	}
+)
+
+const (
+	DonationEventSucceeded = "payment.succeeded"
+	DonationEventRefunded  = "payment.refunded"
+)
+
+// DonationEventRequest is sent by payment service outbox relay, the same event may be delivered more than once
+type DonationEventRequest struct {
+	Type       string      `json:"type" validate:"required,oneof=payment.succeeded payment.refunded"`
+	PaymentId  string      `json:"payment_id" validate:"required"`
+	CampaignId int         `json:"campaign_id" validate:"required"`
+	AccountId  string      `json:"account_id" validate:"required,uuid"`
+	Amount     money.Money `json:"amount"`
+	OccurredAt time.Time   `json:"occurred_at" validate:"required"`
+}
+
+type DonationEventResponse struct {
+	// Applied is false when the event was already applied before
+	Applied bool `json:"applied"`
+}
+
+// CampaignEventStatusChanged is campaign outbox event delivered to payment service as CampaignStatusEvent
+const CampaignEventStatusChanged = "campaign.status_changed"
+
+// CampaignStatusEvent is sent to payment service on every campaign status transition,
+// the same event may be delivered more than once
+type CampaignStatusEvent struct {
+	CampaignId   int              `json:"campaign_id" validate:"required"`
+	From         CampaignStatus   `json:"from" validate:"required"`
+	To           CampaignStatus   `json:"to" validate:"required"`
+	ActorId      *string          `json:"actor_id,omitempty"`
+	Reason       string           `json:"reason"`
+	AllOrNothing bool             `json:"all_or_nothing"`
+	Archived     bool             `json:"archived"`
+	Outcome      *CampaignOutcome `json:"outcome,omitempty"`
+	OccurredAt   time.Time        `json:"occurred_at" validate:"required"`
+}
+
+type (
+	ChangeCampaignStatusRequest struct {
+		Status CampaignStatus `json:"status" validate:"required"`
+		Reason string         `json:"reason" validate:"max=255"`
+	}
+
+	CampaignTransitionResponse struct {
+		From      CampaignStatus `json:"from"`
+		To        CampaignStatus `json:"to"`
+		ActorId   *string        `json:"actor_id,omitempty"`
+		Reason    string         `json:"reason"`
+		CreatedAt time.Time      `json:"created_at"`
+	}
+
+	ListCampaignTransitionsResponse struct {
+		Transitions []CampaignTransitionResponse `json:"transitions"`
+	}
+)
+
+type AdminArchiveCampaignRequest struct {
+	// Reason is stored in audit log, campaign transition reason is always archived
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+type (
+	DonationResponse struct {
+		CampaignId int         `json:"campaign_id"`
+		Amount     money.Money `json:"amount"`
+		PaymentId  string      `json:"payment_id"`
+		DonatedAt  time.Time   `json:"donated_at"`
+		RefundedAt *time.Time  `json:"refunded_at,omitempty"`
+	}
+
+	// AccountExportResponse is everything campaign service holds about the account, auth service puts it
+	// into personal data export
+	AccountExportResponse struct {
+		// Campaigns created by the account, drafts and archived ones included
+		Campaigns []GetCampaignResponse `json:"campaigns"`
+		Donations []DonationResponse    `json:"donations"`
+	}
+)
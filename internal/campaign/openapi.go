@@ -0,0 +1,130 @@
+package campaign
+
+import (
+	"net/http"
+
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/openapi"
+)
+
+// Spec is OpenAPI document of campaign api, it has to be changed together with routes of NewController
+func Spec() *openapi.Document {
+	d := openapi.New("Campaign service", "0.1.0").
+		Enum(StatusDraft, StatusActive, StatusFunded, StatusExpired, StatusClosed).
+		Enum(OutcomeFunded, OutcomeUnfunded)
+
+	campaignId := openapi.PathParam("campaignId", openapi.Integer(), "")
+	limit := openapi.QueryParam("limit", openapi.Integer(), "page size, 20 by default and 100 at most")
+
+	d.Add(http.MethodGet, "/", openapi.Route{
+		Summary:     "List campaigns",
+		Description: "Drafts are listed only for their creator and staff, bearer token is optional",
+		Params: []openapi.Parameter{
+			openapi.QueryParam("creator_id", openapi.String(), ""),
+			openapi.QueryParam("status", &openapi.Schema{Type: "string", Enum: []any{StatusDraft, StatusActive, StatusFunded, StatusExpired, StatusClosed}}, ""),
+			openapi.QueryParam("archived", openapi.Boolean(), ""),
+			openapi.QueryParam("deadline_from", openapi.DateTime(), ""),
+			openapi.QueryParam("deadline_to", openapi.DateTime(), ""),
+			openapi.QueryParam("currency", openapi.String(), "currency of goal bounds, RUB by default"),
+			openapi.QueryParam("goal_min", openapi.String(), "decimal amount"),
+			openapi.QueryParam("goal_max", openapi.String(), "decimal amount"),
+			openapi.QueryParam("funded_min", openapi.Integer(), "percent of the goal"),
+			openapi.QueryParam("funded_max", openapi.Integer(), "percent of the goal"),
+			openapi.QueryParam("sort", &openapi.Schema{Type: "string", Enum: []any{SortNewest, SortEndingSoon, SortMostFunded}}, "most_funded sorts by percent of the goal"),
+			limit,
+			openapi.QueryParam("cursor", openapi.String(), "next_cursor of the previous page"),
+		},
+		Response: ListCampaignsResponse{},
+		Errors:   []int{http.StatusBadRequest},
+	})
+	d.Add(http.MethodPost, "/internal/donation-events", openapi.Route{
+		Summary:  "Apply donation event of payment service",
+		Security: openapi.SecurityInternal,
+		Request:  DonationEventRequest{},
+		Response: DonationEventResponse{},
+		Errors:   []int{http.StatusBadRequest},
+	})
+	d.Add(http.MethodGet, "/internal/accounts/{accountId}/export", openapi.Route{
+		Summary:  "Campaigns and donations of the account for its personal data export",
+		Security: openapi.SecurityInternal,
+		Params:   []openapi.Parameter{openapi.PathParam("accountId", &openapi.Schema{Type: "string", Format: "uuid"}, "")},
+		Response: AccountExportResponse{},
+		Errors:   []int{http.StatusBadRequest},
+	})
+	d.Add(http.MethodPost, "/", openapi.Route{
+		Summary:     "Create campaign",
+		Description: "Account email has to be verified",
+		Security:    openapi.SecurityBearer,
+		Request:     CreateCampaignRequest{},
+		Status:      http.StatusCreated,
+		Response:    CreateCampaignResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden},
+	})
+	d.Add(http.MethodGet, "/{campaignId}", openapi.Route{
+		Summary:     "Get campaign",
+		Description: "Draft is found only by its creator and staff, bearer token is optional",
+		Params:      []openapi.Parameter{campaignId},
+		Response:    GetCampaignResponse{},
+		Errors:      []int{http.StatusNotFound},
+	})
+	d.Add(http.MethodGet, "/{campaignId}/history", openapi.Route{
+		Summary: "List campaign revisions",
+		Params: []openapi.Parameter{
+			campaignId,
+			limit,
+			openapi.QueryParam("cursor", openapi.String(), "next_cursor of the previous page"),
+		},
+		Response: GetCampaignHistoryResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	d.Add(http.MethodGet, "/{campaignId}/history/{revision}", openapi.Route{
+		Summary: "Get campaign as it was after the revision",
+		Params: []openapi.Parameter{
+			campaignId,
+			openapi.PathParam("revision", openapi.Integer(), "revision 0 is the original campaign"),
+		},
+		Response: GetCampaignRevisionResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	d.Add(http.MethodGet, "/{campaignId}/transitions", openapi.Route{
+		Summary:  "List campaign status transitions",
+		Params:   []openapi.Parameter{campaignId},
+		Response: ListCampaignTransitionsResponse{},
+		Errors:   []int{http.StatusNotFound},
+	})
+	d.Add(http.MethodPut, "/{campaignId}", openapi.Route{
+		Summary:  "Update campaign",
+		Security: openapi.SecurityBearer,
+		Params:   []openapi.Parameter{campaignId},
+		Request:  UpdateCampaignRequest{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	})
+	d.Add(http.MethodDelete, "/{campaignId}", openapi.Route{
+		Summary:     "Archive campaign",
+		Description: "Campaign is closed and every donation is refunded",
+		Security:    openapi.SecurityBearer,
+		Params:      []openapi.Parameter{campaignId},
+		Errors:      []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	})
+	d.Add(http.MethodPost, "/{campaignId}/status", openapi.Route{
+		Summary:     "Publish or close campaign",
+		Description: "Draft past its deadline isn't published until the deadline is moved to the future",
+		Security:    openapi.SecurityBearer,
+		Params:      []openapi.Parameter{campaignId},
+		Request:     ChangeCampaignStatusRequest{},
+		Response:    GetCampaignResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	})
+	d.Add(http.MethodGet, "/admin/audit", audit.Route())
+	d.Add(http.MethodPost, "/admin/campaigns/{campaignId}/archive", openapi.Route{
+		Summary:     "Archive any campaign as staff",
+		Description: "Campaign is closed and every donation is refunded",
+		Security:    openapi.SecurityBearer,
+		Params:      []openapi.Parameter{campaignId},
+		Request:     AdminArchiveCampaignRequest{},
+		Response:    GetCampaignResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	})
+
+	return d
+}
@@ -0,0 +1,17 @@
+package campaign
+
+import (
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/openapi"
+)
+
+func TestSpecMatchesRoutes(t *testing.T) {
+	a := NewController(nil, jwtauth.New(jwa.HS256, []byte("secret")), "token")
+
+	if err := openapi.Verify(a.Routes(), Spec()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+package campaign
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/internalapi"
+	"github.com/robloxxa/DistrictFunding/pkg/outbox"
+)
+
+// PaymentService is the part of payment service api used by campaign service
+type PaymentService interface {
+	// ApplyCampaignEvent lets payment service react to campaign status change, repeated events are no-op
+	ApplyCampaignEvent(*CampaignStatusEvent) error
+}
+
+type httpPaymentService struct {
+	url           string
+	internalToken string
+	c             *http.Client
+}
+
+func NewPaymentService(url string, internalToken string) PaymentService {
+	return &httpPaymentService{url, internalToken, &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *httpPaymentService) ApplyCampaignEvent(e *CampaignStatusEvent) error {
+	urlString, err := url.JoinPath(s.url, "internal", "campaign-events")
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequest(http.MethodPost, urlString, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	internalapi.SetToken(r, s.internalToken)
+
+	res, err := s.c.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment service responded with %s", res.Status)
+	}
+	return nil
+}
+
+// NewOutboxRelay creates relay delivering campaign events to payment service
+func NewOutboxRelay(db *pgxpool.Pool, payments PaymentService, interval time.Duration) *outbox.Relay {
+	return outbox.NewRelay(db, func(e *outbox.Event) error {
+		switch e.EventType {
+		case CampaignEventStatusChanged:
+			var event CampaignStatusEvent
+			if err := json.Unmarshal(e.Payload, &event); err != nil {
+				return err
+			}
+			return payments.ApplyCampaignEvent(&event)
+		default:
+			return fmt.Errorf("unknown outbox event type: %s", e.EventType)
+		}
+	}, interval)
+}
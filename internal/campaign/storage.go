@@ -2,119 +2,326 @@ package campaign
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
 	"time"
 )
 
 type Campaign struct {
-	Id            int       `db:"id"`
-	CreatorId     string    `db:"creator_id"`
-	Name          string    `db:"name"`
-	Description   string    `db:"description"`
-	Goal          uint      `db:"goal"`
-	CurrentAmount uint      `db:"current_amount"`
-	Deadline      time.Time `db:"deadline"`
-	Archived      bool      `db:"archived"`
-	CreatedAt     time.Time `db:"created_at"`
-	UpdatedAt     time.Time `db:"updated_at"`
+	Id            int              `db:"id"`
+	CreatorId     string           `db:"creator_id"`
+	Name          string           `db:"name"`
+	Description   string           `db:"description"`
+	Goal          money.Money      `db:"goal"`
+	CurrentAmount money.Money      `db:"current_amount"`
+	Deadline      time.Time        `db:"deadline"`
+	Archived      bool             `db:"archived"`
+	CreatedAt     time.Time        `db:"created_at"`
+	UpdatedAt     time.Time        `db:"updated_at"`
+	AllOrNothing  bool             `db:"all_or_nothing"`
+	Status        CampaignStatus   `db:"status"`
+	Outcome       *CampaignOutcome `db:"outcome"`
 }
 
 type CampaignDonated struct {
-	Id            int  `db:"id"`
-	CampaignId    int  `db:"campaign_id"`
-	AccountId     int  `db:"account_id"`
-	AmountDonated uint `db:"amount_donated"`
+	Id            int         `db:"id"`
+	CampaignId    int         `db:"campaign_id"`
+	AccountId     string      `db:"account_id"`
+	AmountDonated money.Money `db:"amount_donated"`
+	PaymentId     string      `db:"payment_id"`
+	DonatedAt     time.Time   `db:"donated_at"`
+	RefundedAt    *time.Time  `db:"refunded_at"`
 }
 
+// CampaignEditHistory is a snapshot of campaign values taken right before the edit made by EditorId
 type CampaignEditHistory struct {
-	Id            int       `db:"id"`
-	CampaignId    int       `db:"campaign_id"`
-	Description   string    `db:"description"`
-	Goal          uint      `db:"goal"`
-	CurrentAmount uint      `db:"current_amount"`
-	Deadline      time.Time `db:"deadline"`
-	ModifiedAt    time.Time `db:"modified_at"`
+	Id          int         `db:"id"`
+	CampaignId  int         `db:"campaign_id"`
+	Description string      `db:"description"`
+	Goal        money.Money `db:"goal"`
+	Deadline    time.Time   `db:"deadline"`
+	EditorId    string      `db:"editor_id"`
+	ModifiedAt  time.Time   `db:"modified_at"`
+}
+
+// CampaignRevision is a history snapshot numbered by its position in campaign history, starting from 1
+type CampaignRevision struct {
+	CampaignEditHistory
+	Revision int `db:"revision"`
 }
 
 type CampaignModel interface {
-	GetById(string) (*Campaign, error)
-	Create(*Campaign) (*Campaign, error)
-	Update(*Campaign) error
-	Archive(int) error
-	//ListByCreatorId(string) ([]Campaign, error)
+	GetById(ctx context.Context, id string) (*Campaign, error)
+	Create(context.Context, *Campaign) (*Campaign, error)
+	Update(ctx context.Context, c *Campaign, editorId string) error
+	// Transition moves campaign to the status, actorId is the creator requesting it or nil for the service itself.
+	// Returns ErrIllegalTransition if the transition isn't allowed
+	Transition(ctx context.Context, id int, to CampaignStatus, actorId *string, reason string) (*Campaign, error)
+	// CloseOverdue closes campaigns past their deadline with funded or unfunded outcome,
+	// active campaigns are expired first. Returns closed campaigns
+	CloseOverdue(ctx context.Context, limit int) ([]Campaign, error)
+	List(ctx context.Context, filter *CampaignFilter, sort CampaignSort, cursor *CampaignCursor, limit int) ([]Campaign, error)
+	Count(ctx context.Context, filter *CampaignFilter) (int, error)
+	ListByCreatorId(ctx context.Context, creatorId string) ([]Campaign, error)
 }
 
 type CampaignDonatedModel interface {
+	// ApplyDonated records the donation and adds it to campaign current amount, returns false if it's already recorded
+	ApplyDonated(context.Context, *CampaignDonated) (bool, error)
+	// ApplyRefunded marks the donation as refunded and subtracts it from campaign current amount,
+	// returns false if it's already refunded
+	ApplyRefunded(context.Context, *CampaignDonated) (bool, error)
+	ListByAccountId(ctx context.Context, accountId string) ([]CampaignDonated, error)
 }
 
 type CampaignEditHistoryModel interface {
-	Create(*CampaignEditHistory) (*CampaignEditHistory, error)
+	Create(context.Context, *CampaignEditHistory) (*CampaignEditHistory, error)
+	ListRevisions(ctx context.Context, campaignId int, after int, limit int) ([]CampaignRevision, error)
+	Count(ctx context.Context, campaignId int) (int, error)
 }
 
 type campaignModel struct {
 	db *pgxpool.Pool
 }
 
-func (cm *campaignModel) GetById(id string) (*Campaign, error) {
+func NewCampaignModel(db *pgxpool.Pool) CampaignModel {
+	return &campaignModel{db}
+}
+
+func (cm *campaignModel) GetById(ctx context.Context, id string) (*Campaign, error) {
 	query :=
 		`SELECT * FROM Campaign WHERE id = $1`
 
-	return db.QueryOneRowToAddrStruct[Campaign](context.Background(), cm.db, query, id)
+	return db.QueryOne[Campaign](ctx, db.Conn(ctx, cm.db), query, id)
 }
 
-func (cm *campaignModel) Create(c *Campaign) (*Campaign, error) {
+func (cm *campaignModel) Create(ctx context.Context, c *Campaign) (*Campaign, error) {
 	query :=
-		`INSERT INTO Campaign (creator_id, name, description, goal, deadline) 
-		VALUES ($1, $2, $3, $4, $5) RETURNING *`
+		`INSERT INTO Campaign (creator_id, name, description, goal, current_amount, deadline, all_or_nothing, status) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *`
 
-	return db.QueryOneRowToAddrStruct[Campaign](context.Background(), cm.db, query, c.CreatorId, c.Name, c.Description, c.Goal, c.Deadline)
+	// Campaign starts with nothing collected in the currency of its goal
+	currentAmount := money.New(0, c.Goal.Currency())
+
+	return db.QueryOne[Campaign](ctx, db.Conn(ctx, cm.db), query, c.CreatorId, c.Name, c.Description, c.Goal, currentAmount, c.Deadline, c.AllOrNothing, c.Status)
 }
 
 // TODO: Maybe use map[string]interface{} instead of campaign struct?
 // Update updates the campaign with new values and creates a new record in campaign history with old params
-func (cm *campaignModel) Update(c *Campaign) error {
-	ctx := context.Background()
-	tx, err := cm.db.Begin(ctx)
-	if err != nil {
-		return err
-	}
+func (cm *campaignModel) Update(ctx context.Context, c *Campaign, editorId string) error {
+	return db.WithTx(ctx, cm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, cm.db)
 
-	defer tx.Rollback(ctx)
+		if err := db.Exec(ctx, tx, `INSERT INTO CampaignEditHistory (campaign_id, description, goal, deadline, editor_id)
+		SELECT id, description, goal, deadline, $2 FROM campaign WHERE id = $1`, c.Id, editorId); err != nil {
+			return err
+		}
+		if err := db.Exec(ctx, tx, `UPDATE Campaign SET description = $2, goal = $3, deadline = $4 WHERE id = $1`, c.Id, c.Description, c.Goal, c.Deadline); err != nil {
+			return err
+		}
 
-	if _, err = tx.Exec(ctx, `INSERT INTO CampaignEditHistory (campaign_id, description, goal, deadline)
-	SELECT id, description, goal, deadline FROM campaign WHERE id = $1`, c.Id); err != nil {
-		return err
-	}
-	if _, err = tx.Exec(ctx, `UPDATE Campaign SET description = $2, goal = $3, deadline = $4 WHERE id = $1`, c.Id, c.Description, c.Goal, c.Deadline); err != nil {
-		return err
-	}
+		// Changed goal may make campaign funded or not funded anymore
+		return syncFunded(ctx, tx, c.Id)
+	})
+}
+
+func (cm *campaignModel) Transition(ctx context.Context, id int, to CampaignStatus, actorId *string, reason string) (*Campaign, error) {
+	var c *Campaign
+	err := db.WithTx(ctx, cm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, cm.db)
+
+		locked, err := lockCampaign(ctx, tx, id)
+		if err != nil {
+			return err
+		}
 
-	if err = tx.Commit(ctx); err != nil {
+		c, err = transition(ctx, tx, locked, to, actorId, reason)
 		return err
+	})
+	return c, err
+}
+
+func (cm *campaignModel) CloseOverdue(ctx context.Context, limit int) ([]Campaign, error) {
+	var closed []Campaign
+	err := db.WithTx(ctx, cm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, cm.db)
+
+		// Locked campaigns are being closed by another replica
+		campaigns, err := db.QueryAll[Campaign](ctx, tx, `SELECT * FROM Campaign WHERE status IN ('active', 'funded', 'expired') AND deadline < current_timestamp
+		ORDER BY deadline LIMIT $1 FOR UPDATE SKIP LOCKED`, limit)
+		if err != nil {
+			return err
+		}
+
+		closed = make([]Campaign, 0, len(campaigns))
+		for i := range campaigns {
+			c, err := closeOverdue(ctx, tx, &campaigns[i])
+			if err != nil {
+				return err
+			}
+			closed = append(closed, *c)
+		}
+		return nil
+	})
+	return closed, err
+}
+
+// List returns campaigns matching the filter in sort order, starting after cursor if it's not nil
+func (cm *campaignModel) List(ctx context.Context, filter *CampaignFilter, sort CampaignSort, cursor *CampaignCursor, limit int) ([]Campaign, error) {
+	where, args := filter.where()
+
+	if cursor != nil {
+		args = append(args, cursor.Id)
+		idArg := len(args)
+		switch sort {
+		case SortEndingSoon:
+			args = append(args, cursor.Deadline)
+			where = append(where, fmt.Sprintf("(deadline, id) > ($%d, $%d)", len(args), idArg))
+		case SortMostFunded:
+			// Ratio of the cursor is computed the same way as fundedRatio, so equal ratios compare equal
+			args = append(args, cursor.CurrentAmount, cursor.Goal)
+			where = append(where, fmt.Sprintf("(%s, id) < (COALESCE($%d::bigint::numeric / NULLIF($%d::bigint, 0), 1), $%d)",
+				fundedRatio, len(args)-1, len(args), idArg))
+		default:
+			args = append(args, cursor.CreatedAt)
+			where = append(where, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args), idArg))
+		}
 	}
 
-	return err
+	args = append(args, limit)
+	query := fmt.Sprintf(`SELECT * FROM Campaign %s ORDER BY %s LIMIT $%d`, whereClause(where), sort.orderBy(), len(args))
+
+	return db.QueryAll[Campaign](ctx, db.Conn(ctx, cm.db), query, args...)
 }
 
-func (cm *campaignModel) Archive(id int) error {
+// Count returns total number of campaigns matching the filter
+func (cm *campaignModel) Count(ctx context.Context, filter *CampaignFilter) (int, error) {
+	var count int
+
+	where, args := filter.where()
+	query := fmt.Sprintf(`SELECT count(*) FROM Campaign %s`, whereClause(where))
+
+	if err := db.Conn(ctx, cm.db).QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (cm *campaignModel) ListByCreatorId(ctx context.Context, creatorId string) ([]Campaign, error) {
 	query :=
-		`UPDATE Campaign SET archived = true WHERE id = $1`
-	_, err := cm.db.Exec(context.Background(), query, id)
-	return err
+		`SELECT * FROM Campaign WHERE creator_id = $1 ORDER BY created_at DESC, id DESC`
+
+	return db.QueryAll[Campaign](ctx, db.Conn(ctx, cm.db), query, creatorId)
 }
 
 type campaignDonatedModel struct {
 	db *pgxpool.Pool
 }
 
+func (cdm *campaignDonatedModel) ApplyDonated(ctx context.Context, d *CampaignDonated) (bool, error) {
+	var applied bool
+	err := db.WithTx(ctx, cdm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, cdm.db)
+
+		tag, err := tx.Exec(ctx, `INSERT INTO CampaignDonated (campaign_id, account_id, amount_donated, payment_id, donated_at)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (payment_id) DO NOTHING`, d.CampaignId, d.AccountId, d.AmountDonated, d.PaymentId, d.DonatedAt)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return nil
+		}
+
+		if err := addToCurrentAmount(ctx, tx, d.CampaignId, d.AmountDonated); err != nil {
+			return err
+		}
+
+		applied = true
+		return syncFunded(ctx, tx, d.CampaignId)
+	})
+	return applied, err
+}
+
+func (cdm *campaignDonatedModel) ApplyRefunded(ctx context.Context, d *CampaignDonated) (bool, error) {
+	var applied bool
+	err := db.WithTx(ctx, cdm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, cdm.db)
+
+		var amount money.Money
+		err := tx.QueryRow(ctx, `UPDATE CampaignDonated SET refunded_at = $2
+		WHERE payment_id = $1 AND refunded_at IS NULL RETURNING amount_donated`, d.PaymentId, d.RefundedAt).Scan(&amount)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			// Refund may come before the donation itself, then donation is recorded as already refunded,
+			// so late donation event doesn't change current amount. If it's already refunded nothing is changed
+			return db.Exec(ctx, tx, `INSERT INTO CampaignDonated (campaign_id, account_id, amount_donated, payment_id, donated_at, refunded_at)
+			VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (payment_id) DO NOTHING`,
+				d.CampaignId, d.AccountId, d.AmountDonated, d.PaymentId, d.DonatedAt, d.RefundedAt)
+		case err != nil:
+			return err
+		}
+
+		if err := addToCurrentAmount(ctx, tx, d.CampaignId, amount.Neg()); err != nil {
+			return err
+		}
+
+		applied = true
+		return syncFunded(ctx, tx, d.CampaignId)
+	})
+	return applied, err
+}
+
+func (cdm *campaignDonatedModel) ListByAccountId(ctx context.Context, accountId string) ([]CampaignDonated, error) {
+	query :=
+		`SELECT * FROM CampaignDonated WHERE account_id = $1 ORDER BY donated_at DESC, id DESC`
+
+	return db.QueryAll[CampaignDonated](ctx, db.Conn(ctx, cdm.db), query, accountId)
+}
+
+func addToCurrentAmount(ctx context.Context, tx db.Querier, campaignId int, amount money.Money) error {
+	tag, err := tx.Exec(ctx, `UPDATE Campaign SET current_amount = ROW((current_amount).minor + $2, (current_amount).currency)::money_amount
+	WHERE id = $1 AND (current_amount).currency = $3`, campaignId, amount.Minor(), string(amount.Currency()))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("campaign %d not found or its currency is not %s", campaignId, amount.Currency())
+	}
+	return nil
+}
+
 type campaignEditHistoryModel struct {
 	db *pgxpool.Pool
 }
 
-func (chm campaignEditHistoryModel) Create(ch *CampaignEditHistory) (*CampaignEditHistory, error) {
+func (chm campaignEditHistoryModel) Create(ctx context.Context, ch *CampaignEditHistory) (*CampaignEditHistory, error) {
+	query :=
+		`INSERT INTO campaignedithistory (campaign_id, description, goal, deadline, editor_id) VALUES ($1, $2, $3, $4, $5) RETURNING *`
+
+	return db.QueryOne[CampaignEditHistory](ctx, db.Conn(ctx, chm.db), query, ch.CampaignId, ch.Description, ch.Goal, ch.Deadline, ch.EditorId)
+}
+
+// ListRevisions returns up to limit revisions of the campaign with revision number greater than after
+func (chm campaignEditHistoryModel) ListRevisions(ctx context.Context, campaignId int, after int, limit int) ([]CampaignRevision, error) {
 	query :=
-		`INSERT INTO campaignedithistory (campaign_id, description, goal, deadline) VALUES ($1, $2, $3, $4)`
+		`SELECT * FROM (
+			SELECT *, row_number() OVER (ORDER BY id) AS revision FROM CampaignEditHistory WHERE campaign_id = $1
+		) h WHERE revision > $2 ORDER BY revision LIMIT $3`
+
+	return db.QueryAll[CampaignRevision](ctx, db.Conn(ctx, chm.db), query, campaignId, after, limit)
+}
 
-	return db.QueryOneRowToAddrStruct[CampaignEditHistory](context.Background(), chm.db, query, ch.CampaignId, ch.Description, ch.Goal, ch.Deadline)
+func (chm campaignEditHistoryModel) Count(ctx context.Context, campaignId int) (int, error) {
+	var count int
+
+	query := `SELECT count(*) FROM CampaignEditHistory WHERE campaign_id = $1`
+
+	if err := db.Conn(ctx, chm.db).QueryRow(ctx, query, campaignId).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
 }
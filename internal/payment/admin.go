@@ -0,0 +1,90 @@
+package payment
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// Audit log actions of payment admin api
+const (
+	AuditPaymentList = "payment.list"
+
+	AuditTargetPayment = "payment"
+)
+
+// ListPayments lists payments of every user for staff, filtered by campaign_id, user_id and status
+func (a *Api) ListPayments(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var filter PaymentFilter
+	if v := q.Get("campaign_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			response.WriteProblem(w, r, ErrInvalidCampaignId)
+			return
+		}
+		filter.CampaignId = id
+	}
+	if v := q.Get("user_id"); v != "" {
+		if err := validate.Var(v, "uuid"); err != nil {
+			response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("user_id must be uuid"))
+			return
+		}
+		filter.UserId = v
+	}
+	filter.Status = q.Get("status")
+
+	limit := defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("limit must be between 1 and %d", maxListLimit))
+			return
+		}
+		limit = n
+	}
+
+	var before int
+	if v := q.Get("cursor"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("invalid cursor"))
+			return
+		}
+		before = n
+	}
+
+	payments, err := a.payment.List(r.Context(), &filter, before, limit+1)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Reading payments of other users is an action too, so staff can't browse them unnoticed
+	entry := audit.New(r, AuditPaymentList, AuditTargetPayment, "*")
+	if err := audit.Record(r.Context(), db.Conn(r.Context(), a.db), entry, &filter); err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := ListPaymentsResponse{Payments: make([]PaymentResponse, 0, len(payments))}
+	if len(payments) > limit {
+		payments = payments[:limit]
+		res.NextCursor = strconv.Itoa(payments[limit-1].Id)
+	}
+	for _, p := range payments {
+		res.Payments = append(res.Payments, *newPaymentResponse(&p))
+	}
+
+	response.Json(w, &res)
+}
@@ -0,0 +1,93 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/internalapi"
+)
+
+var (
+	ErrCampaignNotFound = campaign.ErrCampaignNotFound
+)
+
+// CampaignService is the part of campaign service api used by payment service
+type CampaignService interface {
+	GetCampaign(id int) (*campaign.GetCampaignResponse, error)
+	// ApplyDonationEvent updates campaign amount, applying the same event again is no-op
+	ApplyDonationEvent(*campaign.DonationEventRequest) error
+}
+
+type httpCampaignService struct {
+	url           string
+	internalToken string
+	c             *http.Client
+}
+
+func NewCampaignService(url string, internalToken string) CampaignService {
+	return &httpCampaignService{url, internalToken, &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *httpCampaignService) GetCampaign(id int) (*campaign.GetCampaignResponse, error) {
+	var c campaign.GetCampaignResponse
+
+	urlString, err := url.JoinPath(s.url, strconv.Itoa(id))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.c.Get(urlString)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrCampaignNotFound
+	default:
+		return nil, fmt.Errorf("campaign service responded with %s", res.Status)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *httpCampaignService) ApplyDonationEvent(e *campaign.DonationEventRequest) error {
+	urlString, err := url.JoinPath(s.url, "internal", "donation-events")
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, urlString, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	internalapi.SetToken(req, s.internalToken)
+
+	res, err := s.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("campaign service responded with %s", res.Status)
+	}
+	return nil
+}
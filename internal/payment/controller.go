@@ -1,37 +1,627 @@
 package payment
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/internalapi"
 	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
-	"net/http"
+	"github.com/robloxxa/DistrictFunding/pkg/openapi"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
 )
 
+// payoutStepUpAge is how recent two-factor check of payout access token has to be
+const payoutStepUpAge = 10 * time.Minute
+
 type Api struct {
-	r  chi.Router
-	ja *jwtauth.JWTAuth
+	r         chi.Router
+	db        *pgxpool.Pool
+	ja        *jwtauth.JWTAuth
+	provider  PaymentProvider
+	campaigns CampaignService
+	payment   PaymentModel
+	refundJob RefundJobModel
+	payout    PayoutModel
+	// payoutFeeBps is platform fee taken from payouts in basis points
+	payoutFeeBps int64
 }
 
-func NewController(db *pgxpool.Pool, ja *jwtauth.JWTAuth) *Api {
+// NewController creates payment api, internalToken protects routes called by other services
+func NewController(db *pgxpool.Pool, ja *jwtauth.JWTAuth, provider PaymentProvider, campaigns CampaignService, internalToken string) *Api {
 	a := &Api{
 		chi.NewRouter(),
+		db,
 		ja,
+		provider,
+		campaigns,
+		&paymentModel{db},
+		&refundJobModel{db},
+		&payoutModel{db},
+		0,
 	}
 
+	a.r.Post("/webhook", a.Webhook)
+
+	a.r.Route("/internal", func(r chi.Router) {
+		r.Use(internalapi.RequireToken(internalToken))
+
+		r.Post("/campaign-events", a.ApplyCampaignEvent)
+		r.Get("/accounts/{accountId}/export", a.ExportAccount)
+	})
+
 	a.r.Route("/campaign/{campaignId}", func(r chi.Router) {
+		r.Get("/refunds", a.GetCampaignRefunds)
+
+		r.Group(func(r chi.Router) {
+			r.Use(jwtauth.Verifier(ja))
+			r.Use(jwtauth.Authenticator)
+
+			r.With(jwtauth.RequireVerifiedEmail).Post("/donate", a.DonateCampaign)
+			r.With(jwtauth.RequireStepUp(payoutStepUpAge)).Post("/payout", a.PayoutCampaign)
+			r.Get("/payouts", a.ListCampaignPayouts)
+		})
+	})
+
+	// Staff routes, every action is recorded in audit log
+	a.r.Route("/admin", func(r chi.Router) {
+		r.Use(jwtauth.Verifier(ja))
+		r.Use(jwtauth.Authenticator)
 
+		r.With(jwtauth.RequirePermission(jwtauth.PermissionReadAudit)).Get("/audit", audit.ListHandler(db))
+		r.With(jwtauth.RequirePermission(jwtauth.PermissionReadPayments)).Get("/payments", a.ListPayments)
 	})
+	openapi.Serve(a.r, Spec())
+
+	return a
+}
+
+// WithPayoutFee sets platform fee taken from payouts in basis points (1/100 of percent)
+func (a *Api) WithPayoutFee(bps int64) *Api {
+	a.payoutFeeBps = bps
 	return a
 }
 
+// Webhook handles payment provider notifications. Notification body is not trusted,
+// actual payment status is fetched from the provider by payment id
 func (a *Api) Webhook(w http.ResponseWriter, r *http.Request) {
+	var n Notification
+
+	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if n.Object.ID == "" {
+		response.WriteProblem(w, r, ErrInvalidNotification)
+		return
+	}
 
+	if strings.HasPrefix(n.Event, "payout.") {
+		a.payoutWebhook(w, r, n.Object.ID)
+		return
+	}
+
+	if _, err := a.payment.GetByPaymentId(r.Context(), n.Object.ID); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrPaymentNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	payment, err := a.provider.GetPayment(n.Object.ID)
+	if err != nil {
+		// Provider retries notifications until it gets 200, so it's fine to fail here
+		response.Error(w, r, http.StatusBadGateway, err)
+		return
+	}
+
+	switch payment.Status {
+	case PaymentStatusSucceeded, PaymentStatusCanceled, PaymentStatusWaitingForCapture:
+		if _, err := a.payment.UpdateStatus(r.Context(), payment.ID, payment.Status, payment.IncomeAmount); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// payoutWebhook updates payout status from the provider
+func (a *Api) payoutWebhook(w http.ResponseWriter, r *http.Request, payoutId string) {
+	record, err := a.payout.GetByPayoutId(r.Context(), payoutId)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrPayoutNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	payout, err := a.provider.GetPayout(payoutId)
+	if err != nil {
+		response.Error(w, r, http.StatusBadGateway, err)
+		return
+	}
+
+	if _, err := a.payout.UpdateStatus(r.Context(), record.Id, payout.ID, payout.Status); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
 }
 
+// DonateCampaign creates provider payment for the campaign and returns url where user confirms it.
+// Client may send Idempotence-Key header, retries with the same key return the same payment
 func (a *Api) DonateCampaign(w http.ResponseWriter, r *http.Request) {
+	var req DonateRequest
+
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	campaignId, err := strconv.Atoi(chi.URLParam(r, "campaignId"))
+	if err != nil {
+		response.WriteProblem(w, r, ErrInvalidCampaignId)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !req.Amount.IsPositive() {
+		response.WriteProblem(w, r, ErrInvalidAmount)
+		return
+	}
+
+	key := r.Header.Get("Idempotence-Key")
+	if key == "" {
+		if key, err = newIdempotenceKey(); err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	} else if len(key) > 64 {
+		response.WriteProblem(w, r, ErrInvalidIdempotenceKey)
+		return
+	}
+
+	existing, err := a.payment.GetByIdempotenceKey(r.Context(), key)
+	switch {
+	case err == nil:
+		if existing.UserId != token.Subject() || existing.CampaignId != campaignId || existing.Amount != req.Amount {
+			response.WriteProblem(w, r, ErrIdempotenceKeyReused)
+			return
+		}
+		response.Json(w, newDonateResponse(existing))
+		return
+	case !errors.Is(err, pgx.ErrNoRows):
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	c, err := a.campaigns.GetCampaign(campaignId)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrCampaignNotFound):
+			response.WriteProblem(w, r, ErrCampaignNotFound)
+		default:
+			response.Error(w, r, http.StatusBadGateway, err)
+		}
+		return
+	}
+
+	if !c.Status.AcceptsDonations() || time.Now().After(c.Deadline) {
+		response.WriteProblem(w, r, ErrNotAcceptingDonations)
+		return
+	}
+
+	if req.Amount.Currency() != c.Goal.Currency() {
+		response.WriteProblem(w, r, ErrCurrencyMismatch.WithDetail("campaign accepts donations only in %s", c.Goal.Currency()))
+		return
+	}
+
+	payment, err := a.provider.CreatePayment(key, &CreatePaymentRequest{
+		Amount:  req.Amount,
+		Capture: true,
+		Confirmation: &Confirmation{
+			Type:      "redirect",
+			ReturnUrl: req.ReturnUrl,
+		},
+		Description: fmt.Sprintf("Donation to campaign #%d", campaignId),
+		Metadata: map[string]interface{}{
+			"campaign_id": campaignId,
+			"user_id":     token.Subject(),
+		},
+	})
+	if err != nil {
+		response.Error(w, r, http.StatusBadGateway, err)
+		return
+	}
+
+	record := &PaymentRecord{
+		PaymentId:      payment.ID,
+		IdempotenceKey: key,
+		UserId:         token.Subject(),
+		CampaignId:     campaignId,
+		Amount:         req.Amount,
+		Status:         payment.Status,
+	}
+	if payment.Confirmation != nil {
+		record.ConfirmationUrl = payment.Confirmation.ConfirmationUrl
+	}
+
+	record, err = a.payment.Create(r.Context(), record)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Printf("Created payment %s for campaign %d", record.PaymentId, campaignId)
+
+	w.WriteHeader(http.StatusCreated)
+	response.Json(w, newDonateResponse(record))
+}
+
+// PayoutCampaign pays collected donations out to the campaign creator, see payoutAllowed, every donation is paid out once. Payout that failed to reach the provider is retried
+// by the next request with the same idempotence key, so it isn't sent twice
+func (a *Api) PayoutCampaign(w http.ResponseWriter, r *http.Request) {
+	var req PayoutRequest
+
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	campaignId, err := strconv.Atoi(chi.URLParam(r, "campaignId"))
+	if err != nil {
+		response.WriteProblem(w, r, ErrInvalidCampaignId)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	c, ok := a.creatorCampaign(w, r, campaignId, token.Subject())
+	if !ok {
+		return
+	}
+
+	if !payoutAllowed(c) {
+		response.WriteProblem(w, r, ErrPayoutNotAllowed)
+		return
+	}
+
+	record, err := a.payout.GetPending(r.Context(), campaignId)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		key, err := newIdempotenceKey()
+		if err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		record, err = a.payout.Reserve(r.Context(), &PayoutRecord{
+			IdempotenceKey: key,
+			UserId:         token.Subject(),
+			CampaignId:     campaignId,
+			Destination:    &req.Destination,
+		}, a.payoutFeeBps)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrNothingToPayOut):
+				response.WriteProblem(w, r, ErrNothingToPayOut)
+			case errors.Is(err, ErrCampaignRefunding):
+				response.WriteProblem(w, r, ErrCampaignRefunding)
+			default:
+				response.Error(w, r, http.StatusInternalServerError, err)
+			}
+			return
+		}
+	case err != nil:
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	case record.PayoutId != nil:
+		response.WriteProblem(w, r, ErrPayoutInProgress)
+		return
+	}
+
+	payout, err := a.provider.CreatePayout(record.IdempotenceKey, &CreatePayoutRequest{
+		Amount:                record.Amount,
+		PayoutDestinationData: record.Destination,
+		Description:           fmt.Sprintf("Payout of campaign #%d", campaignId),
+		Metadata: map[string]interface{}{
+			"campaign_id": campaignId,
+			"user_id":     record.UserId,
+		},
+	})
+	if err != nil {
+		// Payout stays pending, so the next request retries it with the same key
+		response.Error(w, r, http.StatusBadGateway, err)
+		return
+	}
+
+	record, err = a.payout.UpdateStatus(r.Context(), record.Id, payout.ID, payout.Status)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Printf("Created payout %s of %s for campaign %d", payout.ID, record.Amount, campaignId)
+
+	w.WriteHeader(http.StatusCreated)
+	response.Json(w, newPayoutResponse(record))
+}
+
+// ListCampaignPayouts lists payouts of the campaign to its creator
+func (a *Api) ListCampaignPayouts(w http.ResponseWriter, r *http.Request) {
+	token, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		response.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	campaignId, err := strconv.Atoi(chi.URLParam(r, "campaignId"))
+	if err != nil {
+		response.WriteProblem(w, r, ErrInvalidCampaignId)
+		return
+	}
+
+	if _, ok := a.creatorCampaign(w, r, campaignId, token.Subject()); !ok {
+		return
+	}
+
+	payouts, err := a.payout.ListByCampaignId(r.Context(), campaignId)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
 
+	res := ListPayoutsResponse{Payouts: make([]PayoutResponse, 0, len(payouts))}
+	for i := range payouts {
+		res.Payouts = append(res.Payouts, *newPayoutResponse(&payouts[i]))
+	}
+
+	response.Json(w, &res)
+}
+
+// payoutAllowed reports whether campaign donations can be paid out to its creator. Campaign is paid out only
+// after it's closed at its deadline, before that creator can still archive it and its donations are refunded.
+// Campaign has to reach its goal, unless it's a keep it all campaign which is paid out whatever it collected
+func payoutAllowed(c *campaign.GetCampaignResponse) bool {
+	if c.Status != campaign.StatusClosed || c.Archived || c.Outcome == nil {
+		return false
+	}
+	return *c.Outcome == campaign.OutcomeFunded || !c.AllOrNothing
+}
+
+// creatorCampaign fetches the campaign and checks it's created by userId, writes error response otherwise
+func (a *Api) creatorCampaign(w http.ResponseWriter, r *http.Request, campaignId int, userId string) (*campaign.GetCampaignResponse, bool) {
+	c, err := a.campaigns.GetCampaign(campaignId)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrCampaignNotFound):
+			response.WriteProblem(w, r, ErrCampaignNotFound)
+		default:
+			response.Error(w, r, http.StatusBadGateway, err)
+		}
+		return nil, false
+	}
+
+	if c.CreatorId != userId {
+		response.WriteProblem(w, r, ErrNotCampaignOwner)
+		return nil, false
+	}
+
+	return c, true
+}
+
+// ApplyCampaignEvent reacts to campaign status change sent by campaign service. Donations of campaign closed
+// by its creator or of all or nothing campaign that expired without reaching its goal are refunded
+func (a *Api) ApplyCampaignEvent(w http.ResponseWriter, r *http.Request) {
+	var e campaign.CampaignStatusEvent
+
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		response.WriteProblem(w, r, response.ErrInvalidBody)
+		return
+	}
+
+	if err := validate.Struct(e); err != nil {
+		response.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var reason string
+	switch {
+	case e.To == campaign.StatusClosed && e.Archived:
+		reason = RefundReasonArchived
+	case e.To == campaign.StatusExpired && e.AllOrNothing:
+		reason = RefundReasonGoalNotReached
+	default:
+		response.Message(w, "nothing to do")
+		return
+	}
+
+	// Repeated event returns the existing job
+	job, err := a.refundJob.Create(r.Context(), e.CampaignId, reason, e.OccurredAt)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Printf("Queued refund job %d for campaign %d (%s)", job.Id, job.CampaignId, job.Reason)
+
+	progress, err := a.refundJob.GetProgress(r.Context(), job.CampaignId)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Json(w, newRefundStatusResponse(progress))
+}
+
+// GetCampaignRefunds returns refund progress of the campaign donations
+func (a *Api) GetCampaignRefunds(w http.ResponseWriter, r *http.Request) {
+	campaignId, err := strconv.Atoi(chi.URLParam(r, "campaignId"))
+	if err != nil {
+		response.WriteProblem(w, r, ErrInvalidCampaignId)
+		return
+	}
+
+	progress, err := a.refundJob.GetProgress(r.Context(), campaignId)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			response.WriteProblem(w, r, ErrRefundNotFound)
+		default:
+			response.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	response.Json(w, newRefundStatusResponse(progress))
+}
+
+// ExportAccount returns donations and payouts of the account for its personal data export
+func (a *Api) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	accountId := chi.URLParam(r, "accountId")
+	if err := validate.Var(accountId, "uuid"); err != nil {
+		response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("accountId must be uuid"))
+		return
+	}
+
+	payments, err := a.payment.ListByUserId(r.Context(), accountId)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	payouts, err := a.payout.ListByUserId(r.Context(), accountId)
+	if err != nil {
+		response.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := AccountExportResponse{
+		Payments: make([]PaymentResponse, 0, len(payments)),
+		Payouts:  make([]PayoutResponse, 0, len(payouts)),
+	}
+	for _, p := range payments {
+		res.Payments = append(res.Payments, *newPaymentResponse(&p))
+	}
+	for _, p := range payouts {
+		res.Payouts = append(res.Payouts, *newPayoutResponse(&p))
+	}
+
+	response.Json(w, &res)
 }
 
 func (a *Api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.r.ServeHTTP(w, r)
 }
+
+// Routes returns routes of the api, openapi_test.go checks them against Spec
+func (a *Api) Routes() chi.Routes {
+	return a.r
+}
+
+func newDonateResponse(p *PaymentRecord) *DonateResponse {
+	return &DonateResponse{
+		PaymentId:       p.PaymentId,
+		CampaignId:      p.CampaignId,
+		Amount:          p.Amount,
+		Status:          p.Status,
+		ConfirmationUrl: p.ConfirmationUrl,
+		CreatedAt:       p.CreatedAt,
+	}
+}
+
+func newPaymentResponse(p *PaymentRecord) *PaymentResponse {
+	return &PaymentResponse{
+		Id:           p.Id,
+		PaymentId:    p.PaymentId,
+		UserId:       p.UserId,
+		CampaignId:   p.CampaignId,
+		Amount:       p.Amount,
+		IncomeAmount: p.IncomeAmount,
+		Status:       p.Status,
+		ReturnedAt:   p.ReturnedAt,
+		RefundId:     p.RefundId,
+		PayoutId:     p.PayoutRecordId,
+		CreatedAt:    p.CreatedAt,
+		UpdatedAt:    p.UpdatedAt,
+	}
+}
+
+func newPayoutResponse(p *PayoutRecord) *PayoutResponse {
+	return &PayoutResponse{
+		Id:          p.Id,
+		PayoutId:    p.PayoutId,
+		CampaignId:  p.CampaignId,
+		GrossAmount: p.GrossAmount,
+		Fee:         p.Fee,
+		Amount:      p.Amount,
+		Destination: p.Destination,
+		Status:      p.Status,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+}
+
+func newRefundStatusResponse(p *RefundProgress) *RefundStatusResponse {
+	return &RefundStatusResponse{
+		CampaignId:       p.CampaignId,
+		Reason:           p.Reason,
+		Status:           p.Status,
+		TotalPayments:    p.TotalCount,
+		RefundedPayments: p.RefundedCount,
+		FailedPayments:   p.FailedCount,
+		Attempts:         p.Attempts,
+		LastError:        p.LastError,
+		RequestedAt:      p.RequestedAt,
+		UpdatedAt:        p.UpdatedAt,
+		CompletedAt:      p.CompletedAt,
+	}
+}
+
+func newIdempotenceKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,212 @@
+package payment_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/internal/payment"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/db/dbtest"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+const (
+	creatorId = "5d2d6f4c-0d7f-4b8e-9a7b-0f8f3f6c1a01"
+	donorId   = "5d2d6f4c-0d7f-4b8e-9a7b-0f8f3f6c1a02"
+)
+
+// donateTest is campaign and payment services talking to each other with the fake provider
+type donateTest struct {
+	ja        *jwtauth.JWTAuth
+	campaigns *pgxpool.Pool
+	payments  *pgxpool.Pool
+	fake      *payment.FakeProvider
+
+	campaignUrl string
+	paymentUrl  string
+}
+
+func newDonateTest(t *testing.T) *donateTest {
+	d := &donateTest{ja: jwtauth.New(jwa.HS256, []byte("secret"))}
+
+	d.campaigns = dbtest.New(t, campaign.Migrations)
+	campaignSrv := httptest.NewServer(campaign.NewController(d.campaigns, d.ja, "token"))
+	t.Cleanup(campaignSrv.Close)
+	d.campaignUrl = campaignSrv.URL
+
+	// Provider needs webhook url before the api using it is created
+	var api http.Handler
+	paymentSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.ServeHTTP(w, r)
+	}))
+	t.Cleanup(paymentSrv.Close)
+	d.paymentUrl = paymentSrv.URL
+
+	d.payments = dbtest.New(t, payment.Migrations)
+	d.fake = payment.NewFakeProvider(paymentSrv.URL + "/webhook")
+	// Notifications have to reach the webhook before the servers are closed
+	t.Cleanup(d.fake.Wait)
+
+	campaigns := payment.NewCampaignService(campaignSrv.URL, "token")
+	api = payment.NewController(d.payments, d.ja, d.fake, campaigns, "token")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go payment.NewOutboxRelay(d.payments, campaigns, 50*time.Millisecond).Run(ctx)
+
+	return d
+}
+
+// client returns client signed in as the account with verified email and second factor checked just now
+func (d *donateTest) client(t *testing.T, accountId string) *client.Client {
+	t.Helper()
+
+	token, err := jwt.NewBuilder().
+		Subject(accountId).
+		JwtID(accountId).
+		Claim(jwtauth.RoleClaim, jwtauth.RoleUser).
+		Claim(jwtauth.EmailVerifiedClaim, true).
+		Claim(jwtauth.MFAClaim, time.Now().Unix()).
+		Expiration(time.Now().Add(time.Hour)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := d.ja.Sign(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client.New("", d.campaignUrl, d.paymentUrl).
+		WithTokens(&client.TokenResponse{AccessToken: string(signed), TokenType: "Bearer", ExpiresIn: 3600})
+}
+
+// campaign creates active campaign collecting RUB
+func (d *donateTest) campaign(t *testing.T) *client.Campaign {
+	t.Helper()
+
+	c, err := d.client(t, creatorId).CreateCampaign(context.Background(), &client.CreateCampaignRequest{
+		Name:        "Playground",
+		Description: "New playground for the district",
+		Goal:        money.New(1000000, money.RUB),
+		Deadline:    time.Now().Add(30 * 24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// waitAmount polls campaign until its amount is want, outbox relay delivers donations asynchronously
+func (d *donateTest) waitAmount(t *testing.T, campaignId int, want money.Money) {
+	t.Helper()
+
+	c := client.New("", d.campaignUrl, "")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got, err := c.GetCampaign(context.Background(), campaignId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.CurrentAmount == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("campaign amount is %s, want %s", got.CurrentAmount, want)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (d *donateTest) paymentStatus(t *testing.T, paymentId string) string {
+	t.Helper()
+
+	var status string
+	err := d.payments.QueryRow(context.Background(), `SELECT status FROM Payment WHERE payment_id = $1`, paymentId).Scan(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestDonationIncreasesCampaignAmount(t *testing.T) {
+	d := newDonateTest(t)
+	c := d.campaign(t)
+	donor := d.client(t, donorId)
+
+	for _, minor := range []int64{10000, 25050} {
+		_, err := donor.Donate(context.Background(), c.Id, &client.DonateRequest{
+			Amount:    money.New(minor, money.RUB),
+			ReturnUrl: "http://app.test/campaigns",
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d.waitAmount(t, c.Id, money.New(35050, money.RUB))
+}
+
+func TestCanceledDonationIsNotCounted(t *testing.T) {
+	d := newDonateTest(t)
+	c := d.campaign(t)
+	donor := d.client(t, donorId)
+	req := &client.DonateRequest{Amount: money.New(10000, money.RUB), ReturnUrl: "http://app.test/campaigns"}
+
+	d.fake.Script(payment.FakeCreatePayment, payment.FakeStep{Status: payment.PaymentStatusPending})
+	canceled, err := donor.Donate(context.Background(), c.Id, req, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.fake.Cancel(canceled.PaymentId); err != nil {
+		t.Fatal(err)
+	}
+	if status := d.paymentStatus(t, canceled.PaymentId); status != payment.PaymentStatusCanceled {
+		t.Fatalf("payment is %s, want %s", status, payment.PaymentStatusCanceled)
+	}
+
+	// Campaign amount changes only after succeeded donation
+	if _, err := donor.Donate(context.Background(), c.Id, req, ""); err != nil {
+		t.Fatal(err)
+	}
+	d.waitAmount(t, c.Id, money.New(10000, money.RUB))
+}
+
+func TestDonationRetryIsIdempotent(t *testing.T) {
+	d := newDonateTest(t)
+	c := d.campaign(t)
+	donor := d.client(t, donorId)
+	req := &client.DonateRequest{Amount: money.New(10000, money.RUB), ReturnUrl: "http://app.test/campaigns"}
+
+	// Duplicate notification doesn't count the donation twice either
+	d.fake.Script(payment.FakeCreatePayment, payment.FakeStep{Status: payment.PaymentStatusSucceeded, DuplicateWebhook: true})
+	first, err := donor.Donate(context.Background(), c.Id, req, "retry-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.fake.Wait()
+
+	// Provider already notified webhook, retry returns the same payment
+	retry, err := donor.Donate(context.Background(), c.Id, req, "retry-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.PaymentId != first.PaymentId {
+		t.Fatalf("retry created payment %s, want %s", retry.PaymentId, first.PaymentId)
+	}
+
+	other := &client.DonateRequest{Amount: money.New(20000, money.RUB), ReturnUrl: req.ReturnUrl}
+	if _, err := donor.Donate(context.Background(), c.Id, other, "retry-key"); client.ErrorCode(err) != payment.CodeIdempotenceKeyReused {
+		t.Fatalf("got %v, want %s", err, payment.CodeIdempotenceKeyReused)
+	}
+
+	d.waitAmount(t, c.Id, money.New(10000, money.RUB))
+}
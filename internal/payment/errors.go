@@ -0,0 +1,45 @@
+package payment
+
+import (
+	"net/http"
+
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+// Error codes of payment api, clients branch on them so they never change
+const (
+	CodePaymentNotFound          = "payment_not_found"
+	CodePayoutNotFound           = "payout_not_found"
+	CodeRefundNotFound           = "refund_not_found"
+	CodeInvalidCampaignId        = "invalid_campaign_id"
+	CodeInvalidAmount            = "invalid_amount"
+	CodeCurrencyMismatch         = "currency_mismatch"
+	CodeInvalidIdempotenceKey    = "invalid_idempotence_key"
+	CodeIdempotenceKeyReused     = "idempotence_key_reused"
+	CodeNotAcceptingDonations    = "campaign_not_accepting_donations"
+	CodeNotCampaignOwner         = "not_campaign_owner"
+	CodePayoutNotAllowed         = "payout_not_allowed"
+	CodePayoutInProgress         = "payout_in_progress"
+	CodeNothingToPayOut          = "nothing_to_pay_out"
+	CodeCampaignRefunding        = "campaign_refunding"
+	CodeInvalidNotificationEvent = "invalid_notification"
+	CodeInvalidQuery             = "invalid_query"
+)
+
+var (
+	ErrPaymentNotFound       = response.NewProblem(http.StatusNotFound, CodePaymentNotFound, "payment not found")
+	ErrPayoutNotFound        = response.NewProblem(http.StatusNotFound, CodePayoutNotFound, "payout not found")
+	ErrRefundNotFound        = response.NewProblem(http.StatusNotFound, CodeRefundNotFound, "campaign donations are not being refunded")
+	ErrInvalidCampaignId     = response.NewProblem(http.StatusBadRequest, CodeInvalidCampaignId, "invalid campaign id")
+	ErrInvalidAmount         = response.NewProblem(http.StatusBadRequest, CodeInvalidAmount, "amount must be positive")
+	ErrCurrencyMismatch      = response.NewProblem(http.StatusBadRequest, CodeCurrencyMismatch, "campaign doesn't accept donations in this currency")
+	ErrInvalidIdempotenceKey = response.NewProblem(http.StatusBadRequest, CodeInvalidIdempotenceKey, "idempotence key is too long")
+	ErrIdempotenceKeyReused  = response.NewProblem(http.StatusConflict, CodeIdempotenceKeyReused, "idempotence key is already used")
+	ErrNotAcceptingDonations = response.NewProblem(http.StatusConflict, CodeNotAcceptingDonations, "campaign is not accepting donations")
+	ErrNotCampaignOwner      = response.NewProblem(http.StatusForbidden, CodeNotCampaignOwner, "only campaign creator can manage payouts")
+	ErrPayoutNotAllowed      = response.NewProblem(http.StatusConflict, CodePayoutNotAllowed, "campaign is paid out only after its deadline if it reached its goal or keeps what it collected")
+	ErrPayoutInProgress      = response.NewProblem(http.StatusConflict, CodePayoutInProgress, "campaign payout is already in progress")
+	ErrCampaignRefunding     = response.NewProblem(http.StatusConflict, CodeCampaignRefunding, "campaign donations are refunded, they can't be paid out")
+	ErrInvalidNotification   = response.NewProblem(http.StatusBadRequest, CodeInvalidNotificationEvent, "object id is missing")
+	ErrInvalidQuery          = response.NewProblem(http.StatusBadRequest, CodeInvalidQuery, "invalid query")
+)
@@ -0,0 +1,424 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+var (
+	ErrFakeFailure  = errors.New("fake provider: scripted failure")
+	ErrFakeNotFound = errors.New("fake provider: not found")
+)
+
+const fakeNotifyAttempts = 6
+
+type FakeOperation string
+
+const (
+	FakeCreatePayment FakeOperation = "create_payment"
+	FakeCreateRefund  FakeOperation = "create_refund"
+	FakeCreatePayout  FakeOperation = "create_payout"
+)
+
+// FakeStep scripts how FakeProvider handles one call of the operation
+type FakeStep struct {
+	// Fail makes the call return ErrFakeFailure
+	Fail bool
+	// Status is the status object moves to after Delay, pending keeps it until Succeed or Cancel is called
+	Status string
+	Delay  time.Duration
+	// DuplicateWebhook sends payment or payout notification twice, like yookassa sometimes does
+	DuplicateWebhook bool
+}
+
+// FakeProvider is an in-process PaymentProvider for local development and CI. Ids are sequential,
+// calls are handled by scripted steps in order and by default step once the script is over
+type FakeProvider struct {
+	webhookUrl string
+	c          *http.Client
+
+	mu          sync.Mutex
+	seq         int
+	script      map[FakeOperation][]FakeStep
+	defaultStep FakeStep
+	payments    map[string]*Payment
+	refunds     map[string]*Refund
+	payouts     map[string]*Payout
+	// byKey maps idempotence key to the id of created object
+	byKey map[string]string
+
+	wg sync.WaitGroup
+}
+
+// NewFakeProvider creates provider that succeeds every call, notifications are sent to webhookUrl if it's not empty
+func NewFakeProvider(webhookUrl string) *FakeProvider {
+	return &FakeProvider{
+		webhookUrl:  webhookUrl,
+		c:           &http.Client{Timeout: 10 * time.Second},
+		script:      make(map[FakeOperation][]FakeStep),
+		defaultStep: FakeStep{Status: PaymentStatusSucceeded},
+		payments:    make(map[string]*Payment),
+		refunds:     make(map[string]*Refund),
+		payouts:     make(map[string]*Payout),
+		byKey:       make(map[string]string),
+	}
+}
+
+// SetDefault changes the step used when the script is over
+func (f *FakeProvider) SetDefault(step FakeStep) {
+	f.mu.Lock()
+	f.defaultStep = step
+	f.mu.Unlock()
+}
+
+// Script appends steps for the next calls of op
+func (f *FakeProvider) Script(op FakeOperation, steps ...FakeStep) {
+	f.mu.Lock()
+	f.script[op] = append(f.script[op], steps...)
+	f.mu.Unlock()
+}
+
+// Wait blocks until every scheduled status change and notification is done
+func (f *FakeProvider) Wait() {
+	f.wg.Wait()
+}
+
+// Succeed moves pending payment to succeeded and notifies webhook
+func (f *FakeProvider) Succeed(id string) error {
+	return f.transition(id, PaymentStatusSucceeded, false)
+}
+
+// Cancel moves pending payment to canceled and notifies webhook
+func (f *FakeProvider) Cancel(id string) error {
+	return f.transition(id, PaymentStatusCanceled, false)
+}
+
+func (f *FakeProvider) CreatePayment(idempotenceKey string, req *CreatePaymentRequest) (*Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if id, ok := f.byKey[idempotenceKey]; ok {
+		p := *f.payments[id]
+		return &p, nil
+	}
+
+	step := f.nextStep(FakeCreatePayment)
+	if step.Fail {
+		return nil, ErrFakeFailure
+	}
+
+	id := f.newId("payment")
+	p := &Payment{
+		ID:          id,
+		Status:      PaymentStatusPending,
+		Amount:      req.Amount,
+		CreatedAt:   time.Now(),
+		Description: req.Description,
+		Metadata:    req.Metadata,
+		Test:        true,
+	}
+	if req.Confirmation != nil {
+		// There is nothing to confirm, so user is redirected right back
+		p.Confirmation = &Confirmation{
+			Type:            req.Confirmation.Type,
+			ReturnUrl:       req.Confirmation.ReturnUrl,
+			ConfirmationUrl: req.Confirmation.ReturnUrl,
+		}
+	}
+	f.payments[id] = p
+	f.byKey[idempotenceKey] = id
+
+	status := step.Status
+	if status == PaymentStatusSucceeded && !req.Capture {
+		status = PaymentStatusWaitingForCapture
+	}
+	if status != "" && status != PaymentStatusPending {
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			time.Sleep(step.Delay)
+			if err := f.transition(id, status, step.DuplicateWebhook); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+
+	res := *p
+	return &res, nil
+}
+
+func (f *FakeProvider) GetPayment(id string) (*Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: payment %s", ErrFakeNotFound, id)
+	}
+	res := *p
+	return &res, nil
+}
+
+func (f *FakeProvider) CapturePayment(idempotenceKey string, id string, amount *money.Money) (*Payment, error) {
+	f.mu.Lock()
+	if p, ok := f.replay(idempotenceKey); ok {
+		f.mu.Unlock()
+		return p, nil
+	}
+	p, ok := f.payments[id]
+	if ok && p.Status == PaymentStatusWaitingForCapture && amount != nil {
+		p.Amount = *amount
+	}
+	f.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: payment %s", ErrFakeNotFound, id)
+	}
+	return f.change(idempotenceKey, id, PaymentStatusSucceeded)
+}
+
+func (f *FakeProvider) CancelPayment(idempotenceKey string, id string) (*Payment, error) {
+	f.mu.Lock()
+	p, ok := f.replay(idempotenceKey)
+	f.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	return f.change(idempotenceKey, id, PaymentStatusCanceled)
+}
+
+// replay returns payment changed by the call with the same idempotence key, should be called with mu held
+func (f *FakeProvider) replay(idempotenceKey string) (*Payment, bool) {
+	p, ok := f.payments[f.byKey[idempotenceKey]]
+	if !ok {
+		return nil, false
+	}
+	res := *p
+	return &res, true
+}
+
+// change moves payment to the status and remembers the key, so repeated call returns the payment
+// instead of failing on its final status like yookassa does
+func (f *FakeProvider) change(idempotenceKey string, id string, status string) (*Payment, error) {
+	if err := f.transition(id, status, false); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.byKey[idempotenceKey] = id
+	f.mu.Unlock()
+	return f.GetPayment(id)
+}
+
+func (f *FakeProvider) CreateRefund(idempotenceKey string, req *CreateRefundRequest) (*Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if id, ok := f.byKey[idempotenceKey]; ok {
+		r := *f.refunds[id]
+		return &r, nil
+	}
+
+	step := f.nextStep(FakeCreateRefund)
+	if step.Fail {
+		return nil, ErrFakeFailure
+	}
+
+	p, ok := f.payments[req.PaymentId]
+	if !ok || p.Status != PaymentStatusSucceeded {
+		return nil, fmt.Errorf("fake provider: payment %s can't be refunded", req.PaymentId)
+	}
+
+	r := &Refund{
+		ID:          f.newId("refund"),
+		PaymentId:   req.PaymentId,
+		Status:      RefundStatusPending,
+		Amount:      req.Amount,
+		CreatedAt:   time.Now(),
+		Description: req.Description,
+	}
+	f.refunds[r.ID] = r
+	f.byKey[idempotenceKey] = r.ID
+	// Refund notifications are not sent, webhook only handles payments and payouts
+	f.schedule(step, func(status string) *Notification {
+		r.Status = status
+		return nil
+	})
+
+	res := *r
+	return &res, nil
+}
+
+func (f *FakeProvider) CreatePayout(idempotenceKey string, req *CreatePayoutRequest) (*Payout, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if id, ok := f.byKey[idempotenceKey]; ok {
+		p := *f.payouts[id]
+		return &p, nil
+	}
+
+	step := f.nextStep(FakeCreatePayout)
+	if step.Fail {
+		return nil, ErrFakeFailure
+	}
+
+	p := &Payout{
+		ID:                f.newId("payout"),
+		Amount:            req.Amount,
+		Status:            PayoutStatusPending,
+		PayoutDestination: req.PayoutDestinationData,
+		Description:       req.Description,
+		CreatedAt:         time.Now(),
+		Metadata:          req.Metadata,
+		Test:              true,
+	}
+	f.payouts[p.ID] = p
+	f.byKey[idempotenceKey] = p.ID
+	f.schedule(step, func(status string) *Notification {
+		p.Status = status
+		return &Notification{Type: "notification", Event: "payout." + status, Object: Payment{ID: p.ID, Status: status}}
+	})
+
+	res := *p
+	return &res, nil
+}
+
+func (f *FakeProvider) GetPayout(id string) (*Payout, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payouts[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: payout %s", ErrFakeNotFound, id)
+	}
+	res := *p
+	return &res, nil
+}
+
+// nextStep pops scripted step of op, should be called with mu held
+func (f *FakeProvider) nextStep(op FakeOperation) FakeStep {
+	steps := f.script[op]
+	if len(steps) == 0 {
+		return f.defaultStep
+	}
+	f.script[op] = steps[1:]
+	return steps[0]
+}
+
+// newId returns deterministic id of the object, should be called with mu held
+func (f *FakeProvider) newId(kind string) string {
+	f.seq++
+	return fmt.Sprintf("fake-%s-%06d", kind, f.seq)
+}
+
+// schedule applies step status with set after the step delay and sends notification set returns,
+// should be called with mu held
+func (f *FakeProvider) schedule(step FakeStep, set func(status string) *Notification) {
+	if step.Status == "" || step.Status == PaymentStatusPending {
+		return
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		time.Sleep(step.Delay)
+		f.mu.Lock()
+		n := set(step.Status)
+		f.mu.Unlock()
+
+		if n == nil {
+			return
+		}
+		times := 1
+		if step.DuplicateWebhook {
+			times = 2
+		}
+		for i := 0; i < times; i++ {
+			if err := f.notify(n); err != nil {
+				log.Println(err)
+				return
+			}
+		}
+	}()
+}
+
+// transition changes payment status and sends notification about it
+func (f *FakeProvider) transition(id string, status string, duplicate bool) error {
+	f.mu.Lock()
+	p, ok := f.payments[id]
+	if !ok {
+		f.mu.Unlock()
+		return fmt.Errorf("%w: payment %s", ErrFakeNotFound, id)
+	}
+
+	switch {
+	case p.Status == status:
+		f.mu.Unlock()
+		return nil
+	case p.Status == PaymentStatusSucceeded || p.Status == PaymentStatusCanceled:
+		f.mu.Unlock()
+		return fmt.Errorf("fake provider: payment %s is already %s", id, p.Status)
+	}
+
+	p.Status = status
+	p.Paid = status == PaymentStatusSucceeded || status == PaymentStatusWaitingForCapture
+	n := Notification{Type: "notification", Event: "payment." + status, Object: *p}
+	f.mu.Unlock()
+
+	times := 1
+	if duplicate {
+		times = 2
+	}
+	for i := 0; i < times; i++ {
+		if err := f.notify(&n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notify sends notification to webhook, retrying it until it gets 200 like yookassa does,
+// but for a few seconds instead of a day
+func (f *FakeProvider) notify(n *Notification) error {
+	if f.webhookUrl == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err = f.postNotification(b)
+		if err == nil || attempt == fakeNotifyAttempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (f *FakeProvider) postNotification(b []byte) error {
+	res, err := f.c.Post(f.webhookUrl, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("fake provider: webhook responded with %s", res.Status)
+	}
+	return nil
+}
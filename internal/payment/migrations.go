@@ -0,0 +1,15 @@
+package payment
+
+import (
+	"embed"
+
+	"github.com/robloxxa/DistrictFunding/pkg/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrations returns payment database migrations, see pkg/migrate
+func Migrations() ([]migrate.Migration, error) {
+	return migrate.Load(migrations, "migrations")
+}
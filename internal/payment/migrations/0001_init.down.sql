@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS RefundJob;
+DROP TABLE IF EXISTS Outbox;
+DROP TABLE IF EXISTS Payout;
+DROP TABLE IF EXISTS Payment;
+DROP TYPE IF EXISTS money_amount;
@@ -0,0 +1,97 @@
+-- Amount of money in minor units (kopecks, cents) with ISO 4217 currency, see pkg/money
+DO $$ BEGIN
+    CREATE TYPE money_amount AS (minor BIGINT, currency VARCHAR(3));
+EXCEPTION
+    WHEN duplicate_object THEN null;
+END $$;
+
+CREATE TABLE IF NOT EXISTS Payment (
+    id SERIAL PRIMARY KEY,
+    payment_id VARCHAR(36) UNIQUE NOT NULL,
+    -- Key sent to yookassa in Idempotence-Key header, retried donations with the same key return the same payment
+    idempotence_key VARCHAR(64) UNIQUE NOT NULL,
+    user_id UUID NOT NULL,
+    campaign_id int NOT NULL,
+    amount money_amount NOT NULL,
+    -- Yookassa payment status: pending, waiting_for_capture, succeeded or canceled
+    status VARCHAR(32) NOT NULL DEFAULT 'pending',
+    confirmation_url TEXT NOT NULL DEFAULT '',
+    returned_at timestamptz,
+    -- Provider refund created when the donation was returned
+    refund_id VARCHAR(36),
+    -- Amount left after provider fee, known once payment succeeds
+    income_amount money_amount,
+    -- Payout (Payout.id) the donation was paid out in, paid out donations are never paid out or refunded again
+    payout_record_id INT,
+    -- Set when refund job takes the donation, claimed donation is never paid out even if its refund is not finished,
+    -- since provider may have already returned the money
+    refund_started_at TIMESTAMPTZ,
+    created_at timestamptz DEFAULT current_timestamp,
+    updated_at timestamptz DEFAULT current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS payment_campaign_id_idx ON Payment (campaign_id);
+
+CREATE TABLE IF NOT EXISTS Payout (
+    id SERIAL PRIMARY KEY,
+    -- Provider payout id, NULL until provider accepts the payout
+    payout_id VARCHAR(36) UNIQUE,
+    idempotence_key VARCHAR(64) UNIQUE NOT NULL,
+    user_id UUID NOT NULL,
+    campaign_id INT NOT NULL,
+    -- Sum of donations included in the payout, fee is provider and platform fees, amount is what creator gets
+    gross_amount money_amount NOT NULL,
+    fee money_amount NOT NULL,
+    amount money_amount NOT NULL,
+    destination JSONB NOT NULL,
+    -- pending, succeeded or canceled, canceled payout releases its donations
+    status VARCHAR(32) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ default current_timestamp,
+    updated_at TIMESTAMPTZ default current_timestamp
+);
+
+-- Campaign has at most one payout in progress
+CREATE UNIQUE INDEX IF NOT EXISTS payout_campaign_pending_idx ON Payout (campaign_id) WHERE status = 'pending';
+
+-- Transactional outbox, see pkg/outbox
+CREATE TABLE IF NOT EXISTS Outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    -- Events of one aggregate (campaign) are delivered in order, the next one waits until the previous is delivered
+    aggregate_id VARCHAR(64) NOT NULL DEFAULT '',
+    -- Relay lease, events are claimed and delivered outside of transaction, expired lease means the relay died
+    locked_until TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_undelivered_idx ON Outbox (next_attempt_at) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_aggregate_idx ON Outbox (aggregate_id, id) WHERE delivered_at IS NULL;
+
+-- Refunding every donation of archived or failed campaign. Job is resumable, refunded payments
+-- have returned_at set and are skipped, provider refunds are created with idempotence key of the payment
+CREATE TABLE IF NOT EXISTS RefundJob (
+    id SERIAL PRIMARY KEY,
+    campaign_id INT UNIQUE NOT NULL,
+    -- archived or goal_not_reached
+    reason VARCHAR(32) NOT NULL,
+    -- pending, completed or failed after too many attempts
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    -- Payments that failed to refund during the last attempt
+    failed_count INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    -- Worker lease, expired lease means the worker died and job can be taken by another one
+    locked_until TIMESTAMPTZ,
+    requested_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    updated_at TIMESTAMPTZ DEFAULT current_timestamp,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS refund_job_pending_idx ON RefundJob (next_attempt_at) WHERE status = 'pending';
@@ -1 +1,96 @@
 package payment
+
+import (
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+type (
+	DonateRequest struct {
+		Amount money.Money `json:"amount"`
+		// ReturnUrl is where user is redirected after confirming the payment
+		ReturnUrl string `json:"return_url" validate:"required,url"`
+	}
+
+	DonateResponse struct {
+		PaymentId       string      `json:"payment_id"`
+		CampaignId      int         `json:"campaign_id"`
+		Amount          money.Money `json:"amount"`
+		Status          string      `json:"status"`
+		ConfirmationUrl string      `json:"confirmation_url"`
+		CreatedAt       time.Time   `json:"created_at"`
+	}
+)
+
+// RefundStatusResponse is refund progress of the campaign donations
+type RefundStatusResponse struct {
+	CampaignId       int        `json:"campaign_id"`
+	Reason           string     `json:"reason"`
+	Status           string     `json:"status"`
+	TotalPayments    int        `json:"total_payments"`
+	RefundedPayments int        `json:"refunded_payments"`
+	FailedPayments   int        `json:"failed_payments"`
+	Attempts         int        `json:"attempts"`
+	LastError        *string    `json:"last_error,omitempty"`
+	RequestedAt      time.Time  `json:"requested_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
+
+type (
+	PayoutRequest struct {
+		Destination PayoutDestination `json:"destination" validate:"required"`
+	}
+
+	// PayoutResponse is a payout of campaign donations, Fee includes provider and platform fees
+	PayoutResponse struct {
+		Id          int                `json:"id"`
+		PayoutId    *string            `json:"payout_id,omitempty"`
+		CampaignId  int                `json:"campaign_id"`
+		GrossAmount money.Money        `json:"gross_amount"`
+		Fee         money.Money        `json:"fee"`
+		Amount      money.Money        `json:"amount"`
+		Destination *PayoutDestination `json:"destination"`
+		Status      string             `json:"status"`
+		CreatedAt   time.Time          `json:"created_at"`
+		UpdatedAt   time.Time          `json:"updated_at"`
+	}
+
+	ListPayoutsResponse struct {
+		Payouts []PayoutResponse `json:"payouts"`
+	}
+)
+
+type (
+	// PaymentResponse is a payment as seen by staff
+	PaymentResponse struct {
+		Id           int          `json:"id"`
+		PaymentId    string       `json:"payment_id"`
+		UserId       string       `json:"user_id"`
+		CampaignId   int          `json:"campaign_id"`
+		Amount       money.Money  `json:"amount"`
+		IncomeAmount *money.Money `json:"income_amount,omitempty"`
+		Status       string       `json:"status"`
+		ReturnedAt   *time.Time   `json:"returned_at,omitempty"`
+		RefundId     *string      `json:"refund_id,omitempty"`
+		PayoutId     *int         `json:"payout_id,omitempty"`
+		CreatedAt    time.Time    `json:"created_at"`
+		UpdatedAt    time.Time    `json:"updated_at"`
+	}
+
+	ListPaymentsResponse struct {
+		Payments []PaymentResponse `json:"payments"`
+		// NextCursor is empty when there are no more payments
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+)
+
+// AccountExportResponse is everything payment service holds about the account, auth service puts it
+// into personal data export
+type AccountExportResponse struct {
+	// Payments are donations made by the account
+	Payments []PaymentResponse `json:"payments"`
+	// Payouts are payouts of campaigns created by the account
+	Payouts []PayoutResponse `json:"payouts"`
+}
@@ -0,0 +1,95 @@
+package payment
+
+import (
+	"net/http"
+
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/audit"
+	"github.com/robloxxa/DistrictFunding/pkg/openapi"
+)
+
+// Spec is OpenAPI document of payment api, it has to be changed together with routes of NewController
+func Spec() *openapi.Document {
+	d := openapi.New("Payment service", "0.1.0").
+		Enum(campaign.StatusDraft, campaign.StatusActive, campaign.StatusFunded, campaign.StatusExpired, campaign.StatusClosed).
+		Enum(campaign.OutcomeFunded, campaign.OutcomeUnfunded)
+
+	campaignId := openapi.PathParam("campaignId", openapi.Integer(), "")
+	maxKeyLength := 64
+
+	d.Add(http.MethodPost, "/webhook", openapi.Route{
+		Summary:     "Payment provider notification",
+		Description: "Notification body isn't trusted, payment and payout statuses are fetched from the provider",
+		Request:     Notification{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusBadGateway},
+	})
+	d.Add(http.MethodPost, "/internal/campaign-events", openapi.Route{
+		Summary:     "Apply campaign status event of campaign service",
+		Description: "Queues refund of archived campaigns and all or nothing campaigns that missed their goal, other events are acknowledged with a message",
+		Security:    openapi.SecurityInternal,
+		Request:     campaign.CampaignStatusEvent{},
+		Response:    RefundStatusResponse{},
+		Errors:      []int{http.StatusBadRequest},
+	})
+	d.Add(http.MethodGet, "/internal/accounts/{accountId}/export", openapi.Route{
+		Summary:  "Donations and payouts of the account for its personal data export",
+		Security: openapi.SecurityInternal,
+		Params:   []openapi.Parameter{openapi.PathParam("accountId", &openapi.Schema{Type: "string", Format: "uuid"}, "")},
+		Response: AccountExportResponse{},
+		Errors:   []int{http.StatusBadRequest},
+	})
+	d.Add(http.MethodGet, "/campaign/{campaignId}/refunds", openapi.Route{
+		Summary:  "Refund progress of campaign donations",
+		Params:   []openapi.Parameter{campaignId},
+		Response: RefundStatusResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	d.Add(http.MethodPost, "/campaign/{campaignId}/donate", openapi.Route{
+		Summary:     "Donate to campaign",
+		Description: "Repeated request with the same Idempotence-Key returns the payment created before with status 200. Account email has to be verified",
+		Security:    openapi.SecurityBearer,
+		Params: []openapi.Parameter{
+			campaignId,
+			openapi.HeaderParam("Idempotence-Key", &openapi.Schema{Type: "string", MaxLength: &maxKeyLength}, "up to 64 characters, generated if it's missing"),
+		},
+		Request:  DonateRequest{},
+		Status:   http.StatusCreated,
+		Response: DonateResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway},
+	})
+	d.Add(http.MethodPost, "/campaign/{campaignId}/payout", openapi.Route{
+		Summary:     "Pay out donations of funded campaign to its creator",
+		Description: "Campaign is paid out after it was closed at its deadline. Access token has to come from two-factor step-up of the last 10 minutes",
+		Security:    openapi.SecurityBearer,
+		Params:      []openapi.Parameter{campaignId},
+		Request:     PayoutRequest{},
+		Status:      http.StatusCreated,
+		Response:    PayoutResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway},
+	})
+	d.Add(http.MethodGet, "/campaign/{campaignId}/payouts", openapi.Route{
+		Summary:  "List campaign payouts",
+		Security: openapi.SecurityBearer,
+		Params:   []openapi.Parameter{campaignId},
+		Response: ListPayoutsResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusBadGateway},
+	})
+	d.Add(http.MethodGet, "/admin/audit", audit.Route())
+	d.Add(http.MethodGet, "/admin/payments", openapi.Route{
+		Summary:  "List payments of every user, newest first",
+		Security: openapi.SecurityBearer,
+		Params: []openapi.Parameter{
+			openapi.QueryParam("campaign_id", openapi.Integer(), ""),
+			openapi.QueryParam("user_id", &openapi.Schema{Type: "string", Format: "uuid"}, ""),
+			openapi.QueryParam("status", &openapi.Schema{Type: "string", Enum: []any{
+				PaymentStatusPending, PaymentStatusWaitingForCapture, PaymentStatusSucceeded, PaymentStatusCanceled,
+			}}, ""),
+			openapi.QueryParam("limit", openapi.Integer(), "page size, 50 by default and 200 at most"),
+			openapi.QueryParam("cursor", openapi.String(), "next_cursor of the previous page"),
+		},
+		Response: ListPaymentsResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+	})
+
+	return d
+}
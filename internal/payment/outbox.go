@@ -0,0 +1,27 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/outbox"
+)
+
+// NewOutboxRelay creates relay delivering payment events to campaign service
+func NewOutboxRelay(db *pgxpool.Pool, campaigns CampaignService, interval time.Duration) *outbox.Relay {
+	return outbox.NewRelay(db, func(e *outbox.Event) error {
+		switch e.EventType {
+		case campaign.DonationEventSucceeded, campaign.DonationEventRefunded:
+			var req campaign.DonationEventRequest
+			if err := json.Unmarshal(e.Payload, &req); err != nil {
+				return err
+			}
+			return campaigns.ApplyDonationEvent(&req)
+		default:
+			return fmt.Errorf("unknown outbox event type: %s", e.EventType)
+		}
+	}, interval)
+}
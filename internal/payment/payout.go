@@ -0,0 +1,245 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+var (
+	ErrNothingToPayOut = response.NewProblem(http.StatusConflict, CodeNothingToPayOut, "there are no donations to pay out")
+)
+
+// PayoutRecord is a payout of campaign donations to its creator, PayoutId is the id of provider payout
+type PayoutRecord struct {
+	Id             int                `db:"id"`
+	PayoutId       *string            `db:"payout_id"`
+	IdempotenceKey string             `db:"idempotence_key"`
+	UserId         string             `db:"user_id"`
+	CampaignId     int                `db:"campaign_id"`
+	GrossAmount    money.Money        `db:"gross_amount"`
+	Fee            money.Money        `db:"fee"`
+	Amount         money.Money        `db:"amount"`
+	Destination    *PayoutDestination `db:"destination"`
+	Status         string             `db:"status"`
+	CreatedAt      time.Time          `db:"created_at"`
+	UpdatedAt      time.Time          `db:"updated_at"`
+}
+
+type PayoutModel interface {
+	// Reserve creates pending payout of every succeeded donation that wasn't refunded, claimed by refund job
+	// or paid out before.
+	// Fee is provider fee of the donations plus feeBps basis points of what's left.
+	// Returns ErrNothingToPayOut if there is nothing left to pay and ErrCampaignRefunding if the campaign has refund job
+	Reserve(ctx context.Context, p *PayoutRecord, feeBps int64) (*PayoutRecord, error)
+	// GetPending returns payout of the campaign that wasn't accepted or rejected by provider yet
+	GetPending(ctx context.Context, campaignId int) (*PayoutRecord, error)
+	GetByPayoutId(ctx context.Context, payoutId string) (*PayoutRecord, error)
+	ListByCampaignId(ctx context.Context, campaignId int) ([]PayoutRecord, error)
+	ListByUserId(ctx context.Context, userId string) ([]PayoutRecord, error)
+	// ListStale returns payouts accepted by provider that are still pending after being updated before the time
+	ListStale(ctx context.Context, updatedBefore time.Time, limit int) ([]PayoutRecord, error)
+	// UpdateStatus sets provider payout id and status of pending payout, canceled payout releases its donations
+	UpdateStatus(ctx context.Context, id int, payoutId string, status string) (*PayoutRecord, error)
+}
+
+type payoutModel struct {
+	db *pgxpool.Pool
+}
+
+func (pm *payoutModel) Reserve(ctx context.Context, p *PayoutRecord, feeBps int64) (*PayoutRecord, error) {
+	var payout *PayoutRecord
+	err := db.WithTx(ctx, pm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, pm.db)
+
+		// Campaign status was checked before the transaction, refund job created since then wins.
+		// Refund job is never removed, so campaign that has one is never paid out
+		if err := lockCampaign(ctx, tx, p.CampaignId); err != nil {
+			return err
+		}
+		var refunding bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM RefundJob WHERE campaign_id = $1)`, p.CampaignId).Scan(&refunding)
+		if err != nil {
+			return err
+		}
+		if refunding {
+			return ErrCampaignRefunding
+		}
+
+		// Locked donations can't be reserved by concurrent payout, it sees them paid out once this one commits
+		payments, err := db.QueryAll[PaymentRecord](ctx, tx, `SELECT * FROM Payment WHERE campaign_id = $1 AND status = 'succeeded'
+		AND returned_at IS NULL AND refund_started_at IS NULL AND payout_record_id IS NULL ORDER BY id FOR UPDATE`, p.CampaignId)
+		if err != nil {
+			return err
+		}
+
+		var gross, income money.Money
+		for _, payment := range payments {
+			if gross, err = gross.Add(payment.Amount); err != nil {
+				return err
+			}
+
+			paymentIncome := payment.Amount
+			if payment.IncomeAmount != nil {
+				paymentIncome = *payment.IncomeAmount
+			}
+			if income, err = income.Add(paymentIncome); err != nil {
+				return err
+			}
+		}
+
+		platformFee, err := income.MulFrac(feeBps, 10000)
+		if err != nil {
+			return err
+		}
+
+		amount, err := income.Sub(platformFee)
+		if err != nil {
+			return err
+		}
+
+		if !amount.IsPositive() {
+			return ErrNothingToPayOut
+		}
+
+		fee, err := gross.Sub(amount)
+		if err != nil {
+			return err
+		}
+
+		payout, err = db.QueryOne[PayoutRecord](ctx, tx, `INSERT INTO Payout (idempotence_key, user_id, campaign_id, gross_amount, fee, amount, destination)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *`, p.IdempotenceKey, p.UserId, p.CampaignId, gross, fee, amount, p.Destination)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int, 0, len(payments))
+		for _, payment := range payments {
+			ids = append(ids, payment.Id)
+		}
+		return db.Exec(ctx, tx, `UPDATE Payment SET payout_record_id = $1, updated_at = current_timestamp WHERE id = ANY($2)`, payout.Id, ids)
+	})
+	return payout, err
+}
+
+func (pm *payoutModel) GetPending(ctx context.Context, campaignId int) (*PayoutRecord, error) {
+	query := `SELECT * FROM Payout WHERE campaign_id = $1 AND status = 'pending'`
+
+	return db.QueryOne[PayoutRecord](ctx, db.Conn(ctx, pm.db), query, campaignId)
+}
+
+func (pm *payoutModel) GetByPayoutId(ctx context.Context, payoutId string) (*PayoutRecord, error) {
+	query := `SELECT * FROM Payout WHERE payout_id = $1`
+
+	return db.QueryOne[PayoutRecord](ctx, db.Conn(ctx, pm.db), query, payoutId)
+}
+
+func (pm *payoutModel) ListByCampaignId(ctx context.Context, campaignId int) ([]PayoutRecord, error) {
+	query := `SELECT * FROM Payout WHERE campaign_id = $1 ORDER BY id DESC`
+
+	return db.QueryAll[PayoutRecord](ctx, db.Conn(ctx, pm.db), query, campaignId)
+}
+
+func (pm *payoutModel) ListByUserId(ctx context.Context, userId string) ([]PayoutRecord, error) {
+	query := `SELECT * FROM Payout WHERE user_id = $1 ORDER BY id DESC`
+
+	return db.QueryAll[PayoutRecord](ctx, db.Conn(ctx, pm.db), query, userId)
+}
+
+func (pm *payoutModel) ListStale(ctx context.Context, updatedBefore time.Time, limit int) ([]PayoutRecord, error) {
+	query :=
+		`SELECT * FROM Payout WHERE status = 'pending' AND payout_id IS NOT NULL AND updated_at < $1
+		ORDER BY updated_at LIMIT $2`
+
+	return db.QueryAll[PayoutRecord](ctx, db.Conn(ctx, pm.db), query, updatedBefore, limit)
+}
+
+func (pm *payoutModel) UpdateStatus(ctx context.Context, id int, payoutId string, status string) (*PayoutRecord, error) {
+	var payout *PayoutRecord
+	err := db.WithTx(ctx, pm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, pm.db)
+
+		var err error
+		payout, err = db.QueryOne[PayoutRecord](ctx, tx, `UPDATE Payout SET payout_id = $2, status = $3, updated_at = current_timestamp
+		WHERE id = $1 AND status = 'pending' RETURNING *`, id, payoutId, status)
+		if err != nil {
+			return err
+		}
+
+		// Money of canceled payout stays on the platform, so donations can be paid out again
+		if payout.Status != PayoutStatusCanceled {
+			return nil
+		}
+		return db.Exec(ctx, tx, `UPDATE Payment SET payout_record_id = NULL, updated_at = current_timestamp
+		WHERE payout_record_id = $1`, payout.Id)
+	})
+	return payout, err
+}
+
+const (
+	// payoutStaleAfter is how long pending payout waits for its webhook before its status is fetched from provider
+	payoutStaleAfter = 10 * time.Minute
+	payoutSyncBatch  = 50
+)
+
+// PayoutSyncer fetches status of payouts whose webhook is late or lost, pending payout blocks
+// the next payout of its campaign until it's finished
+type PayoutSyncer struct {
+	provider PaymentProvider
+	payout   PayoutModel
+	interval time.Duration
+}
+
+func NewPayoutSyncer(db *pgxpool.Pool, provider PaymentProvider, interval time.Duration) *PayoutSyncer {
+	return &PayoutSyncer{provider, &payoutModel{db}, interval}
+}
+
+func (ps *PayoutSyncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(ps.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ps.sync(ctx); err != nil {
+			log.Println(fmt.Errorf("unable to sync payouts: %w", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ps *PayoutSyncer) sync(ctx context.Context) error {
+	payouts, err := ps.payout.ListStale(ctx, time.Now().Add(-payoutStaleAfter), payoutSyncBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range payouts {
+		payout, err := ps.provider.GetPayout(*record.PayoutId)
+		if err != nil {
+			log.Printf("Unable to fetch payout %s: %v\n", *record.PayoutId, err)
+			continue
+		}
+		if payout.Status == PayoutStatusPending {
+			continue
+		}
+
+		if _, err := ps.payout.UpdateStatus(ctx, record.Id, payout.ID, payout.Status); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		log.Printf("Synced payout %s of campaign %d, status %s\n", payout.ID, record.CampaignId, payout.Status)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package payment_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/internal/payment"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+var payoutRequest = &client.PayoutRequest{Destination: client.PayoutDestination{Type: "yoo_money", AccountNumber: "4100116075156746"}}
+
+// closeCampaign moves deadline of the campaign to the past and closes it the way deadline scheduler does
+func (d *donateTest) closeCampaign(t *testing.T, campaignId int) {
+	t.Helper()
+
+	ctx := context.Background()
+	if _, err := d.campaigns.Exec(ctx, `UPDATE Campaign SET deadline = current_timestamp - interval '1 minute' WHERE id = $1`, campaignId); err != nil {
+		t.Fatal(err)
+	}
+	closed, err := campaign.NewCampaignModel(d.campaigns).CloseOverdue(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 1 || closed[0].Id != campaignId {
+		t.Fatalf("closed %d campaigns, want campaign %d", len(closed), campaignId)
+	}
+}
+
+func TestFundedCampaignIsNotPaidOutBeforeDeadline(t *testing.T) {
+	d := newDonateTest(t)
+	ctx := context.Background()
+	c := d.campaign(t)
+	creator := d.client(t, creatorId)
+	donation := d.donate(t, c.Id, c.Goal)
+
+	if _, err := creator.PayoutCampaign(ctx, c.Id, payoutRequest); client.ErrorCode(err) != payment.CodePayoutNotAllowed {
+		t.Fatalf("got %v, want %s", err, payment.CodePayoutNotAllowed)
+	}
+
+	// Creator can still archive funded campaign, then its donations are refunded
+	if err := creator.ArchiveCampaign(ctx, c.Id); err != nil {
+		t.Fatal(err)
+	}
+	d.runRefunder(t, c.Id)
+	d.waitRefund(t, c.Id, func(job *payment.RefundProgress) bool { return job.Status == payment.RefundJobCompleted })
+	if !d.returned(t, donation.PaymentId) {
+		t.Fatal("donation of archived campaign isn't returned")
+	}
+	d.waitAmount(t, c.Id, money.New(0, money.RUB))
+
+	if _, err := creator.PayoutCampaign(ctx, c.Id, payoutRequest); client.ErrorCode(err) != payment.CodePayoutNotAllowed {
+		t.Fatalf("archived campaign: got %v, want %s", err, payment.CodePayoutNotAllowed)
+	}
+	payouts, err := creator.ListCampaignPayouts(ctx, c.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payouts.Payouts) != 0 {
+		t.Fatalf("campaign has %d payouts, want none", len(payouts.Payouts))
+	}
+}
+
+func TestConcurrentPayoutsReserveDonationsOnce(t *testing.T) {
+	d := newDonateTest(t)
+	ctx := context.Background()
+	c := d.campaign(t)
+	creator := d.client(t, creatorId)
+	d.donate(t, c.Id, c.Goal)
+	d.closeCampaign(t, c.Id)
+
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = creator.PayoutCampaign(ctx, c.Id, payoutRequest)
+		}()
+	}
+	wg.Wait()
+
+	var succeeded int
+	for _, err := range errs {
+		switch code := client.ErrorCode(err); {
+		case err == nil:
+			succeeded++
+		case code != payment.CodeNothingToPayOut && code != payment.CodePayoutInProgress:
+			t.Fatalf("got %v, want %s or %s", err, payment.CodeNothingToPayOut, payment.CodePayoutInProgress)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d payouts succeeded, want 1", succeeded)
+	}
+
+	payouts, err := creator.ListCampaignPayouts(ctx, c.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payouts.Payouts) != 1 {
+		t.Fatalf("campaign has %d payouts, want 1", len(payouts.Payouts))
+	}
+}
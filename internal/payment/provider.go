@@ -0,0 +1,83 @@
+package payment
+
+import (
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+// PaymentProvider is an acquirer that accepts donations and pays collected funds out.
+// Every method creating or changing an object takes idempotence key, calls with the same key must return the same object
+type PaymentProvider interface {
+	CreatePayment(idempotenceKey string, req *CreatePaymentRequest) (*Payment, error)
+	GetPayment(id string) (*Payment, error)
+	// CapturePayment confirms payment in waiting_for_capture status, nil amount captures the whole payment
+	CapturePayment(idempotenceKey string, id string, amount *money.Money) (*Payment, error)
+	CancelPayment(idempotenceKey string, id string) (*Payment, error)
+	CreateRefund(idempotenceKey string, req *CreateRefundRequest) (*Refund, error)
+	CreatePayout(idempotenceKey string, req *CreatePayoutRequest) (*Payout, error)
+	GetPayout(id string) (*Payout, error)
+}
+
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusCanceled  = "canceled"
+
+	PayoutStatusPending   = "pending"
+	PayoutStatusSucceeded = "succeeded"
+	PayoutStatusCanceled  = "canceled"
+)
+
+type (
+	CreateRefundRequest struct {
+		PaymentId   string      `json:"payment_id"`
+		Amount      money.Money `json:"amount"`
+		Description string      `json:"description,omitempty"`
+	}
+
+	Refund struct {
+		ID          string      `json:"id"`
+		PaymentId   string      `json:"payment_id"`
+		Status      string      `json:"status"`
+		Amount      money.Money `json:"amount"`
+		CreatedAt   time.Time   `json:"created_at"`
+		Description string      `json:"description,omitempty"`
+	}
+)
+
+type (
+	// PayoutDestination describes where payout is sent, fields besides Type depend on the type
+	PayoutDestination struct {
+		Type string `json:"type" validate:"required"`
+		// AccountNumber is used by yoo_money payouts
+		AccountNumber string `json:"account_number,omitempty"`
+		// Phone and BankId are used by sbp payouts
+		Phone  string `json:"phone,omitempty"`
+		BankId string `json:"bank_id,omitempty"`
+	}
+
+	CreatePayoutRequest struct {
+		Amount                money.Money            `json:"amount"`
+		PayoutToken           string                 `json:"payout_token,omitempty"`
+		PayoutDestinationData *PayoutDestination     `json:"payout_destination_data,omitempty"`
+		Description           string                 `json:"description,omitempty"`
+		Metadata              map[string]interface{} `json:"metadata,omitempty"`
+	}
+
+	Payout struct {
+		ID                string                 `json:"id"`
+		Amount            money.Money            `json:"amount"`
+		Status            string                 `json:"status"`
+		PayoutDestination *PayoutDestination     `json:"payout_destination,omitempty"`
+		Description       string                 `json:"description,omitempty"`
+		CreatedAt         time.Time              `json:"created_at"`
+		Metadata          map[string]interface{} `json:"metadata,omitempty"`
+		Test              bool                   `json:"test"`
+	}
+)
+
+var (
+	_ PaymentProvider = (*Yookassa)(nil)
+	_ PaymentProvider = (*FakeProvider)(nil)
+)
@@ -0,0 +1,274 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/outbox"
+)
+
+const (
+	RefundReasonArchived       = "archived"
+	RefundReasonGoalNotReached = "goal_not_reached"
+)
+
+const (
+	RefundJobPending   = "pending"
+	RefundJobCompleted = "completed"
+	RefundJobFailed    = "failed"
+)
+
+const (
+	// refundBatchSize payments are refunded per job claim, so a job never outlives its lease
+	refundBatchSize    = 50
+	refundLease        = 10 * time.Minute
+	refundMaxAttempts  = 10
+	refundRetryBackoff = time.Minute
+)
+
+type RefundJob struct {
+	Id            int        `db:"id"`
+	CampaignId    int        `db:"campaign_id"`
+	Reason        string     `db:"reason"`
+	Status        string     `db:"status"`
+	Attempts      int        `db:"attempts"`
+	FailedCount   int        `db:"failed_count"`
+	LastError     *string    `db:"last_error"`
+	NextAttemptAt time.Time  `db:"next_attempt_at"`
+	LockedUntil   *time.Time `db:"locked_until"`
+	RequestedAt   time.Time  `db:"requested_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+	CompletedAt   *time.Time `db:"completed_at"`
+}
+
+// RefundProgress is refund job with counts of campaign payments
+type RefundProgress struct {
+	RefundJob
+	TotalCount    int `db:"total_count"`
+	RefundedCount int `db:"refunded_count"`
+}
+
+type RefundJobModel interface {
+	// Create creates pending job for the campaign, existing job is returned as is
+	Create(ctx context.Context, campaignId int, reason string, requestedAt time.Time) (*RefundJob, error)
+	GetProgress(ctx context.Context, campaignId int) (*RefundProgress, error)
+	// Claim leases the next due job until lockedUntil, returns pgx.ErrNoRows if there is none
+	Claim(ctx context.Context, lockedUntil time.Time) (*RefundJob, error)
+	// Finish releases the job, job is completed when every donation is returned, otherwise it's retried.
+	// Job with refunds still pending at the provider is run again after pendingDelay
+	Finish(ctx context.Context, job *RefundJob, failed int, pendingDelay time.Duration, lastError string) (*RefundJob, error)
+	// Requeue makes failed or completed job pending again with attempts reset, so it runs right away
+	Requeue(ctx context.Context, campaignId int) (*RefundJob, error)
+}
+
+type refundJobModel struct {
+	db *pgxpool.Pool
+}
+
+func NewRefundJobModel(db *pgxpool.Pool) RefundJobModel {
+	return &refundJobModel{db}
+}
+
+// Create holds campaign lock of lockCampaign, so payout being reserved either finishes first or sees the job
+func (rm *refundJobModel) Create(ctx context.Context, campaignId int, reason string, requestedAt time.Time) (*RefundJob, error) {
+	var job *RefundJob
+	err := db.WithTx(ctx, rm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, rm.db)
+		if err := lockCampaign(ctx, tx, campaignId); err != nil {
+			return err
+		}
+
+		query :=
+			`INSERT INTO RefundJob (campaign_id, reason, requested_at) VALUES ($1, $2, $3)
+			ON CONFLICT (campaign_id) DO UPDATE SET campaign_id = EXCLUDED.campaign_id
+			RETURNING *`
+
+		var err error
+		job, err = db.QueryOne[RefundJob](ctx, tx, query, campaignId, reason, requestedAt)
+		return err
+	})
+	return job, err
+}
+
+func (rm *refundJobModel) GetProgress(ctx context.Context, campaignId int) (*RefundProgress, error) {
+	query :=
+		`SELECT j.*,
+			(SELECT count(*) FROM Payment p WHERE p.campaign_id = j.campaign_id AND p.status = 'succeeded') AS total_count,
+			(SELECT count(*) FROM Payment p WHERE p.campaign_id = j.campaign_id AND p.status = 'succeeded'
+				AND p.returned_at IS NOT NULL) AS refunded_count
+		FROM RefundJob j WHERE j.campaign_id = $1`
+
+	return db.QueryOne[RefundProgress](ctx, db.Conn(ctx, rm.db), query, campaignId)
+}
+
+func (rm *refundJobModel) Claim(ctx context.Context, lockedUntil time.Time) (*RefundJob, error) {
+	query :=
+		`UPDATE RefundJob SET locked_until = $1, updated_at = current_timestamp WHERE id = (
+			SELECT id FROM RefundJob
+			WHERE status = 'pending' AND next_attempt_at <= current_timestamp
+			AND (locked_until IS NULL OR locked_until < current_timestamp)
+			ORDER BY next_attempt_at LIMIT 1 FOR UPDATE SKIP LOCKED
+		) RETURNING *`
+
+	return db.QueryOne[RefundJob](ctx, db.Conn(ctx, rm.db), query, lockedUntil)
+}
+
+func (rm *refundJobModel) Finish(ctx context.Context, job *RefundJob, failed int, pendingDelay time.Duration, lastError string) (*RefundJob, error) {
+	if failed > 0 {
+		query :=
+			`UPDATE RefundJob SET attempts = attempts + 1, failed_count = $2, last_error = $3, locked_until = NULL,
+			status = CASE WHEN attempts + 1 >= $4 THEN 'failed' ELSE 'pending' END,
+			next_attempt_at = $5, updated_at = current_timestamp
+			WHERE id = $1 RETURNING *`
+
+		return db.QueryOne[RefundJob](ctx, db.Conn(ctx, rm.db), query, job.Id, failed, lastError,
+			refundMaxAttempts, time.Now().Add(refundBackoff(job.Attempts+1)))
+	}
+
+	// Donations that succeeded while the job was running, didn't fit in the batch or whose refunds are pending keep it pending
+	query :=
+		`UPDATE RefundJob j SET failed_count = 0, last_error = NULL, locked_until = NULL, attempts = 0,
+		status = CASE WHEN r.remaining THEN 'pending' ELSE 'completed' END,
+		completed_at = CASE WHEN r.remaining THEN NULL ELSE current_timestamp END,
+		next_attempt_at = current_timestamp + make_interval(secs => $3), updated_at = current_timestamp
+		FROM (
+			SELECT EXISTS (
+				SELECT 1 FROM Payment WHERE campaign_id = $2 AND status = 'succeeded' AND returned_at IS NULL
+				AND payout_record_id IS NULL
+			) AS remaining
+		) r
+		WHERE j.id = $1 RETURNING j.*`
+
+	return db.QueryOne[RefundJob](ctx, db.Conn(ctx, rm.db), query, job.Id, job.CampaignId, pendingDelay.Seconds())
+}
+
+func (rm *refundJobModel) Requeue(ctx context.Context, campaignId int) (*RefundJob, error) {
+	query :=
+		`UPDATE RefundJob SET status = 'pending', attempts = 0, next_attempt_at = current_timestamp,
+		completed_at = NULL, updated_at = current_timestamp
+		WHERE campaign_id = $1 RETURNING *`
+
+	return db.QueryOne[RefundJob](ctx, db.Conn(ctx, rm.db), query, campaignId)
+}
+
+// campaignLockClass is the first key of campaign advisory locks, so they don't collide with other advisory locks
+const campaignLockClass = 1
+
+// lockCampaign takes transaction advisory lock of the campaign, it serialises creating refund jobs and reserving payouts
+func lockCampaign(ctx context.Context, tx db.Querier, campaignId int) error {
+	return db.Exec(ctx, tx, `SELECT pg_advisory_xact_lock($1, $2)`, campaignLockClass, campaignId)
+}
+
+func refundBackoff(attempts int) time.Duration {
+	return max(refundRetryBackoff, outbox.Backoff(attempts))
+}
+
+// Refunder runs refund jobs, several refunders may run at once since jobs are leased
+type Refunder struct {
+	provider  PaymentProvider
+	payment   PaymentModel
+	refundJob RefundJobModel
+	interval  time.Duration
+}
+
+func NewRefunder(db *pgxpool.Pool, provider PaymentProvider, interval time.Duration) *Refunder {
+	return &Refunder{provider, &paymentModel{db}, &refundJobModel{db}, interval}
+}
+
+func (rf *Refunder) Run(ctx context.Context) {
+	ticker := time.NewTicker(rf.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			job, err := rf.refundJob.Claim(ctx, time.Now().Add(refundLease))
+			if err != nil {
+				if !errors.Is(err, pgx.ErrNoRows) {
+					log.Println(fmt.Errorf("unable to claim refund job: %w", err))
+				}
+				break
+			}
+
+			if err := rf.process(ctx, job); err != nil {
+				log.Println(fmt.Errorf("refund job %d: %w", job.Id, err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process refunds the next batch of campaign donations and releases the job
+func (rf *Refunder) process(ctx context.Context, job *RefundJob) error {
+	payments, err := rf.payment.ClaimRefundable(ctx, job.CampaignId, refundBatchSize)
+	if err != nil {
+		return err
+	}
+
+	var (
+		failed, pending int
+		lastError       string
+	)
+	for _, p := range payments {
+		returned, err := rf.refund(ctx, job, &p)
+		switch {
+		case err != nil:
+			failed++
+			lastError = fmt.Sprintf("payment %s: %s", p.PaymentId, err)
+		case !returned:
+			pending++
+		}
+	}
+
+	// Pending refunds stay claimed and are checked on the next run
+	var pendingDelay time.Duration
+	if pending > 0 {
+		pendingDelay = rf.interval
+	}
+	job, err = rf.refundJob.Finish(ctx, job, failed, pendingDelay, lastError)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Refund job %d of campaign %d: refunded %d of %d payments in batch, %d pending, status %s",
+		job.Id, job.CampaignId, len(payments)-failed-pending, len(payments), pending, job.Status)
+	return nil
+}
+
+// refund creates refund of the payment or gets the one created before, payment is marked returned
+// only once its refund succeeded
+func (rf *Refunder) refund(ctx context.Context, job *RefundJob, p *PaymentRecord) (bool, error) {
+	// Key is derived from payment, so refund retried after crash returns the refund created before
+	refund, err := rf.provider.CreateRefund("refund-"+p.PaymentId, &CreateRefundRequest{
+		PaymentId:   p.PaymentId,
+		Amount:      p.Amount,
+		Description: fmt.Sprintf("Refund of donation to campaign #%d (%s)", job.CampaignId, job.Reason),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	switch refund.Status {
+	case RefundStatusSucceeded:
+	case RefundStatusCanceled:
+		return false, fmt.Errorf("refund %s was canceled", refund.ID)
+	default:
+		return false, nil
+	}
+
+	if _, err := rf.payment.MarkRefunded(ctx, p.PaymentId, refund.ID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+	return true, nil
+}
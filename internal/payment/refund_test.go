@@ -0,0 +1,107 @@
+package payment_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/internal/payment"
+	"github.com/robloxxa/DistrictFunding/pkg/client"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+// donate makes succeeded donation to the campaign and waits until campaign counts it
+func (d *donateTest) donate(t *testing.T, campaignId int, amount money.Money) *client.DonateResponse {
+	t.Helper()
+
+	res, err := d.client(t, donorId).Donate(context.Background(), campaignId, &client.DonateRequest{
+		Amount:    amount,
+		ReturnUrl: "http://app.test/campaigns",
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.waitAmount(t, campaignId, amount)
+	return res
+}
+
+// runRefunder refunds donations of the campaign until the test ends
+func (d *donateTest) runRefunder(t *testing.T, campaignId int) {
+	t.Helper()
+
+	if _, err := payment.NewRefundJobModel(d.payments).Create(context.Background(), campaignId, payment.RefundReasonArchived, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go payment.NewRefunder(d.payments, d.fake, 50*time.Millisecond).Run(ctx)
+}
+
+// waitRefund polls refund job of the campaign until done returns true for it
+func (d *donateTest) waitRefund(t *testing.T, campaignId int, done func(*payment.RefundProgress) bool) *payment.RefundProgress {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, err := payment.NewRefundJobModel(d.payments).GetProgress(context.Background(), campaignId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done(job) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("refund job is %s with %d of %d refunded", job.Status, job.RefundedCount, job.TotalCount)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (d *donateTest) returned(t *testing.T, paymentId string) bool {
+	t.Helper()
+
+	var returned bool
+	err := d.payments.QueryRow(context.Background(), `SELECT returned_at IS NOT NULL FROM Payment WHERE payment_id = $1`, paymentId).Scan(&returned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return returned
+}
+
+func TestPendingRefundIsReturnedOnceItSucceeds(t *testing.T) {
+	d := newDonateTest(t)
+	c := d.campaign(t)
+	donation := d.donate(t, c.Id, money.New(10000, money.RUB))
+
+	d.fake.Script(payment.FakeCreateRefund, payment.FakeStep{Status: payment.RefundStatusSucceeded, Delay: 300 * time.Millisecond})
+	d.runRefunder(t, c.Id)
+
+	time.Sleep(150 * time.Millisecond)
+	if d.returned(t, donation.PaymentId) {
+		t.Fatal("payment is returned while its refund is pending")
+	}
+
+	d.waitRefund(t, c.Id, func(job *payment.RefundProgress) bool { return job.Status == payment.RefundJobCompleted })
+	if !d.returned(t, donation.PaymentId) {
+		t.Fatal("payment isn't returned after its refund succeeded")
+	}
+	d.waitAmount(t, c.Id, money.New(0, money.RUB))
+}
+
+func TestCanceledRefundIsNotReturned(t *testing.T) {
+	d := newDonateTest(t)
+	c := d.campaign(t)
+	donation := d.donate(t, c.Id, money.New(10000, money.RUB))
+
+	// Refund is pending at first and canceled by the provider later
+	d.fake.Script(payment.FakeCreateRefund, payment.FakeStep{Status: payment.RefundStatusCanceled, Delay: 300 * time.Millisecond})
+	d.runRefunder(t, c.Id)
+
+	job := d.waitRefund(t, c.Id, func(job *payment.RefundProgress) bool { return job.LastError != nil })
+	if job.Status != payment.RefundJobPending || job.FailedCount != 1 {
+		t.Fatalf("refund job is %s with %d failed, want %s with 1 failed", job.Status, job.FailedCount, payment.RefundJobPending)
+	}
+	if d.returned(t, donation.PaymentId) {
+		t.Fatal("payment is returned after its refund was canceled")
+	}
+}
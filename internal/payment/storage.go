@@ -1,4 +1,189 @@
 package payment
 
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+	"github.com/robloxxa/DistrictFunding/pkg/outbox"
+)
+
+// PaymentRecord is a donation stored in Payment table, PaymentId is the id of yookassa payment
+type PaymentRecord struct {
+	Id              int          `db:"id"`
+	PaymentId       string       `db:"payment_id"`
+	IdempotenceKey  string       `db:"idempotence_key"`
+	UserId          string       `db:"user_id"`
+	CampaignId      int          `db:"campaign_id"`
+	Amount          money.Money  `db:"amount"`
+	Status          string       `db:"status"`
+	ConfirmationUrl string       `db:"confirmation_url"`
+	ReturnedAt      *time.Time   `db:"returned_at"`
+	RefundId        *string      `db:"refund_id"`
+	RefundStartedAt *time.Time   `db:"refund_started_at"`
+	IncomeAmount    *money.Money `db:"income_amount"`
+	PayoutRecordId  *int         `db:"payout_record_id"`
+	CreatedAt       time.Time    `db:"created_at"`
+	UpdatedAt       time.Time    `db:"updated_at"`
+}
+
 type PaymentModel interface {
+	Create(context.Context, *PaymentRecord) (*PaymentRecord, error)
+	GetByPaymentId(ctx context.Context, paymentId string) (*PaymentRecord, error)
+	GetByIdempotenceKey(ctx context.Context, key string) (*PaymentRecord, error)
+	// UpdateStatus moves payment to a new status, income is amount after provider fee if it's known
+	UpdateStatus(ctx context.Context, paymentId string, status string, income *money.Money) (*PaymentRecord, error)
+	MarkRefunded(ctx context.Context, paymentId string, refundId string) (*PaymentRecord, error)
+	// ClaimRefundable marks succeeded payments of the campaign that weren't returned or paid out yet as being refunded
+	// and returns them, claimed payments are never reserved by payouts
+	ClaimRefundable(ctx context.Context, campaignId int, limit int) ([]PaymentRecord, error)
+	// ListStuck returns payments that are still not final after being created before the time
+	ListStuck(ctx context.Context, createdBefore time.Time, limit int) ([]PaymentRecord, error)
+	// List returns payments matching the filter older than payment before, newest first.
+	// Zero before lists from the newest payment
+	List(ctx context.Context, filter *PaymentFilter, before int, limit int) ([]PaymentRecord, error)
+	ListByUserId(ctx context.Context, userId string) ([]PaymentRecord, error)
+}
+
+// PaymentFilter narrows payments listed by staff, zero fields match any payment
+type PaymentFilter struct {
+	CampaignId int    `json:"campaign_id,omitempty"`
+	UserId     string `json:"user_id,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
+
+type paymentModel struct {
+	db *pgxpool.Pool
+}
+
+func NewPaymentModel(db *pgxpool.Pool) PaymentModel {
+	return &paymentModel{db}
+}
+
+// Create stores the payment, if payment with the same idempotence key already exists it's returned instead
+func (pm *paymentModel) Create(ctx context.Context, p *PaymentRecord) (*PaymentRecord, error) {
+	query :=
+		`INSERT INTO Payment (payment_id, idempotence_key, user_id, campaign_id, amount, status, confirmation_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (idempotence_key) DO UPDATE SET idempotence_key = EXCLUDED.idempotence_key
+		RETURNING *`
+
+	return db.QueryOne[PaymentRecord](ctx, db.Conn(ctx, pm.db), query,
+		p.PaymentId, p.IdempotenceKey, p.UserId, p.CampaignId, p.Amount, p.Status, p.ConfirmationUrl)
+}
+
+func (pm *paymentModel) GetByPaymentId(ctx context.Context, paymentId string) (*PaymentRecord, error) {
+	query := `SELECT * FROM Payment WHERE payment_id = $1`
+
+	return db.QueryOne[PaymentRecord](ctx, db.Conn(ctx, pm.db), query, paymentId)
+}
+
+func (pm *paymentModel) GetByIdempotenceKey(ctx context.Context, key string) (*PaymentRecord, error) {
+	query := `SELECT * FROM Payment WHERE idempotence_key = $1`
+
+	return db.QueryOne[PaymentRecord](ctx, db.Conn(ctx, pm.db), query, key)
+}
+
+// UpdateStatus moves payment to a new status, payments in final status (succeeded or canceled) are never changed,
+// so repeated webhooks are no-op. Succeeded payment emits donation event in the same transaction.
+// Returns pgx.ErrNoRows if payment is not found or is already final
+func (pm *paymentModel) UpdateStatus(ctx context.Context, paymentId string, status string, income *money.Money) (*PaymentRecord, error) {
+	var p *PaymentRecord
+	err := db.WithTx(ctx, pm.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, pm.db)
+
+		query :=
+			`UPDATE Payment SET status = $2, income_amount = COALESCE($3, income_amount), updated_at = current_timestamp
+			WHERE payment_id = $1 AND status NOT IN ('succeeded', 'canceled') RETURNING *`
+
+		var err error
+		if p, err = db.QueryOne[PaymentRecord](ctx, tx, query, paymentId, status, income); err != nil {
+			return err
+		}
+
+		if p.Status != PaymentStatusSucceeded {
+			return nil
+		}
+
+		if err := outbox.Insert(ctx, strconv.Itoa(p.CampaignId), campaign.DonationEventSucceeded, newDonationEvent(campaign.DonationEventSucceeded, p)); err != nil {
+			return err
+		}
+
+		// Donation to a campaign that is already being refunded has to be refunded too
+		return db.Exec(ctx, tx, `UPDATE RefundJob SET status = 'pending', next_attempt_at = current_timestamp,
+		completed_at = NULL, updated_at = current_timestamp WHERE campaign_id = $1 AND status <> 'pending'`, p.CampaignId)
+	})
+	return p, err
+}
+
+// MarkRefunded records that succeeded payment was returned and emits refund event in the same transaction.
+// Returns pgx.ErrNoRows if payment is not found, isn't succeeded, is already refunded or paid out
+func (pm *paymentModel) MarkRefunded(ctx context.Context, paymentId string, refundId string) (*PaymentRecord, error) {
+	var p *PaymentRecord
+	err := db.WithTx(ctx, pm.db, func(ctx context.Context) error {
+		query :=
+			`UPDATE Payment SET returned_at = current_timestamp, refund_id = $2, updated_at = current_timestamp
+			WHERE payment_id = $1 AND status = 'succeeded' AND returned_at IS NULL AND payout_record_id IS NULL
+			RETURNING *`
+
+		var err error
+		if p, err = db.QueryOne[PaymentRecord](ctx, db.Conn(ctx, pm.db), query, paymentId, refundId); err != nil {
+			return err
+		}
+
+		return outbox.Insert(ctx, strconv.Itoa(p.CampaignId), campaign.DonationEventRefunded, newDonationEvent(campaign.DonationEventRefunded, p))
+	})
+	return p, err
+}
+
+// ClaimRefundable commits the claim before provider is called, so payout reserving the campaign donations
+// either waits for it and skips claimed payments or takes them first, then they aren't claimed.
+// Payments claimed before and not refunded yet are returned again, their refunds are retried with the same key
+func (pm *paymentModel) ClaimRefundable(ctx context.Context, campaignId int, limit int) ([]PaymentRecord, error) {
+	query :=
+		`UPDATE Payment SET refund_started_at = COALESCE(refund_started_at, current_timestamp), updated_at = current_timestamp
+		WHERE id IN (
+			SELECT id FROM Payment WHERE campaign_id = $1 AND status = 'succeeded' AND returned_at IS NULL
+			AND payout_record_id IS NULL ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+		) RETURNING *`
+
+	return db.QueryAll[PaymentRecord](ctx, db.Conn(ctx, pm.db), query, campaignId, limit)
+}
+
+func (pm *paymentModel) ListStuck(ctx context.Context, createdBefore time.Time, limit int) ([]PaymentRecord, error) {
+	query :=
+		`SELECT * FROM Payment WHERE status NOT IN ('succeeded', 'canceled') AND created_at < $1
+		ORDER BY created_at LIMIT $2`
+
+	return db.QueryAll[PaymentRecord](ctx, db.Conn(ctx, pm.db), query, createdBefore, limit)
+}
+
+func (pm *paymentModel) List(ctx context.Context, filter *PaymentFilter, before int, limit int) ([]PaymentRecord, error) {
+	query :=
+		`SELECT * FROM Payment WHERE ($1::INT = 0 OR campaign_id = $1) AND ($2::TEXT = '' OR user_id::TEXT = $2)
+		AND ($3::TEXT = '' OR status = $3) AND ($4::INT = 0 OR id < $4) ORDER BY id DESC LIMIT $5`
+
+	return db.QueryAll[PaymentRecord](ctx, db.Conn(ctx, pm.db), query,
+		filter.CampaignId, filter.UserId, filter.Status, before, limit)
+}
+
+func (pm *paymentModel) ListByUserId(ctx context.Context, userId string) ([]PaymentRecord, error) {
+	query := `SELECT * FROM Payment WHERE user_id = $1 ORDER BY id DESC`
+
+	return db.QueryAll[PaymentRecord](ctx, db.Conn(ctx, pm.db), query, userId)
+}
+
+func newDonationEvent(eventType string, p *PaymentRecord) *campaign.DonationEventRequest {
+	return &campaign.DonationEventRequest{
+		Type:       eventType,
+		PaymentId:  p.PaymentId,
+		CampaignId: p.CampaignId,
+		AccountId:  p.UserId,
+		Amount:     p.Amount,
+		OccurredAt: p.UpdatedAt,
+	}
 }
@@ -1,23 +1,22 @@
 package payment
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/money"
 )
 
 const (
-	yooKassaUrl = "https://api.yookassa.ru/v3/"
+	DefaultYookassaUrl = "https://api.yookassa.ru/v3/"
 )
 
-type Amount struct {
-	Value    string `json:"value"`
-	Currency string `json:"currency"`
-}
-
 type AuthorizationDetails struct {
 	Rrn          string `json:"rrn"`
 	AuthCode     string `json:"auth_code"`
@@ -48,23 +47,21 @@ type Payment struct {
 	ID                   string                 `json:"id"`
 	Status               string                 `json:"status"`
 	Paid                 bool                   `json:"paid"`
-	Amount               Amount                 `json:"amount"`
+	Amount               money.Money            `json:"amount"`
 	AuthorizationDetails *AuthorizationDetails  `json:"authorization_details"`
 	CreatedAt            time.Time              `json:"created_at"`
 	Description          string                 `json:"description,omitempty"`
 	ExpiresAt            time.Time              `json:"expires_at"`
 	Metadata             map[string]interface{} `json:"metadata,omitempty"`
+	Confirmation         *Confirmation          `json:"confirmation,omitempty"`
 	PaymentMethod        *PaymentMethod         `json:"payment_method,omitempty"`
 	Recipient            struct {
 		AccountID string `json:"account_id"`
 		GatewayID string `json:"gateway_id"`
 	} `json:"recipient"`
-	Refundable   bool `json:"refundable"`
-	Test         bool `json:"test"`
-	IncomeAmount struct {
-		Value    string `json:"value"`
-		Currency string `json:"currency"`
-	} `json:"income_amount"`
+	Refundable   bool         `json:"refundable"`
+	Test         bool         `json:"test"`
+	IncomeAmount *money.Money `json:"income_amount,omitempty"`
 }
 
 type (
@@ -83,19 +80,65 @@ type (
 	}
 )
 
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusWaitingForCapture = "waiting_for_capture"
+	PaymentStatusSucceeded         = "succeeded"
+	PaymentStatusCanceled          = "canceled"
+)
+
+type Confirmation struct {
+	Type            string `json:"type"`
+	ReturnUrl       string `json:"return_url,omitempty"`
+	ConfirmationUrl string `json:"confirmation_url,omitempty"`
+}
+
+type CreatePaymentRequest struct {
+	Amount       money.Money            `json:"amount"`
+	Capture      bool                   `json:"capture"`
+	Confirmation *Confirmation          `json:"confirmation,omitempty"`
+	Description  string                 `json:"description,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Notification is a body of webhook request sent by yookassa
+type Notification struct {
+	Type   string  `json:"type"`
+	Event  string  `json:"event"`
+	Object Payment `json:"object"`
+}
+
+// YookassaError is an error response of yookassa api
+type YookassaError struct {
+	Type        string `json:"type"`
+	Id          string `json:"id"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Parameter   string `json:"parameter"`
+	// Status is http status of the response
+	Status int `json:"-"`
+}
+
+func (e *YookassaError) Error() string {
+	return fmt.Sprintf("yookassa: %s: %s", e.Code, e.Description)
+}
+
 type Yookassa struct {
-	shopId int
-	token  string
-	c      *http.Client
+	shopId  int
+	token   string
+	baseUrl string
+	c       *http.Client
 }
 
-func NewYookassa(shopId int, token string) *Yookassa {
-	return &Yookassa{shopId, token, &http.Client{}}
+// NewYookassa creates yookassa api client, baseUrl is usually DefaultYookassaUrl,
+// but can point to a fake server like yookassatest.Server
+func NewYookassa(baseUrl string, shopId int, token string) *Yookassa {
+	return &Yookassa{shopId, token, baseUrl, &http.Client{Timeout: 30 * time.Second}}
 }
 
 // newRequest makes a request with Authorization Header and appends endpoint (like /me) to the yookassa url string
 func (y *Yookassa) newRequest(method string, endpoint string, body io.Reader) (*http.Request, error) {
-	urlString, err := url.JoinPath(yooKassaUrl, endpoint)
+	urlString, err := url.JoinPath(y.baseUrl, endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -103,30 +146,128 @@ func (y *Yookassa) newRequest(method string, endpoint string, body io.Reader) (*
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %d:%s", y.shopId, y.token))
+	req.SetBasicAuth(strconv.Itoa(y.shopId), y.token)
 	return req, nil
 }
 
-func (y *Yookassa) Me() (*Me, error) {
-	var me Me
-	req, err := y.newRequest("GET", "/me", nil)
+// do sends request with json body and decodes json response into out, idempotenceKey is set only if it's not empty
+func (y *Yookassa) do(method string, endpoint string, idempotenceKey string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := y.newRequest(method, endpoint, reqBody)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if idempotenceKey != "" {
+		req.Header.Set("Idempotence-Key", idempotenceKey)
 	}
 
 	res, err := y.c.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer res.Body.Close()
 
-	if err = json.NewDecoder(res.Body).Decode(&me); err != nil {
+	if res.StatusCode >= http.StatusBadRequest {
+		yErr := &YookassaError{Status: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(yErr); err != nil {
+			return fmt.Errorf("yookassa: unexpected response status: %s", res.Status)
+		}
+		return yErr
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (y *Yookassa) Me() (*Me, error) {
+	var me Me
+	if err := y.do(http.MethodGet, "/me", "", nil, &me); err != nil {
 		return nil, err
 	}
 
 	return &me, nil
 }
 
-// CreatePayment creates new payment in yookassa via POST /payments
-func (y *Yookassa) CreatePayment(idempotentcyKey string, payment *Payment) {
+// CreatePayment creates new payment in yookassa via POST /payments.
+// Requests with the same idempotence key return the same payment, so it's safe to retry them
+func (y *Yookassa) CreatePayment(idempotenceKey string, req *CreatePaymentRequest) (*Payment, error) {
+	var payment Payment
+	if err := y.do(http.MethodPost, "/payments", idempotenceKey, req, &payment); err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// GetPayment fetches current payment state via GET /payments/{id}
+func (y *Yookassa) GetPayment(id string) (*Payment, error) {
+	var payment Payment
+	if err := y.do(http.MethodGet, "/payments/"+url.PathEscape(id), "", nil, &payment); err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// CapturePayment captures payment via POST /payments/{id}/capture
+func (y *Yookassa) CapturePayment(idempotenceKey string, id string, amount *money.Money) (*Payment, error) {
+	var payment Payment
+	body := struct {
+		Amount *money.Money `json:"amount,omitempty"`
+	}{amount}
+	if err := y.do(http.MethodPost, "/payments/"+url.PathEscape(id)+"/capture", idempotenceKey, &body, &payment); err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// CancelPayment cancels payment in waiting_for_capture status via POST /payments/{id}/cancel
+func (y *Yookassa) CancelPayment(idempotenceKey string, id string) (*Payment, error) {
+	var payment Payment
+	if err := y.do(http.MethodPost, "/payments/"+url.PathEscape(id)+"/cancel", idempotenceKey, struct{}{}, &payment); err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// CreateRefund returns money of succeeded payment via POST /refunds
+func (y *Yookassa) CreateRefund(idempotenceKey string, req *CreateRefundRequest) (*Refund, error) {
+	var refund Refund
+	if err := y.do(http.MethodPost, "/refunds", idempotenceKey, req, &refund); err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// CreatePayout sends money to the destination via POST /payouts
+func (y *Yookassa) CreatePayout(idempotenceKey string, req *CreatePayoutRequest) (*Payout, error) {
+	var payout Payout
+	if err := y.do(http.MethodPost, "/payouts", idempotenceKey, req, &payout); err != nil {
+		return nil, err
+	}
+
+	return &payout, nil
+}
+
+// GetPayout fetches current payout state via GET /payouts/{id}
+func (y *Yookassa) GetPayout(id string) (*Payout, error) {
+	var payout Payout
+	if err := y.do(http.MethodGet, "/payouts/"+url.PathEscape(id), "", nil, &payout); err != nil {
+		return nil, err
+	}
 
+	return &payout, nil
 }
@@ -0,0 +1,154 @@
+// Package yookassatest provides a fake yookassa api server for running the donation flow locally and in tests
+package yookassatest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robloxxa/DistrictFunding/internal/payment"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+// Server is yookassa api backed by payment.FakeProvider, so Yookassa client talks to the same fake
+// as the in-process provider. Objects change status and notify webhook as the provider is scripted
+type Server struct {
+	*httptest.Server
+	*payment.FakeProvider
+}
+
+// NewServer starts the api, notifications are sent to webhookUrl if it's not empty
+func NewServer(webhookUrl string) *Server {
+	f := payment.NewFakeProvider(webhookUrl)
+	return &Server{httptest.NewServer(NewHandler(f)), f}
+}
+
+// NewHandler serves yookassa api endpoints used by payment.Yookassa with f
+func NewHandler(f *payment.FakeProvider) http.Handler {
+	h := &handler{f}
+
+	r := chi.NewRouter()
+	r.Post("/payments", h.createPayment)
+	r.Get("/payments/{paymentId}", h.getPayment)
+	r.Post("/payments/{paymentId}/capture", h.capturePayment)
+	r.Post("/payments/{paymentId}/cancel", h.cancelPayment)
+	r.Post("/refunds", h.createRefund)
+	r.Post("/payouts", h.createPayout)
+	r.Get("/payouts/{payoutId}", h.getPayout)
+
+	return r
+}
+
+type handler struct {
+	f *payment.FakeProvider
+}
+
+func (h *handler) createPayment(w http.ResponseWriter, r *http.Request) {
+	var req payment.CreatePaymentRequest
+
+	key, ok := decode(w, r, &req)
+	if !ok {
+		return
+	}
+
+	p, err := h.f.CreatePayment(key, &req)
+	write(w, p, err)
+}
+
+func (h *handler) getPayment(w http.ResponseWriter, r *http.Request) {
+	p, err := h.f.GetPayment(chi.URLParam(r, "paymentId"))
+	write(w, p, err)
+}
+
+func (h *handler) capturePayment(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount *money.Money `json:"amount"`
+	}
+
+	key, ok := decode(w, r, &req)
+	if !ok {
+		return
+	}
+
+	p, err := h.f.CapturePayment(key, chi.URLParam(r, "paymentId"), req.Amount)
+	write(w, p, err)
+}
+
+func (h *handler) cancelPayment(w http.ResponseWriter, r *http.Request) {
+	key, ok := decode(w, r, nil)
+	if !ok {
+		return
+	}
+
+	p, err := h.f.CancelPayment(key, chi.URLParam(r, "paymentId"))
+	write(w, p, err)
+}
+
+func (h *handler) createRefund(w http.ResponseWriter, r *http.Request) {
+	var req payment.CreateRefundRequest
+
+	key, ok := decode(w, r, &req)
+	if !ok {
+		return
+	}
+
+	refund, err := h.f.CreateRefund(key, &req)
+	write(w, refund, err)
+}
+
+func (h *handler) createPayout(w http.ResponseWriter, r *http.Request) {
+	var req payment.CreatePayoutRequest
+
+	key, ok := decode(w, r, &req)
+	if !ok {
+		return
+	}
+
+	p, err := h.f.CreatePayout(key, &req)
+	write(w, p, err)
+}
+
+func (h *handler) getPayout(w http.ResponseWriter, r *http.Request) {
+	p, err := h.f.GetPayout(chi.URLParam(r, "payoutId"))
+	write(w, p, err)
+}
+
+// decode reads idempotence key, yookassa requires it for every POST, and json body into req unless it's nil
+func decode(w http.ResponseWriter, r *http.Request, req any) (string, bool) {
+	key := r.Header.Get("Idempotence-Key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Idempotence-Key header is required")
+		return "", false
+	}
+
+	if req != nil {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return "", false
+		}
+	}
+	return key, true
+}
+
+// write responds with v or with yookassa error matching err
+func write(w http.ResponseWriter, v any, err error) {
+	switch {
+	case err == nil:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	case errors.Is(err, payment.ErrFakeNotFound):
+		writeError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, payment.ErrFakeFailure):
+		writeError(w, http.StatusInternalServerError, "internal_server_error", err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&payment.YookassaError{Type: "error", Code: code, Description: description})
+}
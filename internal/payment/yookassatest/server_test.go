@@ -0,0 +1,125 @@
+package yookassatest_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/robloxxa/DistrictFunding/internal/payment"
+	"github.com/robloxxa/DistrictFunding/internal/payment/yookassatest"
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+func newYookassa(t *testing.T) (*yookassatest.Server, *payment.Yookassa) {
+	s := yookassatest.NewServer("")
+	t.Cleanup(s.Close)
+	return s, payment.NewYookassa(s.URL, 123456, "test")
+}
+
+func TestPaymentCapture(t *testing.T) {
+	s, y := newYookassa(t)
+
+	req := &payment.CreatePaymentRequest{Amount: money.New(10000, money.RUB)}
+	p, err := y.CreatePayment("create", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := y.CreatePayment("create", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != p.ID {
+		t.Fatalf("retry created payment %s, want %s", again.ID, p.ID)
+	}
+
+	s.Wait()
+	if p, err = y.GetPayment(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != payment.PaymentStatusWaitingForCapture {
+		t.Fatalf("payment is %s, want %s", p.Status, payment.PaymentStatusWaitingForCapture)
+	}
+
+	// Retry of the capture returns the payment instead of failing on its final status
+	for i := 0; i < 2; i++ {
+		captured, err := y.CapturePayment("capture", p.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if captured.Status != payment.PaymentStatusSucceeded {
+			t.Fatalf("payment is %s, want %s", captured.Status, payment.PaymentStatusSucceeded)
+		}
+	}
+
+	refund, err := y.CreateRefund("refund", &payment.CreateRefundRequest{PaymentId: p.ID, Amount: p.Amount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.PaymentId != p.ID {
+		t.Fatalf("refund of payment %s, want %s", refund.PaymentId, p.ID)
+	}
+}
+
+func TestPaymentCancel(t *testing.T) {
+	s, y := newYookassa(t)
+	s.Script(payment.FakeCreatePayment, payment.FakeStep{Status: payment.PaymentStatusPending})
+
+	p, err := y.CreatePayment("create", &payment.CreatePaymentRequest{Amount: money.New(10000, money.RUB)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		canceled, err := y.CancelPayment("cancel", p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if canceled.Status != payment.PaymentStatusCanceled {
+			t.Fatalf("payment is %s, want %s", canceled.Status, payment.PaymentStatusCanceled)
+		}
+	}
+
+	if _, err := y.CreateRefund("refund", &payment.CreateRefundRequest{PaymentId: p.ID, Amount: p.Amount}); err == nil {
+		t.Fatal("canceled payment is refunded")
+	}
+}
+
+func TestPayout(t *testing.T) {
+	s, y := newYookassa(t)
+
+	p, err := y.CreatePayout("payout", &payment.CreatePayoutRequest{
+		Amount:                money.New(10000, money.RUB),
+		PayoutDestinationData: &payment.PayoutDestination{Type: "yoo_money", AccountNumber: "4100116075156746"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Wait()
+	if p, err = y.GetPayout(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != payment.PayoutStatusSucceeded {
+		t.Fatalf("payout is %s, want %s", p.Status, payment.PayoutStatusSucceeded)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s, y := newYookassa(t)
+	s.Script(payment.FakeCreatePayment, payment.FakeStep{Fail: true})
+
+	req := &payment.CreatePaymentRequest{Amount: money.New(10000, money.RUB)}
+	var yErr *payment.YookassaError
+	if _, err := y.CreatePayment("create", req); !errors.As(err, &yErr) || yErr.Status != http.StatusInternalServerError {
+		t.Fatalf("got %v, want scripted failure", err)
+	}
+	if _, err := y.CreatePayment("", req); !errors.As(err, &yErr) || yErr.Status != http.StatusBadRequest {
+		t.Fatalf("got %v, want missing idempotence key", err)
+	}
+	if _, err := y.GetPayment("missing"); !errors.As(err, &yErr) || yErr.Status != http.StatusNotFound {
+		t.Fatalf("got %v, want not found", err)
+	}
+	if _, err := y.GetPayout("missing"); !errors.As(err, &yErr) || yErr.Status != http.StatusNotFound {
+		t.Fatalf("got %v, want not found", err)
+	}
+}
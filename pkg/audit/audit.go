@@ -0,0 +1,167 @@
+// Package audit records actions of staff, entries are written in the transaction of the action,
+// so an action can't happen without its entry.
+//
+// Every service database using it has AuditLog table:
+//
+//	CREATE TABLE IF NOT EXISTS AuditLog (
+//	    id BIGSERIAL PRIMARY KEY,
+//	    actor_id UUID,
+//	    actor_role VARCHAR(16) NOT NULL,
+//	    action VARCHAR(64) NOT NULL,
+//	    target_type VARCHAR(32) NOT NULL,
+//	    target_id VARCHAR(64) NOT NULL,
+//	    details JSONB NOT NULL DEFAULT '{}',
+//	    request_id VARCHAR(128) NOT NULL DEFAULT '',
+//	    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+//	);
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+	"github.com/robloxxa/DistrictFunding/pkg/openapi"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// ActorOperator is actor role of actions made with dfctl, they have no actor id
+const ActorOperator = "operator"
+
+var (
+	ErrInvalidQuery = response.NewProblem(http.StatusBadRequest, response.CodeBadRequest, "invalid query")
+)
+
+// Entry is a recorded action, ActorId is nil for actions made by operators
+type Entry struct {
+	Id         int64           `db:"id" json:"id"`
+	ActorId    *string         `db:"actor_id" json:"actor_id,omitempty"`
+	ActorRole  string          `db:"actor_role" json:"actor_role"`
+	Action     string          `db:"action" json:"action"`
+	TargetType string          `db:"target_type" json:"target_type"`
+	TargetId   string          `db:"target_id" json:"target_id"`
+	Details    json.RawMessage `db:"details" json:"details"`
+	RequestId  string          `db:"request_id" json:"request_id,omitempty"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+}
+
+type ListResponse struct {
+	Entries []Entry `json:"entries"`
+	// NextCursor is empty when there are no more entries
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// New creates entry of the action made by the request, actor is taken from its access token
+func New(r *http.Request, action, targetType, targetId string) *Entry {
+	e := &Entry{
+		ActorRole:  string(jwtauth.RoleUser),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		RequestId:  middleware.GetReqID(r.Context()),
+	}
+
+	if token, err := jwtauth.FromContext(r.Context()); err == nil && token != nil {
+		actorId := token.Subject()
+		e.ActorId = &actorId
+		e.ActorRole = string(jwtauth.RoleFromToken(token))
+	}
+	return e
+}
+
+// Operator creates entry of the action made with dfctl
+func Operator(action, targetType, targetId string) *Entry {
+	return &Entry{ActorRole: ActorOperator, Action: action, TargetType: targetType, TargetId: targetId}
+}
+
+// Record stores the entry with details marshaled to json, call it with the transaction of the action
+func Record(ctx context.Context, q db.Querier, e *Entry, details any) error {
+	if details == nil {
+		details = struct{}{}
+	}
+	b, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	return db.Exec(ctx, q,
+		`INSERT INTO AuditLog (actor_id, actor_role, action, target_type, target_id, details, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		e.ActorId, e.ActorRole, e.Action, e.TargetType, e.TargetId, b, e.RequestId)
+}
+
+// List returns entries older than entry before, newest first. Zero before lists from the newest entry
+func List(ctx context.Context, q db.Querier, before int64, limit int) ([]Entry, error) {
+	query :=
+		`SELECT * FROM AuditLog WHERE $1::BIGINT = 0 OR id < $1 ORDER BY id DESC LIMIT $2`
+
+	return db.QueryAll[Entry](ctx, q, query, before, limit)
+}
+
+// ListHandler serves audit log of the service database with limit and cursor query parameters
+func ListHandler(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		limit := defaultListLimit
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxListLimit {
+				response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("limit must be between 1 and %d", maxListLimit))
+				return
+			}
+			limit = n
+		}
+
+		var before int64
+		if v := q.Get("cursor"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 1 {
+				response.WriteProblem(w, r, ErrInvalidQuery.WithDetail("invalid cursor"))
+				return
+			}
+			before = n
+		}
+
+		entries, err := List(r.Context(), db.Conn(r.Context(), pool), before, limit+1)
+		if err != nil {
+			response.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		res := ListResponse{Entries: entries}
+		if len(entries) > limit {
+			res.Entries = entries[:limit]
+			res.NextCursor = strconv.FormatInt(entries[limit-1].Id, 10)
+		}
+		if res.Entries == nil {
+			res.Entries = []Entry{}
+		}
+		response.Json(w, &res)
+	}
+}
+
+// Route documents ListHandler
+func Route() openapi.Route {
+	return openapi.Route{
+		Summary:  "List audit log of the service, newest first",
+		Security: openapi.SecurityBearer,
+		Params: []openapi.Parameter{
+			openapi.QueryParam("limit", openapi.Integer(), "page size, 50 by default and 200 at most"),
+			openapi.QueryParam("cursor", openapi.String(), "next_cursor of the previous page"),
+		},
+		Response: ListResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+	}
+}
@@ -0,0 +1,396 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/internal/auth"
+)
+
+type (
+	SignUpRequest  = auth.SignUpRequest
+	SignInRequest  = auth.SignInRequest
+	RefreshRequest = auth.RefreshRequest
+	TokenResponse  = auth.TokenResponse
+	MeResponse     = auth.MeRequest
+
+	UpdateMeRequest = auth.UpdateMeRequest
+
+	EnrollTwoFactorResponse = auth.EnrollTwoFactorResponse
+	IdentityResponse        = auth.IdentityResponse
+
+	DataExportResponse = auth.DataExportResponse
+)
+
+// ChallengeError is returned by SignIn for accounts with two-factor authentication,
+// sign in is finished with SignInTwoFactor
+type ChallengeError struct {
+	Token string
+	// ExpiresIn is lifetime of the challenge in seconds
+	ExpiresIn int
+}
+
+func (e *ChallengeError) Error() string {
+	return "two-factor code is required to sign in"
+}
+
+// SignUp creates account and signs the client in
+func (c *Client) SignUp(ctx context.Context, req *SignUpRequest) (*TokenResponse, error) {
+	var t TokenResponse
+	err := c.do(ctx, &call{method: http.MethodPost, url: c.authUrl, path: []string{"signup"}, body: req}, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setTokens(&t)
+	return &t, nil
+}
+
+// SignIn signs the client in, accounts with two-factor authentication get *ChallengeError instead
+func (c *Client) SignIn(ctx context.Context, req *SignInRequest) (*TokenResponse, error) {
+	return c.signIn(ctx, []string{"signin"}, req)
+}
+
+func (c *Client) signIn(ctx context.Context, path []string, req any) (*TokenResponse, error) {
+	var res auth.SignInResponse
+	err := c.do(ctx, &call{method: http.MethodPost, url: c.authUrl, path: path, body: req}, &res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Challenge != nil {
+		return nil, &ChallengeError{Token: res.Challenge.Token, ExpiresIn: res.Challenge.ExpiresIn}
+	}
+
+	c.setTokens(res.TokenResponse)
+	return res.TokenResponse, nil
+}
+
+// SignInTwoFactor finishes sign in with token of *ChallengeError and totp or recovery code
+func (c *Client) SignInTwoFactor(ctx context.Context, challenge, code string) (*TokenResponse, error) {
+	var t TokenResponse
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"signin", "2fa"},
+		body:   &auth.SignInTwoFactorRequest{ChallengeToken: challenge, Code: code},
+	}, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setTokens(&t)
+	return &t, nil
+}
+
+// SignOut revokes tokens of the client, the client is signed out even if request fails
+func (c *Client) SignOut(ctx context.Context) error {
+	t := c.Tokens()
+	if t == nil {
+		return ErrNotSignedIn
+	}
+
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"signout"},
+		body:   &auth.SignOutRequest{RefreshToken: t.RefreshToken},
+		auth:   true,
+	}, nil)
+
+	c.mu.Lock()
+	c.tokens = nil
+	c.mu.Unlock()
+	return err
+}
+
+func (c *Client) Me(ctx context.Context) (*MeResponse, error) {
+	var me MeResponse
+	err := c.do(ctx, &call{method: http.MethodGet, url: c.authUrl, path: []string{"me"}, auth: true, retry: true}, &me)
+	if err != nil {
+		return nil, err
+	}
+	return &me, nil
+}
+
+// UpdateMe changes username and names of the account, nil fields stay the same
+func (c *Client) UpdateMe(ctx context.Context, req *UpdateMeRequest) (*MeResponse, error) {
+	var me MeResponse
+	err := c.do(ctx, &call{method: http.MethodPatch, url: c.authUrl, path: []string{"me"}, body: req, auth: true}, &me)
+	if err != nil {
+		return nil, err
+	}
+	return &me, nil
+}
+
+// ChangePassword sets a new password, other sessions are signed out and the client gets new tokens
+func (c *Client) ChangePassword(ctx context.Context, current, password string) (*TokenResponse, error) {
+	var t TokenResponse
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"me", "password"},
+		body:   &auth.ChangePasswordRequest{CurrentPassword: current, NewPassword: password},
+		auth:   true,
+	}, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setTokens(&t)
+	return &t, nil
+}
+
+// ChangeEmail sends confirmation link to the new email, it's confirmed with ConfirmEmailChange
+func (c *Client) ChangeEmail(ctx context.Context, email, password string) error {
+	return c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"me", "email"},
+		body:   &auth.ChangeEmailRequest{Email: email, Password: password},
+		auth:   true,
+	}, nil)
+}
+
+// ConfirmEmailChange changes email with token of confirmation email. Signed in client refreshes its tokens,
+// so the access token says email is verified
+func (c *Client) ConfirmEmailChange(ctx context.Context, token string) error {
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"me", "email", "confirm"},
+		body:   &auth.VerifyEmailRequest{Token: token},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if t := c.Tokens(); t != nil {
+		_, err = c.refresh(ctx, t.AccessToken)
+	}
+	return err
+}
+
+// DeleteAccount schedules deletion of the account and signs the client out, returns when the account is anonymised.
+// Until then signing in and RestoreAccount cancel deletion
+func (c *Client) DeleteAccount(ctx context.Context, password string) (time.Time, error) {
+	var res auth.DeleteMeResponse
+	err := c.do(ctx, &call{
+		method: http.MethodDelete,
+		url:    c.authUrl,
+		path:   []string{"me"},
+		body:   &auth.DeleteMeRequest{Password: password},
+		auth:   true,
+	}, &res)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	c.mu.Lock()
+	c.tokens = nil
+	c.mu.Unlock()
+	return res.DeletionScheduledAt, nil
+}
+
+func (c *Client) RestoreAccount(ctx context.Context) (*MeResponse, error) {
+	var me MeResponse
+	err := c.do(ctx, &call{method: http.MethodPost, url: c.authUrl, path: []string{"me", "restore"}, auth: true}, &me)
+	if err != nil {
+		return nil, err
+	}
+	return &me, nil
+}
+
+// RequestExport queues personal data export of the account, its download link is emailed once the archive is ready
+func (c *Client) RequestExport(ctx context.Context) (*DataExportResponse, error) {
+	var e DataExportResponse
+	if err := c.do(ctx, &call{method: http.MethodPost, url: c.authUrl, path: []string{"me", "export"}, auth: true}, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (c *Client) Exports(ctx context.Context) ([]DataExportResponse, error) {
+	var res auth.ListDataExportsResponse
+	err := c.do(ctx, &call{method: http.MethodGet, url: c.authUrl, path: []string{"me", "exports"}, auth: true, retry: true}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Exports, nil
+}
+
+// DownloadExport returns zip archive of the export with token of the emailed link, it doesn't need signing in
+func (c *Client) DownloadExport(ctx context.Context, token string) ([]byte, error) {
+	var archive []byte
+	err := c.do(ctx, &call{
+		method: http.MethodGet,
+		url:    c.authUrl,
+		path:   []string{"me", "export", "download"},
+		query:  url.Values{"token": {token}},
+		retry:  true,
+	}, &archive)
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// VerifyEmail verifies email with token of verification email. Signed in client refreshes its tokens,
+// so the access token says email is verified
+func (c *Client) VerifyEmail(ctx context.Context, token string) error {
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"verify-email"},
+		body:   &auth.VerifyEmailRequest{Token: token},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if t := c.Tokens(); t != nil {
+		_, err = c.refresh(ctx, t.AccessToken)
+	}
+	return err
+}
+
+func (c *Client) ResendVerification(ctx context.Context) error {
+	return c.do(ctx, &call{method: http.MethodPost, url: c.authUrl, path: []string{"verify-email", "resend"}, auth: true}, nil)
+}
+
+// ForgotPassword asks for password reset email, it succeeds even if the email doesn't belong to an account
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	return c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"password", "forgot"},
+		body:   &auth.ForgotPasswordRequest{Email: email},
+		retry:  true,
+	}, nil)
+}
+
+// ResetPassword sets a new password with token of password reset email, the account has to sign in again
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	return c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"password", "reset"},
+		body:   &auth.ResetPasswordRequest{Token: token, Password: password},
+	}, nil)
+}
+
+// EnrollTwoFactor creates two-factor secret, it has to be confirmed with ConfirmTwoFactor
+func (c *Client) EnrollTwoFactor(ctx context.Context) (*EnrollTwoFactorResponse, error) {
+	var res EnrollTwoFactorResponse
+	err := c.do(ctx, &call{method: http.MethodPost, url: c.authUrl, path: []string{"2fa", "enroll"}, auth: true}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) ConfirmTwoFactor(ctx context.Context, code string) error {
+	return c.twoFactor(ctx, "confirm", code, nil)
+}
+
+func (c *Client) DisableTwoFactor(ctx context.Context, code string) error {
+	return c.twoFactor(ctx, "disable", code, nil)
+}
+
+// StepUp replaces access token of the client with one proving two-factor check, payouts require it.
+// Refresh token stays the same, tokens issued by refresh don't carry the check
+func (c *Client) StepUp(ctx context.Context, code string) error {
+	var res auth.StepUpResponse
+	if err := c.twoFactor(ctx, "step-up", code, &res); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.tokens == nil {
+		c.mu.Unlock()
+		return ErrNotSignedIn
+	}
+	t := *c.tokens
+	t.AccessToken, t.ExpiresIn = res.AccessToken, res.ExpiresIn
+	c.tokens, c.expiresAt = &t, time.Now().Add(time.Duration(t.ExpiresIn)*time.Second)
+	c.mu.Unlock()
+
+	if c.onTokens != nil {
+		c.onTokens(&t)
+	}
+	return nil
+}
+
+func (c *Client) twoFactor(ctx context.Context, action, code string, out any) error {
+	return c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"2fa", action},
+		body:   &auth.TwoFactorCodeRequest{Code: code},
+		auth:   true,
+	}, out)
+}
+
+func (c *Client) OAuthProviders(ctx context.Context) ([]string, error) {
+	var res auth.OAuthProvidersResponse
+	err := c.do(ctx, &call{method: http.MethodGet, url: c.authUrl, path: []string{"oauth", "providers"}, retry: true}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Providers, nil
+}
+
+// StartOAuth returns url of provider sign in page, the browser comes back with code and state for FinishOAuth
+func (c *Client) StartOAuth(ctx context.Context, provider string) (string, error) {
+	var res auth.OAuthStartResponse
+	err := c.do(ctx, &call{method: http.MethodPost, url: c.authUrl, path: []string{"oauth", provider, "start"}}, &res)
+	if err != nil {
+		return "", err
+	}
+	return res.AuthorizationUrl, nil
+}
+
+// FinishOAuth signs the client in with code and state given by the provider, accounts with two-factor
+// authentication get *ChallengeError like with SignIn
+func (c *Client) FinishOAuth(ctx context.Context, provider, code, state string) (*TokenResponse, error) {
+	return c.signIn(ctx, []string{"oauth", provider, "callback"}, &auth.OAuthCallbackRequest{Code: code, State: state})
+}
+
+func (c *Client) Identities(ctx context.Context) ([]IdentityResponse, error) {
+	var res auth.ListIdentitiesResponse
+	err := c.do(ctx, &call{method: http.MethodGet, url: c.authUrl, path: []string{"identities"}, auth: true, retry: true}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Identities, nil
+}
+
+// StartLinkIdentity returns url of provider sign in page, the browser comes back with code and state for LinkIdentity
+func (c *Client) StartLinkIdentity(ctx context.Context, provider string) (string, error) {
+	var res auth.OAuthStartResponse
+	err := c.do(ctx, &call{method: http.MethodPost, url: c.authUrl, path: []string{"identities", provider, "start"}, auth: true}, &res)
+	if err != nil {
+		return "", err
+	}
+	return res.AuthorizationUrl, nil
+}
+
+func (c *Client) LinkIdentity(ctx context.Context, provider, code, state string) (*IdentityResponse, error) {
+	var res IdentityResponse
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"identities", provider, "callback"},
+		body:   &auth.OAuthCallbackRequest{Code: code, State: state},
+		auth:   true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) UnlinkIdentity(ctx context.Context, provider string) error {
+	return c.do(ctx, &call{method: http.MethodDelete, url: c.authUrl, path: []string{"identities", provider}, auth: true}, nil)
+}
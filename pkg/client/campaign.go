@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/robloxxa/DistrictFunding/internal/campaign"
+)
+
+type (
+	Campaign                    = campaign.GetCampaignResponse
+	CampaignStatus              = campaign.CampaignStatus
+	CampaignSort                = campaign.CampaignSort
+	CampaignFilter              = campaign.CampaignFilter
+	CreateCampaignRequest       = campaign.CreateCampaignRequest
+	UpdateCampaignRequest       = campaign.UpdateCampaignRequest
+	ListCampaignsResponse       = campaign.ListCampaignsResponse
+	CampaignHistoryResponse     = campaign.GetCampaignHistoryResponse
+	CampaignRevisionResponse    = campaign.GetCampaignRevisionResponse
+	ChangeCampaignStatusRequest = campaign.ChangeCampaignStatusRequest
+)
+
+// ListCampaignsOptions are filters and pagination of campaign listing, zero values use service defaults
+type ListCampaignsOptions struct {
+	CampaignFilter
+	Sort  CampaignSort
+	Limit int
+	// Cursor is NextCursor of the previous page
+	Cursor string
+}
+
+// PageOptions are pagination of campaign history, zero values use service defaults
+type PageOptions struct {
+	Limit  int
+	Cursor string
+}
+
+func (c *Client) CreateCampaign(ctx context.Context, req *CreateCampaignRequest) (*Campaign, error) {
+	var res Campaign
+	err := c.do(ctx, &call{method: http.MethodPost, url: c.campaignUrl, body: req, auth: true}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) GetCampaign(ctx context.Context, id int) (*Campaign, error) {
+	var res Campaign
+	err := c.do(ctx, &call{method: http.MethodGet, url: c.campaignUrl, path: []string{strconv.Itoa(id)}, optionalAuth: true, retry: true}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UpdateCampaign changes fields of the request that are not nil. It's not retried,
+// repeated update would add one more revision to campaign history
+func (c *Client) UpdateCampaign(ctx context.Context, id int, req *UpdateCampaignRequest) error {
+	return c.do(ctx, &call{
+		method: http.MethodPut,
+		url:    c.campaignUrl,
+		path:   []string{strconv.Itoa(id)},
+		body:   req,
+		auth:   true,
+	}, nil)
+}
+
+// ArchiveCampaign closes campaign, its donations are refunded. It's not retried,
+// repeated archive of already archived campaign fails
+func (c *Client) ArchiveCampaign(ctx context.Context, id int) error {
+	return c.do(ctx, &call{
+		method: http.MethodDelete,
+		url:    c.campaignUrl,
+		path:   []string{strconv.Itoa(id)},
+		auth:   true,
+	}, nil)
+}
+
+// ChangeCampaignStatus publishes draft campaign or closes it
+func (c *Client) ChangeCampaignStatus(ctx context.Context, id int, req *ChangeCampaignStatusRequest) (*Campaign, error) {
+	var res Campaign
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.campaignUrl,
+		path:   []string{strconv.Itoa(id), "status"},
+		body:   req,
+		auth:   true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) ListCampaigns(ctx context.Context, opts *ListCampaignsOptions) (*ListCampaignsResponse, error) {
+	q := url.Values{}
+	if opts != nil {
+		opts.CampaignFilter.Encode(q)
+		if opts.Sort != "" {
+			q.Set("sort", string(opts.Sort))
+		}
+		setPage(q, opts.Limit, opts.Cursor)
+	}
+
+	var res ListCampaignsResponse
+	err := c.do(ctx, &call{method: http.MethodGet, url: c.campaignUrl, query: q, optionalAuth: true, retry: true}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) CampaignHistory(ctx context.Context, id int, opts *PageOptions) (*CampaignHistoryResponse, error) {
+	q := url.Values{}
+	if opts != nil {
+		setPage(q, opts.Limit, opts.Cursor)
+	}
+
+	var res CampaignHistoryResponse
+	err := c.do(ctx, &call{
+		method:       http.MethodGet,
+		url:          c.campaignUrl,
+		path:         []string{strconv.Itoa(id), "history"},
+		query:        q,
+		optionalAuth: true,
+		retry:        true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// CampaignRevision returns campaign as it was right after the revision, revision 0 is the original campaign
+func (c *Client) CampaignRevision(ctx context.Context, id int, revision int) (*CampaignRevisionResponse, error) {
+	var res CampaignRevisionResponse
+	err := c.do(ctx, &call{
+		method:       http.MethodGet,
+		url:          c.campaignUrl,
+		path:         []string{strconv.Itoa(id), "history", strconv.Itoa(revision)},
+		optionalAuth: true,
+		retry:        true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func setPage(q url.Values, limit int, cursor string) {
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+}
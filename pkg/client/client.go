@@ -0,0 +1,324 @@
+// Package client is a Go client of auth, campaign and payment services. Requests and responses are
+// the structs used by the services themselves, so the client can't drift from them
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+const (
+	defaultRetries = 3
+	retryBackoff   = 200 * time.Millisecond
+	// refreshBefore is how long before expiration access token is refreshed
+	refreshBefore = 30 * time.Second
+)
+
+// Problem is the error returned for every unsuccessful response, Code is empty
+// when service didn't respond with problem details
+type Problem = response.Problem
+
+var (
+	ErrNotSignedIn = errors.New("client is not signed in")
+)
+
+// Client calls the services on behalf of a single user, it's safe for concurrent use
+type Client struct {
+	authUrl     string
+	campaignUrl string
+	paymentUrl  string
+	c           *http.Client
+	retries     int
+	onTokens    func(*TokenResponse)
+
+	mu        sync.Mutex
+	tokens    *TokenResponse
+	expiresAt time.Time
+}
+
+func New(authUrl, campaignUrl, paymentUrl string) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		authUrl:     authUrl,
+		campaignUrl: campaignUrl,
+		paymentUrl:  paymentUrl,
+		// Jar keeps state cookie of OIDC sign in between StartOAuth and FinishOAuth
+		c:       &http.Client{Timeout: 10 * time.Second, Jar: jar},
+		retries: defaultRetries,
+	}
+}
+
+// WithHTTPClient replaces http client of the client, it needs cookie jar for StartOAuth and FinishOAuth
+func (c *Client) WithHTTPClient(hc *http.Client) *Client {
+	c.c = hc
+	return c
+}
+
+// WithRetries sets how many times requests that are safe to repeat are retried after network errors
+// and 429, 502, 503 and 504 responses
+func (c *Client) WithRetries(n int) *Client {
+	c.retries = n
+	return c
+}
+
+// WithTokens signs the client in with tokens issued before, e.g. restored from storage
+func (c *Client) WithTokens(t *TokenResponse) *Client {
+	c.setTokens(t)
+	return c
+}
+
+// OnTokens sets fn called with new tokens after sign in and every refresh, so they can be stored.
+// Refresh token can be used once, so the stored one has to be replaced
+func (c *Client) OnTokens(fn func(*TokenResponse)) *Client {
+	c.onTokens = fn
+	return c
+}
+
+// Tokens returns current tokens, nil if client isn't signed in
+func (c *Client) Tokens() *TokenResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tokens == nil {
+		return nil
+	}
+	t := *c.tokens
+	return &t
+}
+
+// ErrorCode returns code of the problem in err chain, empty if there is none
+func ErrorCode(err error) string {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p.Code
+	}
+	return ""
+}
+
+func (c *Client) setTokens(t *TokenResponse) {
+	c.mu.Lock()
+	c.tokens = t
+	if t != nil {
+		c.expiresAt = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+	c.mu.Unlock()
+
+	if t != nil && c.onTokens != nil {
+		c.onTokens(t)
+	}
+}
+
+// accessToken returns access token refreshing it if it's about to expire
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if c.tokens == nil {
+		c.mu.Unlock()
+		return "", ErrNotSignedIn
+	}
+	token, expiresAt := c.tokens.AccessToken, c.expiresAt
+	c.mu.Unlock()
+
+	if time.Until(expiresAt) > refreshBefore {
+		return token, nil
+	}
+	return c.refresh(ctx, token)
+}
+
+// refresh exchanges refresh token for new tokens unless access token was already changed
+// by a concurrent refresh. Refresh token can be used once, so refreshes are never run in parallel
+func (c *Client) refresh(ctx context.Context, stale string) (string, error) {
+	c.mu.Lock()
+	t, refreshed, err := c.refreshLocked(ctx, stale)
+	c.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	if refreshed && c.onTokens != nil {
+		c.onTokens(t)
+	}
+	return t.AccessToken, nil
+}
+
+func (c *Client) refreshLocked(ctx context.Context, stale string) (*TokenResponse, bool, error) {
+	if c.tokens == nil {
+		return nil, false, ErrNotSignedIn
+	}
+	if c.tokens.AccessToken != stale {
+		return c.tokens, false, nil
+	}
+
+	var t TokenResponse
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.authUrl,
+		path:   []string{"refresh"},
+		body:   &RefreshRequest{RefreshToken: c.tokens.RefreshToken},
+	}, &t)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to refresh tokens: %w", err)
+	}
+
+	c.tokens, c.expiresAt = &t, time.Now().Add(time.Duration(t.ExpiresIn)*time.Second)
+	return &t, true, nil
+}
+
+type call struct {
+	method string
+	url    string
+	path   []string
+	query  url.Values
+	header http.Header
+	body   any
+	// auth requests are sent with access token, they are repeated once with refreshed token on 401
+	auth bool
+	// optionalAuth requests are sent with access token only if client is signed in, e.g. to see own drafts
+	optionalAuth bool
+	// retry is set for requests that are safe to repeat
+	retry bool
+}
+
+// do sends the call and decodes response body into out, unsuccessful responses are returned as *Problem
+func (c *Client) do(ctx context.Context, cl *call, out any) error {
+	u, err := url.JoinPath(cl.url, cl.path...)
+	if err != nil {
+		return err
+	}
+	if len(cl.query) > 0 {
+		u += "?" + cl.query.Encode()
+	}
+
+	var body []byte
+	if cl.body != nil {
+		if body, err = json.Marshal(cl.body); err != nil {
+			return err
+		}
+	}
+
+	auth := cl.auth || cl.optionalAuth && c.Tokens() != nil
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, cl.method, u, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for k, v := range cl.header {
+			req.Header[k] = v
+		}
+		if cl.body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		var token string
+		if auth {
+			if token, err = c.accessToken(ctx); err != nil {
+				return err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		res, err := c.c.Do(req)
+		if err != nil {
+			if cl.retry && attempt < c.retries && ctx.Err() == nil {
+				if err := sleep(ctx, attempt); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		switch {
+		case res.StatusCode == http.StatusUnauthorized && auth && !refreshed:
+			// Access token may be revoked or expired earlier than client expected
+			res.Body.Close()
+			if _, err := c.refresh(ctx, token); err != nil {
+				return err
+			}
+			refreshed = true
+			attempt--
+			continue
+		case retryable(res.StatusCode) && cl.retry && attempt < c.retries:
+			res.Body.Close()
+			if err := sleep(ctx, attempt); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return decode(res, out)
+	}
+}
+
+func decode(res *http.Response, out any) error {
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return decodeProblem(res)
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	// Files like data export archives are read as is
+	if b, ok := out.(*[]byte); ok {
+		var err error
+		*b, err = io.ReadAll(res.Body)
+		return err
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func decodeProblem(res *http.Response) error {
+	b, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType == response.ContentTypeProblem {
+		var p Problem
+		if err := json.Unmarshal(b, &p); err == nil {
+			return &p
+		}
+	}
+
+	return response.NewProblem(res.StatusCode, "", strings.TrimSpace(string(b)))
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// sleep waits before the next attempt, doubling the delay every attempt
+func sleep(ctx context.Context, attempt int) error {
+	t := time.NewTimer(retryBackoff << attempt)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"github.com/robloxxa/DistrictFunding/internal/payment"
+)
+
+type (
+	DonateRequest  = payment.DonateRequest
+	DonateResponse = payment.DonateResponse
+)
+
+// Donate creates payment of the donation, user has to confirm it at ConfirmationUrl.
+// Request is retried with the same idempotenceKey, so a donation is never created twice.
+// Empty key is generated, pass the same key to repeat donation request after a failure
+func (c *Client) Donate(ctx context.Context, campaignId int, req *DonateRequest, idempotenceKey string) (*DonateResponse, error) {
+	if idempotenceKey == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		idempotenceKey = hex.EncodeToString(b)
+	}
+
+	var res DonateResponse
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.paymentUrl,
+		path:   []string{"campaign", strconv.Itoa(campaignId), "donate"},
+		header: http.Header{"Idempotence-Key": {idempotenceKey}},
+		body:   req,
+		auth:   true,
+		retry:  true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type (
+	PayoutRequest       = payment.PayoutRequest
+	PayoutResponse      = payment.PayoutResponse
+	PayoutDestination   = payment.PayoutDestination
+	ListPayoutsResponse = payment.ListPayoutsResponse
+)
+
+// PayoutCampaign pays donations of the campaign out to its creator, the client needs token of StepUp.
+// It's not retried, payment service retries payout that failed to reach the provider on the next call itself
+func (c *Client) PayoutCampaign(ctx context.Context, campaignId int, req *PayoutRequest) (*PayoutResponse, error) {
+	var res PayoutResponse
+	err := c.do(ctx, &call{
+		method: http.MethodPost,
+		url:    c.paymentUrl,
+		path:   []string{"campaign", strconv.Itoa(campaignId), "payout"},
+		body:   req,
+		auth:   true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) ListCampaignPayouts(ctx context.Context, campaignId int) (*ListPayoutsResponse, error) {
+	var res ListPayoutsResponse
+	err := c.do(ctx, &call{
+		method: http.MethodGet,
+		url:    c.paymentUrl,
+		path:   []string{"campaign", strconv.Itoa(campaignId), "payouts"},
+		auth:   true,
+		retry:  true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
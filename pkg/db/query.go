@@ -2,25 +2,39 @@ package db
 
 import (
 	"context"
+
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
-func QueryOneRowToAddrStruct[T any](ctx context.Context, db *pgxpool.Pool, query string, arguments ...any) (*T, error) {
-	rows, err := db.Query(ctx, query, arguments...)
+// Querier is implemented by both *pgxpool.Pool and pgx.Tx
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// QueryOne collects the only row of the query into T, returns pgx.ErrNoRows if there are none
+func QueryOne[T any](ctx context.Context, q Querier, query string, arguments ...any) (*T, error) {
+	rows, err := q.Query(ctx, query, arguments...)
 	if err != nil {
 		return nil, err
 	}
 
-	t, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[T])
+	return pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[T])
+}
+
+// QueryAll collects every row of the query into T
+func QueryAll[T any](ctx context.Context, q Querier, query string, arguments ...any) ([]T, error) {
+	rows, err := q.Query(ctx, query, arguments...)
 	if err != nil {
 		return nil, err
 	}
 
-	return t, nil
+	return pgx.CollectRows(rows, pgx.RowToStructByName[T])
 }
 
-func Exec(ctx context.Context, db *pgxpool.Pool, query string, arguments ...any) error {
-	_, err := db.Exec(ctx, query, arguments)
+func Exec(ctx context.Context, q Querier, query string, arguments ...any) error {
+	_, err := q.Exec(ctx, query, arguments...)
 	return err
 }
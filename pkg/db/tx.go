@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type txKey struct{}
+
+// WithTx runs fn in a transaction carried by the ctx passed to it, so every model called with that ctx
+// takes part in the transaction. Transaction is committed if fn returns nil and rolled back otherwise.
+// WithTx inside another WithTx joins the outer transaction
+func WithTx(ctx context.Context, pool *pgxpool.Pool, fn func(ctx context.Context) error) error {
+	if _, ok := TxFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// TxFromContext returns transaction started by WithTx
+func TxFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+// Conn returns transaction of ctx if there is one, pool otherwise
+func Conn(ctx context.Context, pool *pgxpool.Pool) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return pool
+}
@@ -0,0 +1,35 @@
+// Package internalapi protects service-to-service endpoints with a shared token
+package internalapi
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+// TokenHeader is the header carrying internal api token
+const TokenHeader = "X-Internal-Token"
+
+var (
+	ErrInvalidToken = response.NewProblem(http.StatusUnauthorized, "invalid_internal_token", "invalid internal api token")
+)
+
+// RequireToken rejects requests without valid internal token, every request is rejected if token is empty
+func RequireToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got := r.Header.Get(TokenHeader)
+			if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				response.WriteProblem(w, r, ErrInvalidToken)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SetToken adds internal token to the outgoing request
+func SetToken(r *http.Request, token string) {
+	r.Header.Set(TokenHeader, token)
+}
@@ -0,0 +1,45 @@
+package jwtauth
+
+import (
+	"net/http"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+// EmailVerifiedClaim is the access token claim set to true once account email is verified
+const EmailVerifiedClaim = "email_verified"
+
+const CodeEmailNotVerified = "email_not_verified"
+
+var (
+	ErrEmailNotVerified = response.NewProblem(http.StatusForbidden, CodeEmailNotVerified,
+		"email is not verified, refresh tokens after verifying it")
+)
+
+// EmailVerified reports whether the token says account email is verified
+func EmailVerified(t jwt.Token) bool {
+	v, ok := t.Get(EmailVerifiedClaim)
+	if !ok {
+		return false
+	}
+	verified, ok := v.(bool)
+	return ok && verified
+}
+
+// RequireVerifiedEmail rejects requests of accounts without verified email, it must follow Authenticator
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := FromContext(r.Context())
+		if err != nil {
+			response.Error(w, r, http.StatusUnauthorized, err)
+			return
+		}
+
+		if !EmailVerified(token) {
+			response.WriteProblem(w, r, ErrEmailNotVerified)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -18,22 +18,40 @@ var (
 
 var (
 	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenRevoked  = errors.New("token is revoked")
 )
 
 type JWTAuth struct {
-	jwtParser jwt.SignEncryptParseOption
+	keys    KeySource
+	revoked RevocationList
 }
 
+// New creates JWTAuth that signs and verifies tokens with a single key, used mostly for symmetric algorithms like HS256
 func New(alg jwa.SignatureAlgorithm, key interface{}) *JWTAuth {
-	return &JWTAuth{jwt.WithKey(alg, key)}
+	return &JWTAuth{keys: &staticKey{jwt.WithKey(alg, key)}}
+}
+
+// NewWithKeySource creates JWTAuth that signs tokens with the current key of ks and verifies them by kid
+func NewWithKeySource(ks KeySource) *JWTAuth {
+	return &JWTAuth{keys: ks}
+}
+
+// WithRevocationList makes every verified token to be checked against rl by its jti
+func (ja *JWTAuth) WithRevocationList(rl RevocationList) *JWTAuth {
+	ja.revoked = rl
+	return ja
 }
 
 func (ja *JWTAuth) Sign(token jwt.Token) ([]byte, error) {
-	return jwt.Sign(token, ja.jwtParser)
+	opt, err := ja.keys.SignOption()
+	if err != nil {
+		return nil, err
+	}
+	return jwt.Sign(token, opt)
 }
 
 func (ja *JWTAuth) Parse(token string) (jwt.Token, error) {
-	return jwt.Parse([]byte(token), ja.jwtParser)
+	return ja.keys.Parse([]byte(token), jwt.WithVerify(false))
 }
 
 func (ja *JWTAuth) Verify(requestParser func(r *http.Request) string) func(http.Handler) http.Handler {
@@ -56,8 +74,11 @@ func Verifier(ja *JWTAuth) func(http.Handler) http.Handler {
 func Authenticator(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := FromContext(r.Context())
-		if err != nil || token == nil {
-			response.Error(w, http.StatusUnauthorized, err)
+		if err == nil && token == nil {
+			err = ErrTokenNotFound
+		}
+		if err != nil {
+			response.Error(w, r, http.StatusUnauthorized, err)
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -65,7 +86,7 @@ func Authenticator(next http.Handler) http.Handler {
 }
 
 func VerifyToken(ja *JWTAuth, token string) (jwt.Token, error) {
-	return jwt.Parse([]byte(token), ja.jwtParser, jwt.WithVerify(true))
+	return ja.keys.Parse([]byte(token), jwt.WithVerify(true))
 }
 
 func ParseTokenFromRequest(ja *JWTAuth, r *http.Request, tokenParser func(r *http.Request) string) (jwt.Token, error) {
@@ -74,7 +95,31 @@ func ParseTokenFromRequest(ja *JWTAuth, r *http.Request, tokenParser func(r *htt
 		return nil, ErrTokenNotFound
 	}
 
-	return VerifyToken(ja, token)
+	t, err := VerifyToken(ja, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkRevoked(r.Context(), ja, t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func checkRevoked(ctx context.Context, ja *JWTAuth, t jwt.Token) error {
+	if ja.revoked == nil || t.JwtID() == "" {
+		return nil
+	}
+
+	revoked, err := ja.revoked.IsRevoked(ctx, t.JwtID())
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
 }
 
 func NewContext(ctx context.Context, t jwt.Token, err error) context.Context {
@@ -0,0 +1,136 @@
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+var (
+	ErrVerifyOnly = errors.New("key source can't sign tokens")
+)
+
+// KeySource provides keys for signing and verifying tokens
+type KeySource interface {
+	// SignOption returns option with the current signing key
+	SignOption() (jwt.SignOption, error)
+	// Parse parses token verifying it with known keys
+	Parse(token []byte, options ...jwt.ParseOption) (jwt.Token, error)
+}
+
+// staticKey is a KeySource with a single key, kept for symmetric secrets shared between services
+type staticKey struct {
+	opt jwt.SignEncryptParseOption
+}
+
+func (s *staticKey) SignOption() (jwt.SignOption, error) {
+	return s.opt, nil
+}
+
+func (s *staticKey) Parse(token []byte, options ...jwt.ParseOption) (jwt.Token, error) {
+	return jwt.Parse(token, append(options, s.opt)...)
+}
+
+// KeySet verifies tokens by kid against a set of public keys and signs with a private key if it's provided
+type KeySet struct {
+	mu      sync.RWMutex
+	signKey jwk.Key
+	set     jwk.Set
+}
+
+func NewKeySet(signKey jwk.Key, set jwk.Set) *KeySet {
+	return &KeySet{signKey: signKey, set: set}
+}
+
+// Update replaces keys, used by key rotation
+func (ks *KeySet) Update(signKey jwk.Key, set jwk.Set) {
+	ks.mu.Lock()
+	ks.signKey, ks.set = signKey, set
+	ks.mu.Unlock()
+}
+
+// PublicSet returns public parts of the verification keys, suitable for JWKS endpoint
+func (ks *KeySet) PublicSet() (jwk.Set, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return jwk.PublicSetOf(ks.set)
+}
+
+func (ks *KeySet) SignOption() (jwt.SignOption, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.signKey == nil {
+		return nil, ErrVerifyOnly
+	}
+	return jwt.WithKey(ks.signKey.Algorithm(), ks.signKey), nil
+}
+
+func (ks *KeySet) Parse(token []byte, options ...jwt.ParseOption) (jwt.Token, error) {
+	ks.mu.RLock()
+	set := ks.set
+	ks.mu.RUnlock()
+	return jwt.Parse(token, append(options, jwt.WithKeySet(set))...)
+}
+
+// RemoteKeySet verifies tokens with keys fetched from JWKS url, keys are cached and refreshed in background.
+// Token with unknown kid forces refresh, since it's most likely signed with a just rotated key
+type RemoteKeySet struct {
+	url   string
+	cache *jwk.Cache
+
+	// minForceRefresh limits how often unknown kids can trigger fetching
+	minForceRefresh time.Duration
+	mu              sync.Mutex
+	forcedAt        time.Time
+}
+
+// NewRemoteKeySet fetches keys of the url, options like jwk.WithHTTPClient change how they are fetched
+func NewRemoteKeySet(ctx context.Context, url string, refreshInterval time.Duration, options ...jwk.RegisterOption) (*RemoteKeySet, error) {
+	cache := jwk.NewCache(ctx)
+	if err := cache.Register(url, append(options, jwk.WithMinRefreshInterval(refreshInterval))...); err != nil {
+		return nil, err
+	}
+
+	// Fetch keys eagerly to catch misconfiguration at startup
+	if _, err := cache.Refresh(ctx, url); err != nil {
+		return nil, err
+	}
+
+	return &RemoteKeySet{url: url, cache: cache, minForceRefresh: 10 * time.Second}, nil
+}
+
+func (rs *RemoteKeySet) SignOption() (jwt.SignOption, error) {
+	return nil, ErrVerifyOnly
+}
+
+func (rs *RemoteKeySet) Parse(token []byte, options ...jwt.ParseOption) (jwt.Token, error) {
+	ctx := context.Background()
+	set, err := rs.cache.Get(ctx, rs.url)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := jwt.Parse(token, append(options, jwt.WithKeySet(set))...)
+	if err == nil || jwt.IsValidationError(err) || !rs.tryForceRefresh() {
+		return t, err
+	}
+
+	if set, err = rs.cache.Refresh(ctx, rs.url); err != nil {
+		return nil, err
+	}
+	return jwt.Parse(token, append(options, jwt.WithKeySet(set))...)
+}
+
+func (rs *RemoteKeySet) tryForceRefresh() bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if time.Since(rs.forcedAt) < rs.minForceRefresh {
+		return false
+	}
+	rs.forcedAt = time.Now()
+	return true
+}
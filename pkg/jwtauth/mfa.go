@@ -0,0 +1,57 @@
+package jwtauth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+// MFAClaim is the access token claim with unix time of the last second factor check
+const MFAClaim = "mfa_at"
+
+const CodeStepUpRequired = "step_up_required"
+
+var (
+	ErrStepUpRequired = response.NewProblem(http.StatusForbidden, CodeStepUpRequired,
+		"confirm the action with two-factor code, two-factor authentication has to be enabled")
+)
+
+// MFAAt returns time of the last second factor check of the token, false if there was none
+func MFAAt(t jwt.Token) (time.Time, bool) {
+	v, ok := t.Get(MFAClaim)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	// Claims parsed from json are float64, claims of tokens built in process keep their type
+	switch n := v.(type) {
+	case float64:
+		return time.Unix(int64(n), 0), true
+	case int64:
+		return time.Unix(n, 0), true
+	case int:
+		return time.Unix(int64(n), 0), true
+	}
+	return time.Time{}, false
+}
+
+// RequireStepUp rejects requests whose token second factor is older than maxAge, it must follow Authenticator
+func RequireStepUp(maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := FromContext(r.Context())
+			if err != nil {
+				response.Error(w, r, http.StatusUnauthorized, err)
+				return
+			}
+
+			if at, ok := MFAAt(token); !ok || time.Since(at) > maxAge {
+				response.WriteProblem(w, r, ErrStepUpRequired)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
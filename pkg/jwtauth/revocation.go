@@ -0,0 +1,135 @@
+package jwtauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/internalapi"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrRevocationUnavailable = response.NewProblem(http.StatusServiceUnavailable, "revocation_list_unavailable", "unable to check whether token is revoked, try again later")
+)
+
+// RevocationList reports whether a token with the given jti was revoked before its expiration
+type RevocationList interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// RevokedToken is a single entry of the revocation list served by the auth service
+type RevokedToken struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RevokedTokensResponse struct {
+	Revoked []RevokedToken `json:"revoked"`
+}
+
+// HTTPRevocationList fetches the revocation list from the auth service every refreshInterval, so signed out
+// tokens are rejected within refreshInterval. If the auth service is unavailable the last fetched list is used
+type HTTPRevocationList struct {
+	url             string
+	token           string
+	refreshInterval time.Duration
+	c               *http.Client
+	group           singleflight.Group
+
+	mu        sync.RWMutex
+	revoked   map[string]time.Time
+	fetched   bool
+	fetchedAt time.Time
+}
+
+// NewHTTPRevocationList creates revocation list of url, token is internal api token of the auth service
+func NewHTTPRevocationList(url, token string, refreshInterval time.Duration) *HTTPRevocationList {
+	return &HTTPRevocationList{
+		url:             url,
+		token:           token,
+		refreshInterval: refreshInterval,
+		c:               &http.Client{Timeout: 10 * time.Second},
+		revoked:         make(map[string]time.Time),
+	}
+}
+
+func (l *HTTPRevocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	if l.stale() {
+		// Concurrent requests wait for a single fetch
+		l.group.Do("", func() (any, error) {
+			if l.stale() {
+				l.refresh(ctx)
+			}
+			return nil, nil
+		})
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if !l.fetched {
+		return false, ErrRevocationUnavailable
+	}
+	expiresAt, ok := l.revoked[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (l *HTTPRevocationList) stale() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return time.Since(l.fetchedAt) > l.refreshInterval
+}
+
+// refresh replaces the list with the one of the auth service. Failed fetch keeps the last list until
+// the next refresh, so requests don't wait for the auth service while it's down
+func (l *HTTPRevocationList) refresh(ctx context.Context) {
+	revoked, err := l.fetch(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		log.Printf("revocation list: %v", err)
+		if !l.fetched {
+			return
+		}
+	} else {
+		l.revoked = revoked
+		l.fetched = true
+	}
+	l.fetchedAt = time.Now()
+}
+
+func (l *HTTPRevocationList) fetch(ctx context.Context) (map[string]time.Time, error) {
+	// Fetch is shared by waiting requests, so it isn't canceled together with the first of them
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodGet, l.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	internalapi.SetToken(req, l.token)
+
+	res, err := l.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch revocation list: %s", res.Status)
+	}
+
+	var body RevokedTokensResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	revoked := make(map[string]time.Time, len(body.Revoked))
+	for _, t := range body.Revoked {
+		revoked[t.Jti] = t.ExpiresAt
+	}
+	return revoked, nil
+}
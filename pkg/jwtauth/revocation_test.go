@@ -0,0 +1,137 @@
+package jwtauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robloxxa/DistrictFunding/pkg/internalapi"
+)
+
+// authServer serves revocation list like auth service does, it fails while down is set
+type authServer struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	down    atomic.Bool
+	lists   atomic.Int32
+}
+
+func newAuthServer(t *testing.T) (*authServer, string) {
+	a := &authServer{revoked: make(map[string]time.Time)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /revoked", func(w http.ResponseWriter, r *http.Request) {
+		a.lists.Add(1)
+		if !a.ok(w, r) {
+			return
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		res := RevokedTokensResponse{Revoked: []RevokedToken{}}
+		for jti, expiresAt := range a.revoked {
+			res.Revoked = append(res.Revoked, RevokedToken{Jti: jti, ExpiresAt: expiresAt})
+		}
+		json.NewEncoder(w).Encode(&res)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return a, srv.URL + "/revoked"
+}
+
+func (a *authServer) ok(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get(internalapi.TokenHeader) != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	if a.down.Load() {
+		w.WriteHeader(http.StatusBadGateway)
+		return false
+	}
+	return true
+}
+
+func (a *authServer) revoke(jti string) {
+	a.mu.Lock()
+	a.revoked[jti] = time.Now().Add(time.Hour)
+	a.mu.Unlock()
+}
+
+func isRevoked(t *testing.T, l *HTTPRevocationList, jti string, want bool) {
+	t.Helper()
+	got, err := l.IsRevoked(context.Background(), jti)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("%s is revoked: %t, want %t", jti, got, want)
+	}
+}
+
+func TestRevocationListIsFetchedOncePerInterval(t *testing.T) {
+	a, url := newAuthServer(t)
+	l := NewHTTPRevocationList(url, "token", 200*time.Millisecond)
+
+	// Tokens missing from the list don't make requests to the auth service
+	for _, jti := range []string{"a", "b", "c"} {
+		isRevoked(t, l, jti, false)
+	}
+	a.revoke("a")
+	isRevoked(t, l, "a", false)
+	if n := a.lists.Load(); n != 1 {
+		t.Fatalf("list is fetched %d times, want 1", n)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	isRevoked(t, l, "a", true)
+	isRevoked(t, l, "b", false)
+	if n := a.lists.Load(); n != 2 {
+		t.Fatalf("list is fetched %d times, want 2", n)
+	}
+}
+
+func TestRevocationListKeepsLastListWhenAuthIsDown(t *testing.T) {
+	a, url := newAuthServer(t)
+	a.revoke("a")
+	l := NewHTTPRevocationList(url, "token", 0)
+
+	if _, err := l.IsRevoked(context.Background(), "b"); err != nil {
+		t.Fatal(err)
+	}
+	a.down.Store(true)
+	isRevoked(t, l, "a", true)
+	isRevoked(t, l, "b", false)
+}
+
+func TestRevocationListWithoutListIsUnavailable(t *testing.T) {
+	a, url := newAuthServer(t)
+	a.down.Store(true)
+	l := NewHTTPRevocationList(url, "token", time.Hour)
+
+	if _, err := l.IsRevoked(context.Background(), "a"); !errors.Is(err, ErrRevocationUnavailable) {
+		t.Fatalf("got %v, want %v", err, ErrRevocationUnavailable)
+	}
+}
+
+func TestRevocationListIsFetchedOnce(t *testing.T) {
+	a, url := newAuthServer(t)
+	l := NewHTTPRevocationList(url, "token", time.Hour)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.IsRevoked(context.Background(), "a")
+		}()
+	}
+	wg.Wait()
+
+	if n := a.lists.Load(); n != 1 {
+		t.Fatalf("list is fetched %d times, want 1", n)
+	}
+}
@@ -0,0 +1,97 @@
+package jwtauth
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+// RoleClaim is the access token claim carrying account role
+const RoleClaim = "role"
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is an action of staff, handlers check permissions instead of roles,
+// so a role can be given more actions without touching the routes
+type Permission string
+
+const (
+	PermissionArchiveCampaigns Permission = "campaigns:archive"
+	PermissionSuspendAccounts  Permission = "accounts:suspend"
+	PermissionManageRoles      Permission = "accounts:roles"
+	PermissionManageLockouts   Permission = "accounts:lockouts"
+	PermissionReadPayments     Permission = "payments:read"
+	PermissionReadAudit        Permission = "audit:read"
+)
+
+var permissions = map[Role][]Permission{
+	RoleUser:      {},
+	RoleModerator: {PermissionArchiveCampaigns, PermissionSuspendAccounts},
+	RoleAdmin: {
+		PermissionArchiveCampaigns,
+		PermissionSuspendAccounts,
+		PermissionManageRoles,
+		PermissionManageLockouts,
+		PermissionReadPayments,
+		PermissionReadAudit,
+	},
+}
+
+var (
+	ErrPermissionDenied = response.NewProblem(http.StatusForbidden, response.CodeForbidden, "permission denied")
+)
+
+func (r Role) Valid() bool {
+	_, ok := permissions[r]
+	return ok
+}
+
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(permissions[r], p)
+}
+
+// RoleFromToken returns role claim of the token, tokens without the claim belong to users
+func RoleFromToken(t jwt.Token) Role {
+	if v, ok := t.Get(RoleClaim); ok {
+		if s, ok := v.(string); ok && Role(s).Valid() {
+			return Role(s)
+		}
+	}
+	return RoleUser
+}
+
+// RequireRole rejects requests whose token role isn't one of roles, it must follow Authenticator
+func RequireRole(roles ...Role) func(http.Handler) http.Handler {
+	return require(func(r Role) bool { return slices.Contains(roles, r) })
+}
+
+// RequirePermission rejects requests whose token role doesn't have the permission, it must follow Authenticator
+func RequirePermission(p Permission) func(http.Handler) http.Handler {
+	return require(func(r Role) bool { return r.Can(p) })
+}
+
+func require(allowed func(Role) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := FromContext(r.Context())
+			if err != nil {
+				response.Error(w, r, http.StatusUnauthorized, err)
+				return
+			}
+
+			if !allowed(RoleFromToken(token)) {
+				response.WriteProblem(w, r, ErrPermissionDenied)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
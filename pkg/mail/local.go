@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// File writes every message into a separate .eml file of the directory instead of sending it
+type File struct {
+	dir  string
+	from string
+}
+
+func NewFile(dir, from string) *File {
+	return &File{dir: dir, from: from}
+}
+
+func (f *File) Send(_ context.Context, m *Message) error {
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), filepath.Base(headerValue.Replace(m.To)))
+	return os.WriteFile(filepath.Join(f.dir, name), m.Format(f.from, now), 0o644)
+}
+
+// Memory keeps sent messages, it's safe for concurrent use
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Send(_ context.Context, msg *Message) error {
+	m.mu.Lock()
+	m.messages = append(m.messages, *msg)
+	m.mu.Unlock()
+	return nil
+}
+
+// Messages returns sent messages, oldest first
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the last message sent to the address, nil if there is none
+func (m *Memory) Last(to string) *Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			msg := m.messages[i]
+			return &msg
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Package mail sends plain text emails, Mailer is implemented by SMTP for production
+// and by File and Memory for development and tests
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	// Body is plain text
+	Body string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// headerValue removes line breaks, so values can't add headers of their own
+var headerValue = strings.NewReplacer("\r", "", "\n", "")
+
+// Format returns the message in RFC 5322 format with utf-8 quoted-printable body
+func (m *Message) Format(from string, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue.Replace(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue.Replace(m.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(&b)
+	w.Write([]byte(strings.ReplaceAll(m.Body, "\n", "\r\n")))
+	w.Close()
+	return b.Bytes()
+}
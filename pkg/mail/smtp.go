@@ -0,0 +1,87 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTP sends messages through SMTP server, connection is upgraded with STARTTLS when server supports it
+type SMTP struct {
+	addr     string
+	from     string
+	username string
+	password string
+}
+
+// NewSMTP creates mailer sending from the address through server at addr (host:port),
+// from may have a display name, e.g. "District Funding <no-reply@example.com>"
+func NewSMTP(addr, from string) *SMTP {
+	return &SMTP{addr: addr, from: from}
+}
+
+// WithAuth sets credentials for PLAIN authentication, they are sent only over TLS
+func (s *SMTP) WithAuth(username, password string) *SMTP {
+	s.username, s.password = username, password
+	return s
+}
+
+func (s *SMTP) Send(ctx context.Context, m *Message) error {
+	host, _, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		// PlainAuth refuses to send credentials without TLS unless server is localhost
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, host)); err != nil {
+			return err
+		}
+	}
+
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return err
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(m.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.Format(s.from, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
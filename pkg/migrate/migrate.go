@@ -0,0 +1,275 @@
+// Package migrate applies versioned sql migrations embedded into service binaries.
+//
+// Migration is a pair of files named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// applied migrations are tracked in schema_migrations table of the service database.
+// Every migration runs in its own transaction, concurrent migrators are serialized by advisory lock.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockId is the advisory lock key held while migrating, it's arbitrary but the same for every service
+const lockId = 7340210615
+
+var (
+	ErrNoMigration = errors.New("migrate: no such migration version")
+	ErrNothingToDo = errors.New("migrate: no migrations to roll back")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration with the time it was applied, AppliedAt is nil for pending migrations
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load reads migrations from dir of fsys ordered by version, every version must have both up and down files
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid version of %s: %w", e.Name(), err)
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migrate: version %d has different names %s and %s", version, migration.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			migration.Up = string(b)
+		} else {
+			migration.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrate: version %d must have both up and down migrations", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func New(db *pgxpool.Pool, migrations []Migration) *Migrator {
+	return &Migrator{db, migrations}
+}
+
+// Latest returns version of the last known migration, 0 if there are none
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration, returns number of applied migrations
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the last applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := &m.migrations[i]
+			if _, ok := applied[migration.Version]; ok {
+				return rollback(ctx, conn, migration)
+			}
+		}
+		return ErrNothingToDo
+	})
+}
+
+// To migrates database to the version, migrations after it are rolled back and up to it are applied.
+// Version 0 rolls back everything. Returns number of applied and rolled back migrations
+func (m *Migrator) To(ctx context.Context, version int64) (int, error) {
+	if version != 0 && !m.known(version) {
+		return 0, fmt.Errorf("%w: %d", ErrNoMigration, version)
+	}
+
+	var n int
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		// Rollbacks go from the newest migration
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := &m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+				continue
+			}
+			if err := rollback(ctx, conn, migration); err != nil {
+				return err
+			}
+			n++
+		}
+
+		for i := range m.migrations {
+			migration := &m.migrations[i]
+			if _, ok := applied[migration.Version]; ok || migration.Version > version {
+				continue
+			}
+			if err := run(ctx, conn, migration.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migrate: applying %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Status returns every known migration with the time it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			s := Status{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				s.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// locked runs fn holding the advisory lock, so replicas starting at once don't apply the same migration
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockId); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockId)
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	)`); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]time.Time)
+	var (
+		version   int64
+		appliedAt time.Time
+	)
+	_, err = pgx.ForEachRow(rows, []any{&version, &appliedAt}, func() error {
+		applied[version] = appliedAt
+		return nil
+	})
+	return applied, err
+}
+
+func rollback(ctx context.Context, conn *pgxpool.Conn, migration *Migration) error {
+	if err := run(ctx, conn, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+		return fmt.Errorf("migrate: rolling back %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+// run executes migration sql and records it in schema_migrations in one transaction
+func run(ctx context.Context, conn *pgxpool.Conn, sql string, record string, args ...any) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,354 @@
+// Package money provides exact monetary amounts stored in minor units (kopecks, cents) with ISO 4217 currency.
+//
+// In postgres Money is stored as money_amount composite type:
+//
+//	CREATE TYPE money_amount AS (minor BIGINT, currency VARCHAR(3));
+//
+// In json Money is an object with decimal string value, the same way yookassa represents amounts:
+//
+//	{"value": "100.50", "currency": "RUB"}
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+	ErrOverflow         = errors.New("money: amount overflow")
+)
+
+type Currency string
+
+const (
+	RUB Currency = "RUB"
+	USD Currency = "USD"
+	EUR Currency = "EUR"
+)
+
+// exponents is the number of minor unit digits of supported currencies
+var exponents = map[Currency]int{
+	RUB:   2,
+	USD:   2,
+	EUR:   2,
+	"BYN": 2,
+	"KZT": 2,
+	"UAH": 2,
+	"UZS": 2,
+	"CNY": 2,
+	"JPY": 0,
+}
+
+func ParseCurrency(s string) (Currency, error) {
+	c := Currency(strings.ToUpper(s))
+	if _, ok := exponents[c]; !ok {
+		return "", fmt.Errorf("money: unsupported currency: %s", s)
+	}
+	return c, nil
+}
+
+// Exponent returns the number of digits after decimal point, 0 for unknown currencies
+func (c Currency) Exponent() int {
+	return exponents[c]
+}
+
+// Money is an amount in minor units of the currency. Zero value is zero amount without currency,
+// it can be added to an amount of any currency
+type Money struct {
+	minor    int64
+	currency Currency
+}
+
+func New(minor int64, currency Currency) Money {
+	return Money{minor, currency}
+}
+
+// Parse parses decimal string like "100.50" into amount of currency, more fractional digits than
+// the currency has are rejected instead of being rounded
+func Parse(value string, currency Currency) (Money, error) {
+	if _, ok := exponents[currency]; !ok {
+		return Money{}, fmt.Errorf("money: unsupported currency: %s", currency)
+	}
+
+	s := value
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	whole, frac, hasDot := strings.Cut(s, ".")
+	exp := currency.Exponent()
+	if whole == "" || (hasDot && frac == "") || len(frac) > exp || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("money: invalid amount %q for %s", value, currency)
+	}
+
+	minor, err := strconv.ParseInt(whole+frac+strings.Repeat("0", exp-len(frac)), 10, 64)
+	if err != nil {
+		return Money{}, ErrOverflow
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return Money{minor, currency}, nil
+}
+
+// isZero reports whether decimal string like "0" or "0.00" is zero
+func isZero(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	whole, frac, _ := strings.Cut(s, ".")
+	return whole != "" && strings.Trim(whole, "0") == "" && strings.Trim(frac, "0") == ""
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) Minor() int64 {
+	return m.minor
+}
+
+func (m Money) Currency() Currency {
+	return m.currency
+}
+
+func (m Money) IsZero() bool {
+	return m.minor == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.minor > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.minor < 0
+}
+
+// Decimal formats amount as decimal string with all minor digits, like "100.50"
+func (m Money) Decimal() string {
+	exp := m.currency.Exponent()
+	abs := m.minor
+	sign := ""
+	if abs < 0 {
+		sign = "-"
+	}
+
+	digits := strconv.FormatUint(absUint(abs), 10)
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+func absUint(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + string(m.currency)
+}
+
+// sameCurrency returns the common currency, zero value Money adopts currency of the other operand
+func (m Money) sameCurrency(o Money) (Currency, error) {
+	switch {
+	case m.currency == o.currency:
+		return m.currency, nil
+	case m == Money{}:
+		return o.currency, nil
+	case o == Money{}:
+		return m.currency, nil
+	default:
+		return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency, o.currency)
+	}
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	c, err := m.sameCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.minor + o.minor
+	if (o.minor > 0 && sum < m.minor) || (o.minor < 0 && sum > m.minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{sum, c}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if o.minor == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(o.Neg())
+}
+
+func (m Money) Neg() Money {
+	return Money{-m.minor, m.currency}
+}
+
+// Cmp returns -1, 0 or 1 if m is less, equal or greater than o
+func (m Money) Cmp(o Money) (int, error) {
+	if _, err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.minor < o.minor:
+		return -1, nil
+	case m.minor > o.minor:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// MulFrac multiplies amount by num/den rounding half away from zero, used for fees and percentages
+func (m Money) MulFrac(num, den int64) (Money, error) {
+	if den == 0 {
+		return Money{}, errors.New("money: division by zero")
+	}
+
+	r := new(big.Rat).SetFrac(big.NewInt(m.minor), big.NewInt(1))
+	r.Mul(r, big.NewRat(num, den))
+
+	// Round half away from zero: trunc(r + sign(r) * 1/2)
+	half := big.NewRat(1, 2)
+	if r.Sign() < 0 {
+		half.Neg(half)
+	}
+	r.Add(r, half)
+	q := new(big.Int).Quo(r.Num(), r.Denom())
+
+	if !q.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{q.Int64(), m.currency}, nil
+}
+
+type jsonMoney struct {
+	Value    json.RawMessage `json:"value"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Value    string   `json:"value"`
+		Currency Currency `json:"currency"`
+	}{m.Decimal(), m.currency})
+}
+
+// UnmarshalJSON accepts value both as decimal string and json number, number is parsed
+// from its text, so it doesn't lose precision. Currency can be empty only for zero amount
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var j jsonMoney
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	value := string(j.Value)
+	if strings.HasPrefix(value, `"`) {
+		if err := json.Unmarshal(j.Value, &value); err != nil {
+			return err
+		}
+	}
+
+	// Zero value Money is marshalled without currency, so it's read back the same
+	if j.Currency == "" && isZero(value) {
+		*m = Money{}
+		return nil
+	}
+
+	c, err := ParseCurrency(j.Currency)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := Parse(value, c)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// compositeText formats money as text representation of money_amount composite type
+func (m Money) compositeText() string {
+	return fmt.Sprintf("(%d,%s)", m.minor, m.currency)
+}
+
+func parseCompositeText(s string) (Money, error) {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return Money{}, fmt.Errorf("money: invalid money_amount: %s", s)
+	}
+
+	minor, currency, ok := strings.Cut(s[1:len(s)-1], ",")
+	if !ok {
+		return Money{}, fmt.Errorf("money: invalid money_amount: %s", s)
+	}
+
+	n, err := strconv.ParseInt(strings.Trim(minor, `"`), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("money: invalid money_amount: %s", s)
+	}
+
+	return Money{n, Currency(strings.Trim(currency, `"`))}, nil
+}
+
+// Scan implements sql.Scanner for money_amount in text format
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		parsed, err := parseCompositeText(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case []byte:
+		return m.Scan(string(v))
+	case nil:
+		return errors.New("money: cannot scan NULL")
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+}
+
+// Value implements driver.Valuer
+func (m Money) Value() (driver.Value, error) {
+	return m.compositeText(), nil
+}
+
+// ScanText implements pgtype.TextScanner, pgx uses it for money_amount since the type isn't registered
+func (m *Money) ScanText(v pgtype.Text) error {
+	if !v.Valid {
+		return m.Scan(nil)
+	}
+	return m.Scan(v.String)
+}
+
+// TextValue implements pgtype.TextValuer
+func (m Money) TextValue() (pgtype.Text, error) {
+	return pgtype.Text{String: m.compositeText(), Valid: true}, nil
+}
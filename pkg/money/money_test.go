@@ -0,0 +1,42 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, m := range []Money{{}, New(0, RUB), New(10050, RUB), New(-1, USD)} {
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Money
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		if got != m {
+			t.Fatalf("%s is read as %v, want %v", b, got, m)
+		}
+	}
+}
+
+func TestUnmarshalJSONCurrency(t *testing.T) {
+	tests := []struct {
+		json string
+		ok   bool
+	}{
+		{`{"value": "0", "currency": ""}`, true},
+		{`{"value": 0.00}`, true},
+		{`{"value": "1.00", "currency": ""}`, false},
+		{`{"value": "0.01"}`, false},
+		{`{"value": "", "currency": ""}`, false},
+		{`{"value": "0", "currency": "XXX"}`, false},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := json.Unmarshal([]byte(tt.json), &m); (err == nil) != tt.ok {
+			t.Errorf("%s: got %v, want ok %t", tt.json, err, tt.ok)
+		}
+	}
+}
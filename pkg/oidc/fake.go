@@ -0,0 +1,258 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	FakeName         = "fake"
+	FakeClientId     = "district-funding"
+	FakeClientSecret = "fake-secret"
+
+	fakeCodeTTL  = time.Minute
+	fakeTokenTTL = time.Hour
+)
+
+var fakeSignInPage = template.Must(template.New("signin").Parse(`<!doctype html>
+<title>Fake OIDC provider</title>
+<form method="get">
+{{range $k, $v := .}}{{if ne $k "login_hint"}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}{{end}}<label>Email <input type="email" name="login_hint" required autofocus></label>
+<button>Sign in</button>
+</form>
+`))
+
+type fakeCode struct {
+	redirectUri string
+	challenge   string
+	nonce       string
+	email       string
+	expiresAt   time.Time
+}
+
+// FakeProvider is an in-process OIDC provider for local development and CI. Its sign in page asks only for email,
+// login_hint parameter skips the page. Every email is verified and its subject is derived from the email,
+// so signing in with the same email returns the same identity
+type FakeProvider struct {
+	issuer string
+	// prefix is path of the issuer, the provider is mounted under it
+	prefix string
+	key    jwk.Key
+
+	mu    sync.Mutex
+	codes map[string]*fakeCode
+}
+
+// NewFakeProvider creates provider with issuer url it's reachable at from the browser
+func NewFakeProvider(issuer string) (*FakeProvider, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.KeyIDKey, "fake"); err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.AlgorithmKey, jwa.ES256); err != nil {
+		return nil, err
+	}
+
+	return &FakeProvider{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		prefix: strings.TrimSuffix(u.Path, "/"),
+		key:    key,
+		codes:  make(map[string]*fakeCode),
+	}, nil
+}
+
+// Config returns config of the provider, its endpoints are discovered
+func (f *FakeProvider) Config(redirectUrl string) Config {
+	return Config{
+		Name:         FakeName,
+		Issuer:       f.issuer,
+		ClientId:     FakeClientId,
+		ClientSecret: FakeClientSecret,
+		RedirectUrl:  redirectUrl,
+	}
+}
+
+// Path returns path of the issuer url, the provider is mounted at it
+func (f *FakeProvider) Path() string {
+	return f.prefix
+}
+
+// Client returns http client that calls the provider in process, so the service doesn't need to reach
+// the issuer url the way the browser does
+func (f *FakeProvider) Client() *http.Client {
+	return &http.Client{Transport: fakeTransport{f}}
+}
+
+func (f *FakeProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, f.prefix) {
+	case "/.well-known/openid-configuration":
+		writeJson(w, http.StatusOK, map[string]string{
+			"issuer":                 f.issuer,
+			"authorization_endpoint": f.issuer + "/authorize",
+			"token_endpoint":         f.issuer + "/token",
+			"jwks_uri":               f.issuer + "/jwks",
+		})
+	case "/jwks":
+		set := jwk.NewSet()
+		public, err := f.key.PublicKey()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = set.AddKey(public)
+		writeJson(w, http.StatusOK, set)
+	case "/authorize":
+		f.authorize(w, r)
+	case "/token":
+		f.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *FakeProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectUri, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirectUri.IsAbs() || q.Get("client_id") != FakeClientId || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(q.Get("login_hint")))
+	if email == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = fakeSignInPage.Execute(w, q)
+		return
+	}
+
+	code, err := RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f.mu.Lock()
+	for k, c := range f.codes {
+		if time.Now().After(c.expiresAt) {
+			delete(f.codes, k)
+		}
+	}
+	f.codes[code] = &fakeCode{
+		redirectUri: redirectUri.String(),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		email:       email,
+		expiresAt:   time.Now().Add(fakeCodeTTL),
+	}
+	f.mu.Unlock()
+
+	params := redirectUri.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirectUri.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+func (f *FakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	f.mu.Lock()
+	c, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || time.Now().After(c.expiresAt) || r.PostForm.Get("redirect_uri") != c.redirectUri ||
+		r.PostForm.Get("client_id") != FakeClientId || r.PostForm.Get("client_secret") != FakeClientSecret ||
+		subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(c.challenge)) != 1 {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	subject := sha256.Sum256([]byte(c.email))
+	name, _, _ := strings.Cut(c.email, "@")
+	now := time.Now()
+	token, err := jwt.NewBuilder().
+		Issuer(f.issuer).
+		Subject(hex.EncodeToString(subject[:8])).
+		Audience([]string{FakeClientId}).
+		IssuedAt(now).
+		Expiration(now.Add(fakeTokenTTL)).
+		Claim("nonce", c.nonce).
+		Claim("email", c.email).
+		Claim("email_verified", true).
+		Claim("name", name).
+		Claim("given_name", name).
+		Claim("preferred_username", name).
+		Build()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.ES256, f.key))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(fakeTokenTTL.Seconds()),
+		"id_token":     string(signed),
+	})
+}
+
+type fakeTransport struct {
+	f *FakeProvider
+}
+
+func (t fakeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.f.ServeHTTP(rec, r)
+	return rec.Result(), nil
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
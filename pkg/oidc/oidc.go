@@ -0,0 +1,323 @@
+// Package oidc is an OpenID Connect relying party: authorization code flow with PKCE, where the identity
+// comes from ID token verified with keys of the provider. Provider endpoints are discovered from the issuer
+package oidc
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/robloxxa/DistrictFunding/pkg/jwtauth"
+)
+
+const (
+	keysRefreshInterval = time.Hour
+	// maxResponseSize limits responses of the provider read into memory
+	maxResponseSize = 1 << 20
+)
+
+var (
+	// ErrRejected is returned when provider rejects authorization code, e.g. it's expired or already used
+	ErrRejected = errors.New("oidc: authorization code is rejected by provider")
+	// ErrInvalidIdToken is returned for ID tokens with invalid signature, issuer, audience, nonce or expiration
+	ErrInvalidIdToken = errors.New("oidc: invalid id token")
+)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// Config of a provider, it's read from OIDC_PROVIDERS of auth service as json
+type Config struct {
+	// Name identifies the provider in routes and linked identities, e.g. google
+	Name         string `json:"name"`
+	Issuer       string `json:"issuer"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// RedirectUrl is where provider sends the browser with the code
+	RedirectUrl string `json:"redirect_url"`
+	// Scopes are openid, email and profile if empty
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Endpoints are taken from discovery document of the issuer unless set
+	AuthUrl     string `json:"auth_url,omitempty"`
+	TokenUrl    string `json:"token_url,omitempty"`
+	UserinfoUrl string `json:"userinfo_url,omitempty"`
+	JwksUrl     string `json:"jwks_url,omitempty"`
+}
+
+// Claims is the identity of the account at the provider, Email may be empty if provider doesn't share it
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	GivenName         string `json:"given_name"`
+	FamilyName        string `json:"family_name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// UnmarshalJSON accepts email_verified sent as "true" string like some providers do
+func (c *Claims) UnmarshalJSON(b []byte) error {
+	type claims Claims
+	v := struct {
+		*claims
+		EmailVerified any `json:"email_verified"`
+	}{claims: (*claims)(c)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch verified := v.EmailVerified.(type) {
+	case bool:
+		c.EmailVerified = verified
+	case string:
+		c.EmailVerified = verified == "true"
+	}
+	return nil
+}
+
+type Provider struct {
+	cfg Config
+	c   *http.Client
+
+	// mu guards discovered config and keys, they are loaded on first use,
+	// so unavailable provider doesn't stop the service from starting
+	mu       sync.Mutex
+	resolved bool
+	keys     *jwtauth.RemoteKeySet
+}
+
+func New(cfg Config) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = defaultScopes
+	}
+	return &Provider{cfg: cfg, c: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *Provider) WithHTTPClient(c *http.Client) *Provider {
+	p.c = c
+	return p
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthUrl returns url of provider sign in page, state and nonce are random values stored until the callback,
+// verifier is PKCE code verifier passed to Exchange
+func (p *Provider) AuthUrl(ctx context.Context, state, nonce, verifier string) (string, error) {
+	if err := p.resolve(ctx); err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientId},
+		"redirect_uri":          {p.cfg.RedirectUrl},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.cfg.AuthUrl, "?") {
+		sep = "&"
+	}
+	return p.cfg.AuthUrl + sep + q.Encode(), nil
+}
+
+// Exchange redeems authorization code and returns claims of verified ID token. Missing email is taken from
+// userinfo endpoint if provider has one
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	if err := p.resolve(ctx); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectUrl},
+		"client_id":     {p.cfg.ClientId},
+		"client_secret": {p.cfg.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IdToken     string `json:"id_token"`
+	}
+	if err := p.do(req, &tokens); err != nil {
+		var se *statusError
+		if errors.As(err, &se) && se.status >= 400 && se.status < 500 {
+			return nil, fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+		return nil, err
+	}
+	if tokens.IdToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidIdToken)
+	}
+
+	token, err := p.keys.Parse([]byte(tokens.IdToken),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientId),
+		jwt.WithClaimValue("nonce", nonce),
+		jwt.WithAcceptableSkew(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIdToken, err)
+	}
+
+	var claims Claims
+	if err := remarshal(token.PrivateClaims(), &claims); err != nil {
+		return nil, err
+	}
+	claims.Subject = token.Subject()
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no sub claim", ErrInvalidIdToken)
+	}
+
+	if claims.Email == "" && p.cfg.UserinfoUrl != "" && tokens.AccessToken != "" {
+		if err := p.userinfo(ctx, tokens.AccessToken, &claims); err != nil {
+			return nil, err
+		}
+	}
+	return &claims, nil
+}
+
+// userinfo fills missing claims from userinfo endpoint, its sub has to match the ID token
+func (p *Provider) userinfo(ctx context.Context, accessToken string, claims *Claims) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.UserinfoUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var info Claims
+	if err := p.do(req, &info); err != nil {
+		return err
+	}
+	if info.Subject != claims.Subject {
+		return fmt.Errorf("oidc: userinfo is of another subject")
+	}
+
+	claims.Email, claims.EmailVerified = info.Email, info.EmailVerified
+	if claims.Name == "" {
+		claims.Name, claims.GivenName, claims.FamilyName = info.Name, info.GivenName, info.FamilyName
+	}
+	if claims.PreferredUsername == "" {
+		claims.PreferredUsername = info.PreferredUsername
+	}
+	return nil
+}
+
+// resolve discovers endpoints that aren't configured and sets up ID token keys
+func (p *Provider) resolve(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resolved {
+		return nil
+	}
+
+	if p.cfg.AuthUrl == "" || p.cfg.TokenUrl == "" || p.cfg.JwksUrl == "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+		if err != nil {
+			return err
+		}
+
+		var doc struct {
+			Issuer                string `json:"issuer"`
+			AuthorizationEndpoint string `json:"authorization_endpoint"`
+			TokenEndpoint         string `json:"token_endpoint"`
+			UserinfoEndpoint      string `json:"userinfo_endpoint"`
+			JwksUri               string `json:"jwks_uri"`
+		}
+		if err := p.do(req, &doc); err != nil {
+			return fmt.Errorf("unable to discover %s: %w", p.cfg.Name, err)
+		}
+		if doc.Issuer != p.cfg.Issuer {
+			return fmt.Errorf("unable to discover %s: issuer is %q", p.cfg.Name, doc.Issuer)
+		}
+
+		p.cfg.AuthUrl = cmp.Or(p.cfg.AuthUrl, doc.AuthorizationEndpoint)
+		p.cfg.TokenUrl = cmp.Or(p.cfg.TokenUrl, doc.TokenEndpoint)
+		p.cfg.UserinfoUrl = cmp.Or(p.cfg.UserinfoUrl, doc.UserinfoEndpoint)
+		p.cfg.JwksUrl = cmp.Or(p.cfg.JwksUrl, doc.JwksUri)
+	}
+
+	// Keys are refreshed in background for the lifetime of the provider
+	keys, err := jwtauth.NewRemoteKeySet(context.Background(), p.cfg.JwksUrl, keysRefreshInterval, jwk.WithHTTPClient(p.c))
+	if err != nil {
+		return fmt.Errorf("unable to fetch keys of %s: %w", p.cfg.Name, err)
+	}
+	p.keys, p.resolved = keys, true
+	return nil
+}
+
+// statusError is unsuccessful response of the provider
+type statusError struct {
+	status int
+	url    string
+	body   []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("oidc: %s responded with %d: %s", e.url, e.status, e.body)
+}
+
+// do sends the request and decodes json response
+func (p *Provider) do(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	res, err := p.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return &statusError{res.StatusCode, req.URL.Redacted(), body}
+	}
+	return json.Unmarshal(body, v)
+}
+
+// RandomString returns url-safe random value for state, nonce and PKCE code verifier
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func remarshal(from any, to any) error {
+	b, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, to)
+}
@@ -0,0 +1,238 @@
+// Package openapi builds OpenAPI 3 documents of the services from their request and response structs,
+// serves them with a docs page and checks that documented routes match the routes of chi router
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+const Version = "3.0.3"
+
+// Security schemes of the routes
+const (
+	// SecurityBearer is JWT access token issued by auth service
+	SecurityBearer = "bearer"
+	// SecurityInternal is the token of service-to-service routes, see internalapi
+	SecurityInternal = "internal"
+)
+
+type (
+	Document struct {
+		OpenAPI    string              `json:"openapi"`
+		Info       Info                `json:"info"`
+		Paths      map[string]PathItem `json:"paths"`
+		Components Components          `json:"components"`
+
+		// types maps component names to the go types they were generated from
+		types map[string]reflect.Type
+		enums map[reflect.Type][]any
+	}
+
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+
+	// PathItem maps lower case http methods to operations
+	PathItem map[string]*Operation
+
+	Operation struct {
+		Summary     string                `json:"summary,omitempty"`
+		Description string                `json:"description,omitempty"`
+		Parameters  []Parameter           `json:"parameters,omitempty"`
+		RequestBody *RequestBody          `json:"requestBody,omitempty"`
+		Responses   map[string]*Response  `json:"responses"`
+		Security    []map[string][]string `json:"security,omitempty"`
+	}
+
+	Parameter struct {
+		Name        string  `json:"name"`
+		In          string  `json:"in"`
+		Description string  `json:"description,omitempty"`
+		Required    bool    `json:"required,omitempty"`
+		Schema      *Schema `json:"schema"`
+	}
+
+	RequestBody struct {
+		Required bool                 `json:"required"`
+		Content  map[string]MediaType `json:"content"`
+	}
+
+	Response struct {
+		Description string               `json:"description"`
+		Content     map[string]MediaType `json:"content,omitempty"`
+	}
+
+	MediaType struct {
+		Schema *Schema `json:"schema"`
+	}
+
+	Components struct {
+		Schemas         map[string]*Schema         `json:"schemas"`
+		SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+	}
+
+	SecurityScheme struct {
+		Type         string `json:"type"`
+		Scheme       string `json:"scheme,omitempty"`
+		BearerFormat string `json:"bearerFormat,omitempty"`
+		Name         string `json:"name,omitempty"`
+		In           string `json:"in,omitempty"`
+	}
+)
+
+// Route describes a single route of the service. Request and Response are values of the go types
+// sent in bodies, schemas are generated from them. Path parameters are added from the path
+// as strings unless Params describe them
+type Route struct {
+	Summary     string
+	Description string
+	Security    string
+	Params      []Parameter
+	Request     any
+	// Status is the status of successful response, 200 by default
+	Status   int
+	Response any
+	// ContentType of successful response, application/json by default
+	ContentType string
+	// Errors are statuses of problem responses the route may return
+	Errors []int
+}
+
+var pathParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// New creates document of the service, the document describes its own /openapi.json and /docs routes
+func New(title, version string) *Document {
+	d := &Document{
+		OpenAPI: Version,
+		Info:    Info{title, version},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{
+				SecurityBearer:   {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				SecurityInternal: {Type: "apiKey", Name: "X-Internal-Token", In: "header"},
+			},
+		},
+		types: map[string]reflect.Type{},
+		enums: map[reflect.Type][]any{},
+	}
+
+	d.Add(http.MethodGet, "/openapi.json", Route{
+		Summary:  "OpenAPI document of the service",
+		Response: &Schema{Type: "object"},
+	})
+	d.Add(http.MethodGet, "/docs", Route{
+		Summary:     "API docs page",
+		Response:    &Schema{Type: "string"},
+		ContentType: "text/html",
+	})
+
+	return d
+}
+
+// Enum sets allowed values of a named type, e.g. d.Enum(StatusDraft, StatusActive).
+// It has to be called before the type is used by routes
+func (d *Document) Enum(values ...any) *Document {
+	if len(values) == 0 {
+		return d
+	}
+	d.enums[reflect.TypeOf(values[0])] = values
+	return d
+}
+
+// Add describes the route, method and path are the same as passed to chi router
+func (d *Document) Add(method, path string, route Route) *Document {
+	op := &Operation{
+		Summary:     route.Summary,
+		Description: route.Description,
+		Responses:   map[string]*Response{},
+	}
+
+	declared := map[string]bool{}
+	for _, p := range route.Params {
+		if p.In == "path" {
+			declared[p.Name] = true
+		}
+	}
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		if !declared[m[1]] {
+			op.Parameters = append(op.Parameters, PathParam(m[1], String(), ""))
+		}
+	}
+	op.Parameters = append(op.Parameters, route.Params...)
+
+	if route.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {d.Schema(route.Request)}},
+		}
+	}
+
+	status, contentType := route.Status, route.ContentType
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	res := &Response{Description: http.StatusText(status)}
+	if route.Response != nil {
+		res.Content = map[string]MediaType{contentType: {d.Schema(route.Response)}}
+	}
+	op.Responses[strconv.Itoa(status)] = res
+
+	var errs []int
+	if route.Security != "" {
+		errs = append(errs, http.StatusUnauthorized)
+	}
+	errs = append(errs, route.Errors...)
+	errs = append(errs, http.StatusInternalServerError)
+	problem := d.Schema(response.Problem{})
+	for _, s := range errs {
+		op.Responses[strconv.Itoa(s)] = &Response{
+			Description: http.StatusText(s),
+			Content:     map[string]MediaType{response.ContentTypeProblem: {problem}},
+		}
+	}
+
+	if route.Security != "" {
+		op.Security = []map[string][]string{{route.Security: {}}}
+	}
+
+	path = normalizePath(path)
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+	return d
+}
+
+func PathParam(name string, schema *Schema, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: schema}
+}
+
+func QueryParam(name string, schema *Schema, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func HeaderParam(name string, schema *Schema, description string) Parameter {
+	return Parameter{Name: name, In: "header", Description: description, Schema: schema}
+}
+
+// normalizePath strips trailing slash chi adds to the root route of subrouters and regexps of path parameters
+func normalizePath(path string) string {
+	path = pathParam.ReplaceAllString(path, "{$1}")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
@@ -0,0 +1,229 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/robloxxa/DistrictFunding/pkg/money"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Example              any                `json:"example,omitempty"`
+}
+
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+func Integer() *Schema {
+	return &Schema{Type: "integer"}
+}
+
+func Boolean() *Schema {
+	return &Schema{Type: "boolean"}
+}
+
+func DateTime() *Schema {
+	return &Schema{Type: "string", Format: "date-time"}
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	moneyType = reflect.TypeOf(money.Money{})
+)
+
+// Schema returns schema of the value's type, named structs are added to components and referenced.
+// *Schema values are returned as is
+func (d *Document) Schema(v any) *Schema {
+	if s, ok := v.(*Schema); ok {
+		return s
+	}
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return DateTime()
+	case moneyType:
+		// Money marshals to {"value": "100.50", "currency": "RUB"}, its fields are unexported
+		return d.component(t, func() *Schema {
+			return &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"value":    {Type: "string", Description: "decimal amount, json number is accepted too", Example: "100.50"},
+					"currency": {Type: "string", Enum: []any{money.RUB, money.USD, money.EUR, ""}, Description: "empty only for zero amount"},
+				},
+				Required: []string{"value"},
+			}
+		})
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := d.schemaOf(t.Elem())
+		if s.Ref == "" {
+			c := *s
+			c.Nullable = true
+			s = &c
+		}
+		return s
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Struct:
+		// Anonymous and generic instantiated structs have no sensible component name, so they are inlined
+		if t.Name() == "" || strings.Contains(t.Name(), "[") {
+			return d.structSchema(t)
+		}
+		return d.component(t, func() *Schema { return d.structSchema(t) })
+	case reflect.String:
+		return &Schema{Type: "string", Enum: d.enums[t]}
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	default:
+		// interface{} and anything else is any value
+		return &Schema{}
+	}
+}
+
+// component adds schema built by build to components once and returns reference to it
+func (d *Document) component(t reflect.Type, build func() *Schema) *Schema {
+	name := t.Name()
+	if other, ok := d.types[name]; ok && other != t {
+		// Types with the same name from different packages are prefixed with the package name
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = string(unicode.ToUpper(rune(pkg[0]))) + pkg[1:] + name
+	}
+
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := d.types[name]; ok {
+		return ref
+	}
+
+	// Placeholder is stored before building, so recursive types reference it instead of looping
+	s := &Schema{}
+	d.types[name] = t
+	d.Components.Schemas[name] = s
+	*s = *build()
+	return ref
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without json name are flattened like encoding/json does
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := d.structSchema(ft)
+				for n, p := range embedded.Properties {
+					s.Properties[n] = p
+				}
+				s.Required = append(s.Required, embedded.Required...)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		p := d.schemaOf(f.Type)
+		if applyRules(p, f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = p
+	}
+
+	return s
+}
+
+// applyRules narrows the schema with validate tag rules, returns true if the field is required
+func applyRules(s *Schema, tag string) (required bool) {
+	if tag == "" {
+		return false
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "url":
+			s.Format = "uri"
+		case "uuid":
+			s.Format = "uuid"
+		case "oneof":
+			s.Enum = nil
+			for _, v := range strings.Fields(param) {
+				s.Enum = append(s.Enum, v)
+			}
+		case "max", "lte", "min", "gte", "len", "gt", "lt":
+			if s.Type != "string" {
+				continue
+			}
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			switch name {
+			case "max", "lte":
+				s.MaxLength = &n
+			case "lt":
+				n--
+				s.MaxLength = &n
+			case "min", "gte":
+				s.MinLength = &n
+			case "gt":
+				n++
+				s.MinLength = &n
+			case "len":
+				s.MinLength, s.MaxLength = &n, &n
+			}
+		}
+	}
+
+	return required
+}
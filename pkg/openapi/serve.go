@@ -0,0 +1,76 @@
+package openapi
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robloxxa/DistrictFunding/pkg/response"
+)
+
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>%s</title>
+</head>
+<body>
+	<redoc spec-url="openapi.json"></redoc>
+	<script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+// Serve registers the document at /openapi.json and its docs page at /docs
+func Serve(r chi.Router, d *Document) {
+	page := fmt.Sprintf(docsPage, html.EscapeString(d.Info.Title))
+
+	r.Get("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		response.Json(w, d)
+	})
+	r.Get("/docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	})
+}
+
+// Verify returns error listing routes that are served by the router but aren't documented and the other way around
+func Verify(routes chi.Routes, d *Document) error {
+	served := map[string]bool{}
+	err := chi.Walk(routes, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		served[method+" "+normalizePath(route)] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	documented := map[string]bool{}
+	for path, item := range d.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	var drift []string
+	for route := range served {
+		if !documented[route] {
+			drift = append(drift, "undocumented "+route)
+		}
+	}
+	for route := range documented {
+		if !served[route] {
+			drift = append(drift, "not served "+route)
+		}
+	}
+	if len(drift) > 0 {
+		sort.Strings(drift)
+		return fmt.Errorf("openapi document of %s doesn't match routes: %s", d.Info.Title, strings.Join(drift, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package outbox implements transactional outbox. Events are inserted in the same transaction as the change
+// they describe and delivered by Relay at least once, so receivers must handle duplicates.
+// Events of one aggregate are delivered in the order they were inserted.
+//
+// Every service database using it has Outbox table:
+//
+//	CREATE TABLE IF NOT EXISTS Outbox (
+//	    id BIGSERIAL PRIMARY KEY,
+//	    event_type VARCHAR(64) NOT NULL,
+//	    payload JSONB NOT NULL,
+//	    attempts INT NOT NULL DEFAULT 0,
+//	    last_error TEXT,
+//	    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+//	    delivered_at TIMESTAMPTZ,
+//	    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+//	    aggregate_id VARCHAR(64) NOT NULL DEFAULT '',
+//	    locked_until TIMESTAMPTZ
+//	);
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+)
+
+const (
+	batchSize  = 20
+	maxBackoff = time.Hour
+	// lease is how long claimed events belong to the relay, it covers delivery of the whole batch
+	lease = 5 * time.Minute
+	// claimLockId is the advisory lock key held while claiming, so relays never split events of an aggregate
+	claimLockId = 7340210616
+)
+
+type Event struct {
+	Id            int64      `db:"id"`
+	EventType     string     `db:"event_type"`
+	Payload       []byte     `db:"payload"`
+	Attempts      int        `db:"attempts"`
+	LastError     *string    `db:"last_error"`
+	NextAttemptAt time.Time  `db:"next_attempt_at"`
+	DeliveredAt   *time.Time `db:"delivered_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+	AggregateId   string     `db:"aggregate_id"`
+	LockedUntil   *time.Time `db:"locked_until"`
+}
+
+var ErrNoTx = errors.New("outbox: event must be inserted inside db.WithTx")
+
+// Insert writes event of the aggregate in the transaction of the change it's describing, ctx must carry the transaction
+func Insert(ctx context.Context, aggregateId string, eventType string, payload any) error {
+	tx, ok := db.TxFromContext(ctx)
+	if !ok {
+		return ErrNoTx
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO Outbox (aggregate_id, event_type, payload) VALUES ($1, $2, $3)`, aggregateId, eventType, b)
+	return err
+}
+
+// Backoff returns delay before the next attempt, doubling from a second up to an hour
+func Backoff(attempts int) time.Duration {
+	backoff := time.Second << min(attempts, 12)
+	return min(backoff, maxBackoff)
+}
+
+// Relay passes undelivered events to deliver, failed events are retried with Backoff.
+// Later events of the aggregate of failed event wait for it
+type Relay struct {
+	db       *pgxpool.Pool
+	deliver  func(*Event) error
+	interval time.Duration
+}
+
+func NewRelay(db *pgxpool.Pool, deliver func(*Event) error, interval time.Duration) *Relay {
+	return &Relay{db, deliver, interval}
+}
+
+// Run delivers events until ctx is done, full batches are followed by the next one right away
+func (r *Relay) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		n, err := r.process(ctx, batchSize)
+		if err != nil {
+			log.Println(fmt.Errorf("unable to process outbox: %w", err))
+		}
+
+		if n == batchSize {
+			timer.Reset(0)
+		} else {
+			timer.Reset(r.interval)
+		}
+	}
+}
+
+// process claims due undelivered events and delivers them, returns number of claimed events.
+// Claim is committed before delivery, so no row lock is held while receivers are called
+func (r *Relay) process(ctx context.Context, limit int) (int, error) {
+	events, err := r.claim(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	// failed are aggregates whose event failed in this batch, their later events are released undelivered
+	failed := make(map[string]bool)
+	for i := range events {
+		e := &events[i]
+		if failed[e.AggregateId] {
+			if err := db.Exec(ctx, r.db, `UPDATE Outbox SET locked_until = NULL WHERE id = $1`, e.Id); err != nil {
+				return len(events), err
+			}
+			continue
+		}
+
+		if err := r.deliver(e); err != nil {
+			failed[e.AggregateId] = true
+			if err := db.Exec(ctx, r.db, `UPDATE Outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3,
+			locked_until = NULL WHERE id = $1`, e.Id, err.Error(), time.Now().Add(Backoff(e.Attempts+1))); err != nil {
+				return len(events), err
+			}
+			continue
+		}
+
+		if err := db.Exec(ctx, r.db, `UPDATE Outbox SET attempts = attempts + 1, delivered_at = current_timestamp, last_error = NULL,
+		locked_until = NULL WHERE id = $1`, e.Id); err != nil {
+			return len(events), err
+		}
+	}
+
+	return len(events), nil
+}
+
+// claim leases due events oldest first. Event is skipped while an earlier event of its aggregate waits for retry
+// or is claimed by another relay, so events of an aggregate are never delivered out of order
+func (r *Relay) claim(ctx context.Context, limit int) ([]Event, error) {
+	var events []Event
+	err := db.WithTx(ctx, r.db, func(ctx context.Context) error {
+		tx := db.Conn(ctx, r.db)
+
+		if err := db.Exec(ctx, tx, `SELECT pg_advisory_xact_lock($1)`, claimLockId); err != nil {
+			return err
+		}
+
+		var err error
+		events, err = db.QueryAll[Event](ctx, tx, `UPDATE Outbox SET locked_until = $2 WHERE id IN (
+			SELECT id FROM Outbox o WHERE delivered_at IS NULL AND next_attempt_at <= current_timestamp
+			AND (locked_until IS NULL OR locked_until < current_timestamp)
+			AND NOT EXISTS (
+				SELECT 1 FROM Outbox p WHERE p.aggregate_id = o.aggregate_id AND p.id < o.id AND p.delivered_at IS NULL
+				AND (p.next_attempt_at > current_timestamp OR p.locked_until >= current_timestamp)
+			)
+			ORDER BY id LIMIT $1
+		) RETURNING *`, limit, time.Now().Add(lease))
+		return err
+	})
+
+	slices.SortFunc(events, func(a, b Event) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return events, err
+}
@@ -0,0 +1,79 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robloxxa/DistrictFunding/pkg/db"
+	"github.com/robloxxa/DistrictFunding/pkg/db/dbtest"
+	"github.com/robloxxa/DistrictFunding/pkg/migrate"
+)
+
+func migrations() ([]migrate.Migration, error) {
+	return []migrate.Migration{{Version: 1, Name: "outbox", Up: `CREATE TABLE Outbox (
+		id BIGSERIAL PRIMARY KEY,
+		event_type VARCHAR(64) NOT NULL,
+		payload JSONB NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+		delivered_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT current_timestamp,
+		aggregate_id VARCHAR(64) NOT NULL DEFAULT '',
+		locked_until TIMESTAMPTZ
+	)`, Down: `DROP TABLE Outbox`}}, nil
+}
+
+func insert(t *testing.T, pool *pgxpool.Pool, aggregateId string, eventType string) {
+	t.Helper()
+
+	err := db.WithTx(context.Background(), pool, func(ctx context.Context) error {
+		return Insert(ctx, aggregateId, eventType, struct{}{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventsOfAggregateAreDeliveredInOrder(t *testing.T) {
+	pool := dbtest.New(t, migrations)
+	ctx := context.Background()
+
+	insert(t, pool, "1", "first")
+	insert(t, pool, "1", "second")
+	insert(t, pool, "2", "other")
+
+	// The first event fails once, the second one has to wait for it
+	var delivered []string
+	failed := false
+	r := NewRelay(pool, func(e *Event) error {
+		if e.EventType == "first" && !failed {
+			failed = true
+			return errors.New("receiver is down")
+		}
+		delivered = append(delivered, e.EventType)
+		return nil
+	}, 0)
+
+	for range 2 {
+		if _, err := r.process(ctx, batchSize); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(delivered, []string{"other"}) {
+		t.Fatalf("delivered %v while the first event waits for retry, want [other]", delivered)
+	}
+
+	if err := db.Exec(ctx, pool, `UPDATE Outbox SET next_attempt_at = current_timestamp WHERE event_type = 'first'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.process(ctx, batchSize); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"other", "first", "second"}; !slices.Equal(delivered, want) {
+		t.Fatalf("delivered %v, want %v", delivered, want)
+	}
+}
@@ -10,13 +10,6 @@ type response struct {
 	Message string `json:"message"`
 }
 
-// Error function responses with an error message in json format
-// Panics if encoding of json is failed
-func Error(w http.ResponseWriter, status int, errMsg error) {
-	w.WriteHeader(status)
-	Json(w, &response{errMsg.Error()})
-}
-
 func Message(w http.ResponseWriter, msg string) {
 	Json(w, &response{msg})
 }
@@ -0,0 +1,180 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+)
+
+const ContentTypeProblem = "application/problem+json"
+
+// Stable error codes shared by every service, services define their own codes for domain errors
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidBody      = "invalid_body"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeUpstreamFailed   = "upstream_failed"
+	CodeInternal         = "internal_error"
+)
+
+var (
+	ErrInvalidBody = NewProblem(http.StatusBadRequest, CodeInvalidBody, "failed to parse json body")
+)
+
+// Problem is RFC 7807 problem details with a stable machine-readable Code clients can branch on.
+// Problem is an error, so handlers and models can return it as is
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestId string       `json:"request_id,omitempty"`
+}
+
+// FieldError is a validation failure of a single request field, Field is a json path of the field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func NewProblem(status int, code string, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	return p.Detail
+}
+
+// Is reports whether target is a problem with the same code, so errors.Is matches copies made by WithDetail
+// and problems decoded from responses of other services
+func (p *Problem) Is(target error) bool {
+	t, ok := target.(*Problem)
+	return ok && t.Code != "" && t.Code == p.Code
+}
+
+// WithDetail returns copy of the problem with another detail message
+func (p *Problem) WithDetail(format string, args ...any) *Problem {
+	c := *p
+	c.Detail = fmt.Sprintf(format, args...)
+	return &c
+}
+
+// ValidationProblem converts validator errors to a problem listing every invalid field
+func ValidationProblem(errs validator.ValidationErrors) *Problem {
+	p := NewProblem(http.StatusBadRequest, CodeValidationFailed, "request validation failed")
+	for _, fe := range errs {
+		p.Errors = append(p.Errors, FieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldMessage(fe),
+		})
+	}
+	return p
+}
+
+// Error writes err as a problem. Problem errors are written as is, validation errors are listed by field,
+// other errors get status and the code of it. Other errors may come from libraries and describe internals,
+// e.g. why jwt didn't parse, so they are logged with request id and never sent to the client
+func Error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	var (
+		p    *Problem
+		errs validator.ValidationErrors
+	)
+	switch {
+	case errors.As(err, &p):
+	case errors.As(err, &errs):
+		p = ValidationProblem(errs)
+	default:
+		log.Printf("[%s] %s %s: %d: %v", middleware.GetReqID(r.Context()), r.Method, r.URL.Path, status, err)
+		p = NewProblem(status, statusCode(status), "")
+	}
+
+	WriteProblem(w, r, p)
+}
+
+// WriteProblem writes the problem with the request path and id
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	res := *p
+	res.Instance = r.URL.Path
+	res.RequestId = middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(res.Status)
+	if err := json.NewEncoder(w).Encode(&res); err != nil {
+		log.Println(err)
+	}
+}
+
+func statusCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUpstreamFailed
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// fieldPath returns namespace of the field without the name of validated struct
+func fieldPath(fe validator.FieldError) string {
+	_, path, ok := strings.Cut(fe.Namespace(), ".")
+	if !ok {
+		return fe.Field()
+	}
+	return path
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email"
+	case "url":
+		return "must be a valid url"
+	case "uuid":
+		return "must be a valid uuid"
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte", "min":
+		return "must be at least " + fe.Param()
+	case "lt":
+		return "must be less than " + fe.Param()
+	case "lte", "max":
+		return "must be at most " + fe.Param()
+	}
+	return "must satisfy " + fe.Tag()
+}
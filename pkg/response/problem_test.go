@@ -0,0 +1,55 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/robloxxa/DistrictFunding/pkg/validate"
+)
+
+func TestErrorHidesRawErrors(t *testing.T) {
+	var invalid struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   Problem
+	}{
+		{"problem", http.StatusConflict, ErrInvalidBody, *ErrInvalidBody},
+		{"validation", http.StatusBadRequest, validate.Struct(invalid), Problem{
+			Status: http.StatusBadRequest,
+			Code:   CodeValidationFailed,
+			Detail: "request validation failed",
+			Errors: []FieldError{{Field: "email", Rule: "required", Message: "is required"}},
+		}},
+		{"client error", http.StatusUnauthorized, errors.New("jwt: token is signed with unknown key kid-1"), Problem{
+			Status: http.StatusUnauthorized,
+			Code:   CodeUnauthorized,
+		}},
+		{"server error", http.StatusInternalServerError, errors.New("dial tcp 10.0.0.5:5432: connection refused"), Problem{
+			Status: http.StatusInternalServerError,
+			Code:   CodeInternal,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Error(rec, httptest.NewRequest(http.MethodGet, "/", nil), tt.status, tt.err)
+
+			var got Problem
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.want.Status || got.Code != tt.want.Code || got.Detail != tt.want.Detail ||
+				len(got.Errors) != len(tt.want.Errors) || len(got.Errors) > 0 && got.Errors[0] != tt.want.Errors[0] {
+				t.Fatalf("got %d %+v, want %+v", rec.Code, got, tt.want)
+			}
+		})
+	}
+}
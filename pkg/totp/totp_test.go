@@ -0,0 +1,79 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret of RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// Codes of the RFC are 8 digits, 6 digit codes are their last digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d is %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := Counter(now)
+
+	tests := []struct {
+		offset int64
+		skew   int
+		ok     bool
+	}{
+		{0, 0, true},
+		{-1, 0, false},
+		{1, 0, false},
+		{-1, 1, true},
+		{1, 1, true},
+		{-2, 1, false},
+		{2, 1, false},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, counter+tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := Validate(rfcSecret, code, now, tt.skew)
+		if ok != tt.ok {
+			t.Errorf("code of period %+d with skew %d is valid: %t, want %t", tt.offset, tt.skew, ok, tt.ok)
+		}
+		if ok && got != counter+tt.offset {
+			t.Errorf("code of period %+d matched counter %d, want %d", tt.offset, got, counter+tt.offset)
+		}
+	}
+}
+
+func TestValidateLength(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	// Last digits of the 8 digit code are right, but codes have to be exactly Digits long
+	for _, code := range []string{"", "82", "87082", "4287082", "94287082"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("code %q is valid", code)
+		}
+	}
+	if _, ok := Validate(rfcSecret, "287082", now, 1); !ok {
+		t.Error("code 287082 is not valid")
+	}
+}
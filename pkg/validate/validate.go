@@ -0,0 +1,36 @@
+// Package validate checks request bodies with validate struct tags, errors name fields by their json names
+package validate
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var v = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	return v
+}
+
+// Struct validates s, returns validator.ValidationErrors if it's invalid
+func Struct(s any) error {
+	return v.Struct(s)
+}
+
+// Var validates a single value with tag, e.g. path parameters
+func Var(field any, tag string) error {
+	return v.Var(field, tag)
+}